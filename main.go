@@ -1,7 +1,34 @@
 package main
 
-import "reredis/pkg/server"
+import (
+	"fmt"
+	"os"
+	"reredis/pkg/config"
+	"reredis/pkg/server"
+)
+
+const usage = `Usage: reredis [/path/to/reredis.conf] [--name value [value ...]] ...
+
+Settings use redis.conf names and come from the config file first, then the
+command line, e.g.
+
+  reredis --port 6380 --maxmemory 100mb --maxmemory-policy allkeys-lru
+  reredis /etc/reredis.conf --notify-keyspace-events Ex`
 
 func main() {
-	server.StartServer()
+	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+		fmt.Println(usage)
+		return
+	}
+
+	cfg, err := config.FromArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	if err := server.StartServer(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
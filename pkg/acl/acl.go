@@ -0,0 +1,229 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"reredis/pkg/resp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_USER is the user every connection starts out as.
+const DEFAULT_USER = "default"
+
+var (
+	ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+	ErrBadUsername = errors.New("Usernames can't contain spaces or null characters")
+)
+
+// ACL holds the users and checks what they're allowed to do.
+type ACL struct {
+	Log *Log
+
+	commands map[string]*Command //keyed by lowercase name
+	lookup   map[string]*Command //also keyed by the names commands were given with
+	mutex    sync.RWMutex
+	users    map[string]*User
+}
+
+// New creates the access control lists for a set of commands, keyed by name, with just
+// the default user, which can do anything without a password.
+func New(commands map[string]*Command) *ACL {
+	acl := &ACL{
+		Log:      &Log{},
+		commands: map[string]*Command{},
+		lookup:   map[string]*Command{},
+	}
+	for name, cmd := range commands {
+		acl.commands[strings.ToLower(name)] = cmd
+		acl.lookup[strings.ToLower(name)] = cmd
+		acl.lookup[name] = cmd
+	}
+	acl.users = map[string]*User{DEFAULT_USER: acl.defaultUser()}
+	return acl
+}
+
+// defaultUser returns the default user as it is without any configuration.
+func (acl *ACL) defaultUser() *User {
+	user := newUser(DEFAULT_USER)
+	for _, rule := range []string{"on", "nopass", "~*", "&*", "+@all"} {
+		user.apply(rule, acl.commands)
+	}
+	return user
+}
+
+// Command looks up a command, and the subcommand args select if it has subcommands.
+func (acl *ACL) Command(name string, args []resp.Value) (*Command, bool) {
+	cmd, ok := acl.lookup[name]
+	if !ok {
+		if cmd, ok = acl.lookup[strings.ToLower(name)]; !ok {
+			return nil, false
+		}
+	}
+	return cmd.resolve(args), true
+}
+
+// User returns a user, which must not be modified, or nil if there's no such user.
+func (acl *ACL) User(name string) *User {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+	return acl.users[name]
+}
+
+// Users returns the names of all users, sorted.
+func (acl *ACL) Users() []string {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+	names := make([]string, 0, len(acl.users))
+	for name := range acl.users {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Authenticate returns the user if it's enabled and password is one of its passwords.
+func (acl *ACL) Authenticate(username string, password string) (*User, bool) {
+	user := acl.User(username)
+	if user == nil || !user.Enabled || !user.CheckPassword(password) {
+		return nil, false
+	}
+	return user, true
+}
+
+// SetUser creates or modifies a user by applying rules to it. Either all of them apply or
+// the user is left as it was and the error says which rule failed.
+func (acl *ACL) SetUser(name string, rules []string) error {
+	if strings.ContainsAny(name, " \x00") {
+		return ErrBadUsername
+	}
+	rules, err := joinSelectors(rules)
+	if err != nil {
+		return err
+	}
+
+	acl.mutex.Lock()
+	defer acl.mutex.Unlock()
+
+	user, ok := acl.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.apply(rule, acl.commands); err != nil {
+			return &RuleError{Rule: rule, Err: err}
+		}
+	}
+
+	acl.users[name] = user
+	return nil
+}
+
+// RuleError is a rule that couldn't be applied.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (err *RuleError) Error() string {
+	return "Error in ACL SETUSER modifier '" + err.Rule + "': " + err.Err.Error()
+}
+
+func (err *RuleError) Unwrap() error {
+	return err.Err
+}
+
+// DelUser deletes users, returning how many existed. The default user can't be deleted.
+func (acl *ACL) DelUser(names []string) (int, error) {
+	if slices.Contains(names, DEFAULT_USER) {
+		return 0, ErrDefaultUser
+	}
+
+	acl.mutex.Lock()
+	defer acl.mutex.Unlock()
+	deleted := 0
+	for _, name := range names {
+		if _, ok := acl.users[name]; ok {
+			delete(acl.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// SetRequirePass makes password the default user's only password, or lets it in with any
+// password if it's empty, like redis' requirepass.
+func (acl *ACL) SetRequirePass(password string) {
+	rules := []string{"nopass"}
+	if password != "" {
+		rules = []string{"resetpass", ">" + password}
+	}
+	acl.SetUser(DEFAULT_USER, rules)
+}
+
+// List describes every user as a rule line, "user <name> <rules...>", sorted by name.
+func (acl *ACL) List() []string {
+	acl.mutex.RLock()
+	defer acl.mutex.RUnlock()
+	lines := make([]string, 0, len(acl.users))
+	for _, user := range acl.users {
+		lines = append(lines, "user "+user.Name+" "+user.Describe())
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// CategoryCommands lists the commands in a category, subcommands as "container|sub".
+func (acl *ACL) CategoryCommands(category string) ([]string, bool) {
+	if !slices.Contains(CATEGORIES, category) {
+		return nil, false
+	}
+
+	names := []string{}
+	for _, cmd := range acl.commands {
+		if cmd.Subcommands == nil && cmd.inCategory(category) {
+			names = append(names, cmd.Name)
+		}
+		for _, sub := range cmd.Subcommands {
+			if sub.inCategory(category) {
+				names = append(names, sub.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, true
+}
+
+// Check tells whether user may run cmd with args. If not, it returns why, along with
+// the key or channel that was denied.
+func (acl *ACL) Check(user *User, cmd *Command, args []resp.Value) (int, string) {
+	reason, object := user.Root.check(cmd, args)
+	if reason == ALLOWED {
+		return ALLOWED, ""
+	}
+	for _, sel := range user.Selectors {
+		r, o := sel.check(cmd, args)
+		if r == ALLOWED {
+			return ALLOWED, ""
+		}
+		if r > reason {
+			reason, object = r, o
+		}
+	}
+	return reason, object
+}
+
+// DenialMessage explains why user can't run cmd, as ACL DRYRUN reports it.
+func DenialMessage(user *User, cmd *Command, reason int, object string) string {
+	switch reason {
+	case DENIED_KEY:
+		return fmt.Sprintf("User %s has no permissions to access the '%s' key", user.Name, object)
+	case DENIED_CHANNEL:
+		return fmt.Sprintf("User %s has no permissions to access the '%s' channel", user.Name, object)
+	default:
+		return fmt.Sprintf("User %s has no permissions to run the '%s' command", user.Name, cmd.Name)
+	}
+}
@@ -0,0 +1,129 @@
+package acl
+
+import (
+	"reredis/pkg/resp"
+	"strings"
+)
+
+// CATEGORIES are the command categories ACL rules can refer to with +@category, the
+// same ones redis has.
+var CATEGORIES = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string", "bitmap",
+	"hyperloglog", "geo", "stream", "pubsub", "admin", "fast", "slow", "blocking",
+	"dangerous", "connection", "transaction", "scripting",
+}
+
+// KeyPerm is the access a command needs to one of its keys. Keys it neither reads nor
+// writes, like the one LLEN only looks at the length of, need a pattern matching them
+// with any permission.
+type KeyPerm int
+
+const (
+	KEY_READ KeyPerm = 1 << iota
+	KEY_WRITE
+	KEY_RW = KEY_READ | KEY_WRITE
+)
+
+// KeySpec finds some of a command's keys in its arguments, which don't include the
+// command name, like redis' key specs do.
+type KeySpec struct {
+	Perm    KeyPerm
+	Keyword string //if set, the keys start after this argument, looked for from First on
+	First   int    //index of the first key
+	Last    int    //index of the last key, negative ones count from the end
+	Step    int    //arguments between keys, 0 counts as 1
+	Limit   int    //if more than 1, only the first 1/Limit of the range are keys (XREAD's STREAMS key ... id ...)
+}
+
+// ChannelSpec finds the pub/sub channels, or patterns, a command uses in its arguments.
+type ChannelSpec struct {
+	First   int
+	Last    int //negative ones count from the end
+	Pattern bool
+}
+
+// Command is what ACLs need to know about a command: the categories it's in, where
+// its keys and channels are, and its subcommands if it's a container like CONFIG.
+type Command struct {
+	Name        string //lowercase, "container|subcommand" for subcommands
+	Categories  []string
+	Keys        []KeySpec
+	Channels    *ChannelSpec
+	Subcommands map[string]*Command //keyed by lowercase name
+}
+
+// inCategory tells whether the command is in category.
+func (cmd *Command) inCategory(category string) bool {
+	for _, c := range cmd.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the subcommand args select, if cmd is a container and there is one.
+func (cmd *Command) resolve(args []resp.Value) *Command {
+	if cmd.Subcommands == nil || len(args) == 0 {
+		return cmd
+	}
+	if sub, ok := cmd.Subcommands[strings.ToLower(*args[0].Bulk)]; ok {
+		return sub
+	}
+	return cmd
+}
+
+// keys calls fn for every key in args along with the access needed to it, stopping if
+// fn returns false.
+func (cmd *Command) keys(args []resp.Value, fn func(key string, perm KeyPerm) bool) bool {
+	for _, spec := range cmd.Keys {
+		first := spec.First
+		if spec.Keyword != "" {
+			first = -1
+			for i := spec.First; i < len(args); i++ {
+				if strings.EqualFold(*args[i].Bulk, spec.Keyword) {
+					first = i + 1
+					break
+				}
+			}
+			if first < 0 {
+				continue
+			}
+		}
+
+		last := spec.Last
+		if last < 0 {
+			last += len(args)
+		}
+		if spec.Limit > 1 {
+			last = first + (last-first+1)/spec.Limit - 1
+		}
+		step := max(spec.Step, 1)
+
+		for i := first; i <= last && i < len(args); i += step {
+			if !fn(*args[i].Bulk, spec.Perm) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// channels calls fn for every channel or pattern in args, stopping if fn returns false.
+func (cmd *Command) channels(args []resp.Value, fn func(channel string, pattern bool) bool) bool {
+	spec := cmd.Channels
+	if spec == nil {
+		return true
+	}
+
+	last := spec.Last
+	if last < 0 {
+		last += len(args)
+	}
+	for i := spec.First; i <= last && i < len(args); i++ {
+		if !fn(*args[i].Bulk, spec.Pattern) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reredis/pkg/utils"
+	"strings"
+)
+
+var ErrNoACLFile = errors.New("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+
+// LoadFile replaces every user with the ones in an ACL file, which has a line per user:
+//
+//	user <name> <rule> [rule ...]
+//
+// Blank lines and lines starting with # are skipped. Nothing changes unless the whole
+// file is valid. If it doesn't have the default user, it's added as it is without any
+// configuration.
+func (acl *ACL) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	users := map[string]*User{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fail := func(err error) error {
+			return fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] != "user" || len(fields) < 2 {
+			return fail(errors.New("should start with user keyword"))
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return fail(fmt.Errorf("duplicate user '%s' found", name))
+		}
+
+		rules, err := joinSelectors(fields[2:])
+		if err != nil {
+			return fail(err)
+		}
+		user := newUser(name)
+		for _, rule := range rules {
+			if err := user.apply(rule, acl.commands); err != nil {
+				return fail(&RuleError{Rule: rule, Err: err})
+			}
+		}
+		users[name] = user
+	}
+
+	if _, ok := users[DEFAULT_USER]; !ok {
+		users[DEFAULT_USER] = acl.defaultUser()
+	}
+
+	acl.mutex.Lock()
+	acl.users = users
+	acl.mutex.Unlock()
+	return nil
+}
+
+// SaveFile writes every user to an ACL file, replacing it atomically.
+func (acl *ACL) SaveFile(path string) error {
+	data := strings.Join(acl.List(), "\n") + "\n"
+	return utils.WriteFileAtomic(path, []byte(data), 0600)
+}
@@ -0,0 +1,86 @@
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+// LOG_ENTRY_GROUP_TIME is how long a denial keeps counting repeats of itself, rather
+// than a new entry being logged.
+const LOG_ENTRY_GROUP_TIME = time.Minute
+
+// LogEntry is a denied command or failed authentication, as ACL LOG reports it.
+type LogEntry struct {
+	ID         int64
+	Count      int64
+	Reason     string //"command", "key", "channel" or "auth"
+	Context    string //"toplevel" or "multi"
+	Object     string //the command, key or channel that was denied
+	Username   string
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Log remembers the latest denials, newest first.
+type Log struct {
+	mutex   sync.Mutex
+	entries []*LogEntry
+	nextID  int64
+}
+
+// REASONS name the denial reasons in the log.
+var REASONS = map[int]string{
+	DENIED_CMD:     "command",
+	DENIED_KEY:     "key",
+	DENIED_AUTH:    "auth",
+	DENIED_CHANNEL: "channel",
+}
+
+// Add logs a denial, or counts it against an entry for the same denial if there's a
+// recent one. The log is trimmed to maxLen entries.
+func (log *Log) Add(entry LogEntry, maxLen int) {
+	now := time.Now()
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	for _, e := range log.entries {
+		if e.Reason == entry.Reason && e.Context == entry.Context && e.Object == entry.Object &&
+			e.Username == entry.Username && now.Sub(e.Updated) < LOG_ENTRY_GROUP_TIME {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = entry.ClientInfo
+			return
+		}
+	}
+
+	entry.ID = log.nextID
+	log.nextID++
+	entry.Count = 1
+	entry.Created, entry.Updated = now, now
+	log.entries = append([]*LogEntry{&entry}, log.entries...)
+	if len(log.entries) > maxLen {
+		log.entries = log.entries[:maxLen]
+	}
+}
+
+// Entries returns copies of the latest count entries, newest first.
+func (log *Log) Entries(count int) []LogEntry {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	count = min(count, len(log.entries))
+	res := make([]LogEntry, count)
+	for i := range res {
+		res[i] = *log.entries[i]
+	}
+	return res
+}
+
+// Reset empties the log.
+func (log *Log) Reset() {
+	log.mutex.Lock()
+	log.entries = nil
+	log.mutex.Unlock()
+}
@@ -0,0 +1,333 @@
+package acl
+
+import (
+	"errors"
+	"reredis/pkg/resp"
+	"reredis/pkg/utils"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrSyntax          = errors.New("Syntax error")
+	ErrUnknownCommand  = errors.New("Unknown command or category name in ACL")
+	ErrKeyAfterAll     = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	ErrChannelAfterAll = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+)
+
+// Reasons a command can be denied, in increasing order of how specific they are. When
+// no selector allows a command, the most specific reason any of them gave is reported.
+const (
+	ALLOWED = iota
+	DENIED_CMD
+	DENIED_KEY
+	DENIED_AUTH
+	DENIED_CHANNEL
+)
+
+type keyPattern struct {
+	perm    KeyPerm
+	pattern string
+}
+
+// Selector is a set of permissions: the commands that may be run, and the keys and
+// channels they may use. A command is allowed if one of the user's selectors allows the
+// command along with all of its keys and channels.
+type Selector struct {
+	allCommands  bool            //the rules start from +@all rather than -@all
+	commandRules []string        //command rules since then, in the order given
+	commands     map[string]bool //"cmd" or "cmd|sub", a subcommand's entry overrides its command's
+	allKeys      bool
+	keys         []keyPattern
+	allChannels  bool
+	channels     []string
+}
+
+func newSelector() *Selector {
+	return &Selector{commands: map[string]bool{}}
+}
+
+func (sel *Selector) clone() *Selector {
+	clone := *sel
+	clone.commandRules = slices.Clone(sel.commandRules)
+	clone.commands = make(map[string]bool, len(sel.commands))
+	for name, allowed := range sel.commands {
+		clone.commands[name] = allowed
+	}
+	clone.keys = slices.Clone(sel.keys)
+	clone.channels = slices.Clone(sel.channels)
+	return &clone
+}
+
+// apply applies a single rule about commands, keys or channels.
+func (sel *Selector) apply(rule string, commands map[string]*Command) error {
+	lower := strings.ToLower(rule)
+	switch {
+	case lower == "allkeys" || rule == "~*":
+		sel.allKeys = true
+		sel.keys = []keyPattern{{perm: KEY_RW, pattern: "*"}}
+	case lower == "resetkeys":
+		sel.allKeys = false
+		sel.keys = nil
+	case rule[0] == '~' || rule[0] == '%':
+		return sel.addKeyPattern(rule)
+	case lower == "allchannels" || rule == "&*":
+		sel.allChannels = true
+		sel.channels = []string{"*"}
+	case lower == "resetchannels":
+		sel.allChannels = false
+		sel.channels = nil
+	case rule[0] == '&':
+		if sel.allChannels {
+			return ErrChannelAfterAll
+		}
+		if !slices.Contains(sel.channels, rule[1:]) {
+			sel.channels = append(sel.channels, rule[1:])
+		}
+	case lower == "allcommands" || lower == "+@all":
+		sel.resetCommands(true, commands)
+	case lower == "nocommands" || lower == "-@all":
+		sel.resetCommands(false, commands)
+	case rule[0] == '+' || rule[0] == '-':
+		return sel.applyCommandRule(lower, commands)
+	default:
+		return ErrSyntax
+	}
+	return nil
+}
+
+// addKeyPattern adds ~pattern, which allows reading and writing matching keys, or
+// %R~pattern, %W~pattern and %RW~pattern which only allow what they say.
+func (sel *Selector) addKeyPattern(rule string) error {
+	perm, pattern := KEY_RW, rule[1:]
+	if rule[0] == '%' {
+		perms, rest, ok := strings.Cut(rule[1:], "~")
+		if !ok || perms == "" {
+			return ErrSyntax
+		}
+		perm = 0
+		for _, c := range strings.ToUpper(perms) {
+			switch c {
+			case 'R':
+				perm |= KEY_READ
+			case 'W':
+				perm |= KEY_WRITE
+			default:
+				return ErrSyntax
+			}
+		}
+		pattern = rest
+	}
+
+	if sel.allKeys {
+		return ErrKeyAfterAll
+	}
+	if pattern == "*" && perm == KEY_RW {
+		sel.allKeys = true
+		sel.keys = []keyPattern{{perm: KEY_RW, pattern: "*"}}
+		return nil
+	}
+	for i := range sel.keys {
+		if sel.keys[i].pattern == pattern {
+			sel.keys[i].perm |= perm
+			return nil
+		}
+	}
+	sel.keys = append(sel.keys, keyPattern{perm: perm, pattern: pattern})
+	return nil
+}
+
+// resetCommands allows every command, or none.
+func (sel *Selector) resetCommands(all bool, commands map[string]*Command) {
+	sel.allCommands = all
+	sel.commandRules = nil
+	sel.commands = map[string]bool{}
+	if all {
+		for name := range commands {
+			sel.commands[name] = true
+		}
+	}
+}
+
+// applyCommandRule applies +command, -command, +command|subcommand, -command|subcommand,
+// +@category or -@category.
+func (sel *Selector) applyCommandRule(rule string, commands map[string]*Command) error {
+	allow, name := rule[0] == '+', rule[1:]
+
+	if category, ok := strings.CutPrefix(name, "@"); ok {
+		if !slices.Contains(CATEGORIES, category) {
+			return ErrUnknownCommand
+		}
+		for _, cmd := range commands {
+			if cmd.Subcommands == nil {
+				if cmd.inCategory(category) {
+					sel.setCommand(cmd, allow)
+				}
+				continue
+			}
+			for _, sub := range cmd.Subcommands {
+				if sub.inCategory(category) {
+					sel.commands[sub.Name] = allow
+				}
+			}
+		}
+		sel.commandRules = append(sel.commandRules, rule)
+		return nil
+	}
+
+	container, subName, isSub := strings.Cut(name, "|")
+	cmd, ok := commands[container]
+	if !ok {
+		return ErrUnknownCommand
+	}
+	if isSub {
+		sub, ok := cmd.Subcommands[subName]
+		if !ok {
+			return ErrUnknownCommand
+		}
+		sel.commands[sub.Name] = allow
+	} else {
+		sel.setCommand(cmd, allow)
+	}
+
+	//an earlier rule for the same command has no effect anymore, so it's dropped to keep
+	//the rules short
+	sel.commandRules = slices.DeleteFunc(sel.commandRules, func(r string) bool {
+		return r[1:] == name || (!isSub && strings.HasPrefix(r[1:], name+"|"))
+	})
+	sel.commandRules = append(sel.commandRules, rule)
+	return nil
+}
+
+// setCommand allows or denies a command, along with all of its subcommands.
+func (sel *Selector) setCommand(cmd *Command, allow bool) {
+	sel.commands[cmd.Name] = allow
+	for _, sub := range cmd.Subcommands {
+		delete(sel.commands, sub.Name)
+	}
+}
+
+// allowsCommand tells whether the selector allows the command, which for a subcommand
+// is up to the container's rules unless there's one for the subcommand itself.
+func (sel *Selector) allowsCommand(cmd *Command) bool {
+	if allowed, ok := sel.commands[cmd.Name]; ok {
+		return allowed
+	}
+	if container, _, ok := strings.Cut(cmd.Name, "|"); ok {
+		return sel.commands[container]
+	}
+	return false
+}
+
+// allowsKey tells whether the selector gives the access perm to key.
+func (sel *Selector) allowsKey(key string, perm KeyPerm) bool {
+	if sel.allKeys {
+		return true
+	}
+	for _, p := range sel.keys {
+		if p.perm&perm == perm && utils.GlobMatch(p.pattern, key, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsChannel tells whether the selector allows a channel, or a pattern subscription,
+// which is only allowed if the very same pattern is.
+func (sel *Selector) allowsChannel(channel string, pattern bool) bool {
+	if sel.allChannels {
+		return true
+	}
+	for _, p := range sel.channels {
+		if (pattern && p == channel) || (!pattern && utils.GlobMatch(p, channel, false)) {
+			return true
+		}
+	}
+	return false
+}
+
+// check tells whether the selector allows running cmd with args, and if not why, along
+// with the key or channel that was denied.
+func (sel *Selector) check(cmd *Command, args []resp.Value) (int, string) {
+	if !sel.allowsCommand(cmd) {
+		return DENIED_CMD, ""
+	}
+
+	denied := ""
+	if !sel.allKeys {
+		ok := cmd.keys(args, func(key string, perm KeyPerm) bool {
+			if !sel.allowsKey(key, perm) {
+				denied = key
+				return false
+			}
+			return true
+		})
+		if !ok {
+			return DENIED_KEY, denied
+		}
+	}
+
+	if !sel.allChannels {
+		ok := cmd.channels(args, func(channel string, pattern bool) bool {
+			if !sel.allowsChannel(channel, pattern) {
+				denied = channel
+				return false
+			}
+			return true
+		})
+		if !ok {
+			return DENIED_CHANNEL, denied
+		}
+	}
+
+	return ALLOWED, ""
+}
+
+// Keys lists the key patterns as rules, "~*" for all keys.
+func (sel *Selector) Keys() string {
+	rules := []string{}
+	for _, p := range sel.keys {
+		switch p.perm {
+		case KEY_RW:
+			rules = append(rules, "~"+p.pattern)
+		case KEY_READ:
+			rules = append(rules, "%R~"+p.pattern)
+		case KEY_WRITE:
+			rules = append(rules, "%W~"+p.pattern)
+		}
+	}
+	return strings.Join(rules, " ")
+}
+
+// Channels lists the channel patterns as rules, "&*" for all channels.
+func (sel *Selector) Channels() string {
+	rules := []string{}
+	for _, p := range sel.channels {
+		rules = append(rules, "&"+p)
+	}
+	return strings.Join(rules, " ")
+}
+
+// Commands lists the command rules, starting from +@all or -@all.
+func (sel *Selector) Commands() string {
+	base := "-@all"
+	if sel.allCommands {
+		base = "+@all"
+	}
+	return strings.Join(append([]string{base}, sel.commandRules...), " ")
+}
+
+// describe lists the selector's rules, in a form that gives the same selector back.
+func (sel *Selector) describe() string {
+	rules := []string{}
+	if keys := sel.Keys(); keys != "" {
+		rules = append(rules, keys)
+	}
+	if channels := sel.Channels(); channels != "" {
+		rules = append(rules, channels)
+	} else {
+		rules = append(rules, "resetchannels")
+	}
+	rules = append(rules, sel.Commands())
+	return strings.Join(rules, " ")
+}
@@ -0,0 +1,200 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrBadHash         = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	ErrNoSuchPassword  = errors.New("The password you are trying to remove from the user does not exist")
+	ErrUnmatchedParens = errors.New("Unmatched parenthesis in acl selector")
+)
+
+// User is someone connections can authenticate as. Users are never modified once in use:
+// changing one swaps in a new User, so a command is checked against a consistent set of
+// permissions.
+type User struct {
+	Name      string
+	Enabled   bool
+	NoPass    bool     //any password works
+	Passwords []string //hex encoded SHA-256 hashes, redis' format
+	Root      *Selector
+	Selectors []*Selector
+}
+
+// newUser returns a user as ACL SETUSER creates it: disabled, without passwords and not
+// allowed to do anything.
+func newUser(name string) *User {
+	return &User{Name: name, Root: newSelector()}
+}
+
+func (user *User) clone() *User {
+	clone := *user
+	clone.Passwords = slices.Clone(user.Passwords)
+	clone.Root = user.Root.clone()
+	clone.Selectors = make([]*Selector, len(user.Selectors))
+	for i, sel := range user.Selectors {
+		clone.Selectors[i] = sel.clone()
+	}
+	return &clone
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPassword tells whether password is one of the user's. It compares hashes in
+// constant time, so neither the password nor its length leak through timing.
+func (user *User) CheckPassword(password string) bool {
+	if user.NoPass {
+		return true
+	}
+
+	hash := hashPassword(password)
+	ok := 0
+	for _, stored := range user.Passwords {
+		ok |= subtle.ConstantTimeCompare([]byte(hash), []byte(stored))
+	}
+	return ok == 1
+}
+
+// apply applies a single rule, like the arguments to ACL SETUSER.
+func (user *User) apply(rule string, commands map[string]*Command) error {
+	if rule == "" {
+		return ErrSyntax
+	}
+
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		user.Enabled = true
+	case lower == "off":
+		user.Enabled = false
+	case lower == "nopass":
+		user.NoPass = true
+		user.Passwords = nil
+	case lower == "resetpass":
+		user.NoPass = false
+		user.Passwords = nil
+	case rule[0] == '>':
+		user.addPassword(hashPassword(rule[1:]))
+	case rule[0] == '#':
+		if !validHash(rule[1:]) {
+			return ErrBadHash
+		}
+		user.addPassword(rule[1:])
+	case rule[0] == '<':
+		return user.removePassword(hashPassword(rule[1:]))
+	case rule[0] == '!':
+		if !validHash(rule[1:]) {
+			return ErrBadHash
+		}
+		return user.removePassword(rule[1:])
+	case rule[0] == '(':
+		if rule[len(rule)-1] != ')' {
+			return ErrUnmatchedParens
+		}
+		sel := newSelector()
+		for _, r := range strings.Fields(rule[1 : len(rule)-1]) {
+			if err := sel.apply(r, commands); err != nil {
+				return err
+			}
+		}
+		user.Selectors = append(user.Selectors, sel)
+	case lower == "clearselectors":
+		user.Selectors = nil
+	case lower == "reset":
+		user.Enabled = false
+		user.NoPass = false
+		user.Passwords = nil
+		user.Root = newSelector()
+		user.Selectors = nil
+	case lower == "sanitize-payload" || lower == "skip-sanitize-payload":
+		//RESTORE payloads are always checked, accepted so redis ACL files load
+	default:
+		return user.Root.apply(rule, commands)
+	}
+	return nil
+}
+
+func (user *User) addPassword(hash string) {
+	user.NoPass = false
+	if !slices.Contains(user.Passwords, hash) {
+		user.Passwords = append(user.Passwords, hash)
+	}
+}
+
+func (user *User) removePassword(hash string) error {
+	i := slices.Index(user.Passwords, hash)
+	if i < 0 {
+		return ErrNoSuchPassword
+	}
+	user.Passwords = slices.Delete(user.Passwords, i, i+1)
+	return nil
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if !(hash[i] >= '0' && hash[i] <= '9') && !(hash[i] >= 'a' && hash[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Flags lists the user's flags, as ACL GETUSER reports them.
+func (user *User) Flags() []string {
+	flags := []string{"off"}
+	if user.Enabled {
+		flags[0] = "on"
+	}
+	if user.NoPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Describe lists the user's rules, in a form that gives the same user back when applied
+// to a new one. It's what ACL LIST shows and ACL SAVE writes.
+func (user *User) Describe() string {
+	rules := user.Flags()
+	for _, hash := range user.Passwords {
+		rules = append(rules, "#"+hash)
+	}
+	rules = append(rules, user.Root.describe())
+	for _, sel := range user.Selectors {
+		rules = append(rules, "("+sel.describe()+")")
+	}
+	return strings.Join(rules, " ")
+}
+
+// joinSelectors merges rules that were split on spaces back into whole selectors, so a
+// selector can be given as one argument, "(~key +get)", or several, "(~key" "+get)".
+func joinSelectors(rules []string) ([]string, error) {
+	res := []string{}
+	for i := 0; i < len(rules); i++ {
+		rule := rules[i]
+		if !strings.HasPrefix(rule, "(") || strings.HasSuffix(rule, ")") {
+			res = append(res, rule)
+			continue
+		}
+
+		parts := []string{rule}
+		for i++; i < len(rules) && !strings.HasSuffix(rules[i], ")"); i++ {
+			parts = append(parts, rules[i])
+		}
+		if i == len(rules) {
+			return nil, ErrUnmatchedParens
+		}
+		res = append(res, strings.Join(append(parts, rules[i]), " "))
+	}
+	return res, nil
+}
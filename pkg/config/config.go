@@ -0,0 +1,529 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reredis/pkg/resp"
+	"reredis/pkg/store"
+	"reredis/pkg/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the server's configuration: the store's tunables plus the server's own.
+type Config struct {
+	store.Config
+	Bind            []string      //addresses to listen on, every interface if empty
+	Port            int           //TCP port, 0 to not listen on TCP
+	TLSPort         int           //TLS port, 0 to not listen on TLS
+	TLSCertFile     string        //server certificate, PEM encoded
+	TLSKeyFile      string        //its private key, PEM encoded
+	TLSCACertFile   string        //CAs client certificates are checked against
+	TLSCACertDir    string        //directory of more of those
+	TLSAuthClients  string        //yes, optional or no, see TLS_AUTH_CLIENTS
+	TLSProtocols    string        //see ParseTLSProtocols
+	TLSCiphers      string        //see ParseTLSCiphers
+	UnixSocket      string        //path of a unix socket to listen on, if any
+	UnixSocketPerm  os.FileMode   //permissions of the socket, 0 to leave them to the umask
+	Dir             string        //working directory
+	ProtoMaxBulkLen int           //longest bulk string accepted in requests
+	ShutdownTimeout time.Duration //how long shutting down waits for in-flight commands
+	RequirePass     string        //password of the default user, none if empty
+	ACLFile         string        //where users are loaded from and saved to, if anywhere
+	ACLLogMaxLen    int           //denials kept by ACL LOG
+	File            string        //absolute path of the config file that was loaded, if any
+}
+
+func Default() *Config {
+	return &Config{
+		Config:          store.DefaultConfig(),
+		Port:            6379,
+		Dir:             ".",
+		ProtoMaxBulkLen: resp.PROTO_MAX_BULK_LEN,
+		ShutdownTimeout: 10 * time.Second,
+		ACLLogMaxLen:    128,
+		TLSAuthClients:  "yes",
+	}
+}
+
+// Error is a directive that couldn't be applied, pointing at where it came from.
+type Error struct {
+	Source string //config file path, or "command line"
+	Line   int    //line in the config file, 0 for the command line
+	Text   string //the offending directive
+	Err    error
+}
+
+func (err *Error) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("%s, line %d: '%s': %v", err.Source, err.Line, err.Text, err.Err)
+	}
+	return fmt.Sprintf("%s: '%s': %v", err.Source, err.Text, err.Err)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+var (
+	ErrBadDirective = errors.New("Bad directive or wrong number of arguments")
+	ErrImmutable    = errors.New("can't set immutable config")
+	ErrDuplicate    = errors.New("duplicate parameter")
+)
+
+// param is a setting that can be read from a config file or the command line.
+type param struct {
+	name      string
+	immutable bool //only settable at startup
+	multi     bool //takes a list of arguments, given space separated to CONFIG SET
+	get       func(cfg *Config) string
+	set       func(cfg *Config, args []string) error
+}
+
+// params lists every setting, in the order they're reported.
+var params = []param{
+	{
+		name:  "bind",
+		multi: true,
+		get:   func(cfg *Config) string { return strings.Join(cfg.Bind, " ") },
+		set: func(cfg *Config, args []string) error {
+			for _, addr := range args {
+				if addr != "*" && net.ParseIP(addr) == nil {
+					return fmt.Errorf("Invalid bind address '%s'", addr)
+				}
+			}
+			cfg.Bind = slices.Clone(args)
+			return nil
+		},
+	},
+	intParam("port", false, func(cfg *Config) *int { return &cfg.Port }, 0, 65535),
+	intParam("tls-port", false, func(cfg *Config) *int { return &cfg.TLSPort }, 0, 65535),
+	stringParam("tls-cert-file", func(cfg *Config) *string { return &cfg.TLSCertFile }, nil),
+	stringParam("tls-key-file", func(cfg *Config) *string { return &cfg.TLSKeyFile }, nil),
+	stringParam("tls-ca-cert-file", func(cfg *Config) *string { return &cfg.TLSCACertFile }, nil),
+	stringParam("tls-ca-cert-dir", func(cfg *Config) *string { return &cfg.TLSCACertDir }, nil),
+	stringParam("tls-auth-clients", func(cfg *Config) *string { return &cfg.TLSAuthClients }, func(value string) (string, error) {
+		value = strings.ToLower(value)
+		if _, ok := TLS_AUTH_CLIENTS[value]; !ok {
+			return "", errors.New("argument must be 'yes', 'no' or 'optional'")
+		}
+		return value, nil
+	}),
+	stringParam("tls-protocols", func(cfg *Config) *string { return &cfg.TLSProtocols }, func(value string) (string, error) {
+		_, _, err := ParseTLSProtocols(value)
+		return value, err
+	}),
+	stringParam("tls-ciphers", func(cfg *Config) *string { return &cfg.TLSCiphers }, func(value string) (string, error) {
+		_, err := ParseTLSCiphers(value)
+		return value, err
+	}),
+	{
+		name:      "unixsocket",
+		immutable: true,
+		get:       func(cfg *Config) string { return cfg.UnixSocket },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			cfg.UnixSocket = args[0]
+			return nil
+		},
+	},
+	{
+		name:      "unixsocketperm",
+		immutable: true,
+		get:       func(cfg *Config) string { return strconv.FormatUint(uint64(cfg.UnixSocketPerm), 8) },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			perm, err := strconv.ParseUint(args[0], 8, 32)
+			if err != nil || perm > 0777 {
+				return errors.New("argument must be an octal number between 0 and 777")
+			}
+			cfg.UnixSocketPerm = os.FileMode(perm)
+			return nil
+		},
+	},
+	{
+		name:      "dir",
+		immutable: true,
+		get:       func(cfg *Config) string { return cfg.Dir },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			info, err := os.Stat(args[0])
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", args[0])
+			}
+			cfg.Dir = args[0]
+			return nil
+		},
+	},
+	intParam("databases", true, func(cfg *Config) *int { return &cfg.Databases }, 1, 1<<20),
+	{
+		name: "default-ttl",
+		get:  func(cfg *Config) string { return strconv.Itoa(int(cfg.DefaultTTL / time.Second)) },
+		set: func(cfg *Config, args []string) error {
+			secs, err := parseInt(args, 0, 1<<40)
+			if err != nil {
+				return err
+			}
+			cfg.DefaultTTL = time.Duration(secs) * time.Second
+			return nil
+		},
+	},
+	intParam("keyspace-initial-size", false, func(cfg *Config) *int { return &cfg.InitialMapSize }, 16, 1<<30),
+	intParam("hz", false, func(cfg *Config) *int { return &cfg.Hz }, 1, 500),
+	{
+		name: "maxmemory",
+		get:  func(cfg *Config) string { return strconv.FormatInt(cfg.MaxMemory, 10) },
+		set: func(cfg *Config, args []string) error {
+			bytes, err := parseMemory(args)
+			if err != nil {
+				return err
+			}
+			cfg.MaxMemory = bytes
+			return nil
+		},
+	},
+	{
+		name: "maxmemory-policy",
+		get:  func(cfg *Config) string { return cfg.MaxMemoryPolicy },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			policy := strings.ToLower(args[0])
+			if !slices.Contains(store.MAXMEMORY_POLICIES, policy) {
+				return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(store.MAXMEMORY_POLICIES, ", "))
+			}
+			cfg.MaxMemoryPolicy = policy
+			return nil
+		},
+	},
+	intParam("maxmemory-samples", false, func(cfg *Config) *int { return &cfg.MaxMemorySamples }, 1, 64),
+	{
+		name: "notify-keyspace-events",
+		get:  func(cfg *Config) string { return store.NotifyFlagsString(cfg.NotifyFlags) },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			flags, err := store.ParseNotifyFlags(args[0])
+			if err != nil {
+				return errors.New("Invalid event class character. Use 'Ag$lshzxetnKE'.")
+			}
+			cfg.NotifyFlags = flags
+			return nil
+		},
+	},
+	{
+		name: "proto-max-bulk-len",
+		get:  func(cfg *Config) string { return strconv.Itoa(cfg.ProtoMaxBulkLen) },
+		set: func(cfg *Config, args []string) error {
+			bytes, err := parseMemory(args)
+			if err != nil {
+				return err
+			}
+			if bytes < 1024*1024 {
+				return errors.New("argument must be a memory value of at least 1mb")
+			}
+			cfg.ProtoMaxBulkLen = int(bytes)
+			return nil
+		},
+	},
+	{
+		name: "requirepass",
+		get:  func(cfg *Config) string { return cfg.RequirePass },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			cfg.RequirePass = args[0]
+			return nil
+		},
+	},
+	{
+		name:      "aclfile",
+		immutable: true,
+		get:       func(cfg *Config) string { return cfg.ACLFile },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			cfg.ACLFile = args[0]
+			return nil
+		},
+	},
+	intParam("acllog-max-len", false, func(cfg *Config) *int { return &cfg.ACLLogMaxLen }, 0, 1<<20),
+	{
+		name: "shutdown-timeout",
+		get:  func(cfg *Config) string { return strconv.Itoa(int(cfg.ShutdownTimeout / time.Second)) },
+		set: func(cfg *Config, args []string) error {
+			secs, err := parseInt(args, 0, 1<<20)
+			if err != nil {
+				return err
+			}
+			cfg.ShutdownTimeout = time.Duration(secs) * time.Second
+			return nil
+		},
+	},
+}
+
+func intParam(name string, immutable bool, field func(cfg *Config) *int, min int, max int) param {
+	return param{
+		name:      name,
+		immutable: immutable,
+		get:       func(cfg *Config) string { return strconv.Itoa(*field(cfg)) },
+		set: func(cfg *Config, args []string) error {
+			n, err := parseInt(args, min, max)
+			if err != nil {
+				return err
+			}
+			*field(cfg) = n
+			return nil
+		},
+	}
+}
+
+// stringParam is a setting taking a single string, which check can validate and
+// normalize if it's not nil.
+func stringParam(name string, field func(cfg *Config) *string, check func(value string) (string, error)) param {
+	return param{
+		name: name,
+		get:  func(cfg *Config) string { return *field(cfg) },
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return ErrBadDirective
+			}
+			value := args[0]
+			if check != nil {
+				var err error
+				if value, err = check(value); err != nil {
+					return err
+				}
+			}
+			*field(cfg) = value
+			return nil
+		},
+	}
+}
+
+func parseInt(args []string, min int, max int) (int, error) {
+	if len(args) != 1 {
+		return 0, ErrBadDirective
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, errors.New("argument couldn't be parsed into an integer")
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+	}
+	return n, nil
+}
+
+func parseMemory(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, ErrBadDirective
+	}
+	bytes, err := utils.ParseMemory(args[0])
+	if err != nil {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return bytes, nil
+}
+
+func lookup(name string) *param {
+	name = strings.ToLower(name)
+	for i := range params {
+		if params[i].name == name {
+			return &params[i]
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of cfg that can be changed without affecting it.
+func (cfg *Config) Clone() *Config {
+	clone := *cfg
+	clone.Bind = slices.Clone(cfg.Bind)
+	return &clone
+}
+
+// Set applies a single directive, like a config file line split into its name and arguments.
+func (cfg *Config) Set(name string, args []string) error {
+	p := lookup(name)
+	if p == nil || len(args) == 0 {
+		return ErrBadDirective
+	}
+	return p.set(cfg, args)
+}
+
+// Get returns the current value of a setting, formatted like a config file would have it.
+func (cfg *Config) Get(name string) (string, bool) {
+	p := lookup(name)
+	if p == nil {
+		return "", false
+	}
+	return p.get(cfg), true
+}
+
+// Match returns the settings whose names match a glob pattern, as name, value pairs in
+// the order they're listed in.
+func (cfg *Config) Match(pattern string) [][2]string {
+	res := [][2]string{}
+	for _, p := range params {
+		if utils.GlobMatch(pattern, p.name, true) {
+			res = append(res, [2]string{p.name, p.get(cfg)})
+		}
+	}
+	return res
+}
+
+// Update returns a copy of cfg with the name, value pairs applied, as given to CONFIG SET.
+// Either every value is valid and they're all applied, or cfg is left as it was and the
+// error points at the first one that isn't.
+func (cfg *Config) Update(pairs [][2]string) (*Config, error) {
+	updated := cfg.Clone()
+	seen := map[string]bool{}
+
+	for _, pair := range pairs {
+		name, value := strings.ToLower(pair[0]), pair[1]
+		fail := func(err error) error {
+			return &Error{Source: "CONFIG SET", Text: name, Err: err}
+		}
+
+		p := lookup(name)
+		if p == nil {
+			return nil, fail(ErrBadDirective)
+		}
+		if p.immutable {
+			return nil, fail(ErrImmutable)
+		}
+		if seen[name] {
+			return nil, fail(ErrDuplicate)
+		}
+		seen[name] = true
+
+		args := []string{value}
+		if p.multi {
+			args = strings.Fields(value)
+		}
+		if err := p.set(updated, args); err != nil {
+			return nil, fail(err)
+		}
+	}
+
+	return updated, nil
+}
+
+// FromArgs builds the configuration from the command line, which like redis-server's is an
+// optional config file followed by overrides of the form --name value [value ...]:
+//
+//	reredis /etc/reredis.conf --port 6380 --maxmemory 100mb
+func FromArgs(args []string) (*Config, error) {
+	cfg := Default()
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		if err := cfg.LoadFile(args[0]); err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+
+	for len(args) > 0 {
+		if !strings.HasPrefix(args[0], "--") || len(args[0]) == 2 {
+			return nil, &Error{Source: "command line", Text: args[0], Err: errors.New("expected an option starting with '--'")}
+		}
+
+		end := 1
+		for end < len(args) && !strings.HasPrefix(args[end], "--") {
+			end++
+		}
+
+		name, values := args[0][2:], args[1:end]
+		if err := cfg.Set(name, values); err != nil {
+			text := strings.Join(args[:end], " ")
+			return nil, &Error{Source: "command line", Text: text, Err: err}
+		}
+		args = args[end:]
+	}
+
+	return cfg, nil
+}
+
+// LoadFile applies every directive in a redis.conf style file: one directive per line,
+// arguments split with redis' quoting rules and # starting a comment line.
+func (cfg *Config) LoadFile(path string) error {
+	return cfg.loadFile(path, nil)
+}
+
+// loadFile is LoadFile for a file included by the files in including, outermost first,
+// which it mustn't include again.
+func (cfg *Config) loadFile(path string, including []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	including = append(including, abs)
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("can't open config file: %w", err)
+	}
+	if cfg.File == "" {
+		cfg.File = abs
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fail := func(err error) error {
+			return &Error{Source: abs, Line: i + 1, Text: line, Err: err}
+		}
+
+		args, ok := utils.SplitArgs(line)
+		if !ok {
+			return fail(errors.New("Unbalanced quotes in configuration line"))
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if strings.ToLower(args[0]) == "include" {
+			if len(args) != 2 {
+				return fail(ErrBadDirective)
+			}
+			target, err := filepath.Abs(args[1])
+			if err != nil {
+				return fail(err)
+			}
+			if slices.Contains(including, target) {
+				return fail(fmt.Errorf("Include cycle: '%s' is already being loaded", target))
+			}
+			if err := cfg.loadFile(target, including); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := cfg.Set(args[0], args[1:]); err != nil {
+			return fail(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reredis/pkg/utils"
+	"strings"
+)
+
+// REWRITE_SIGNATURE marks where CONFIG REWRITE appends settings that weren't in the file.
+const REWRITE_SIGNATURE = "# Generated by CONFIG REWRITE"
+
+var ErrNoConfigFile = errors.New("The server is running without a config file")
+
+// Rewrite updates the config file the server was started with to the settings in cfg.
+// Comments, blank lines and unknown directives are kept as they are, each setting in the
+// file is rewritten in place with its current value (dropping repeats), and settings that
+// differ from their defaults but weren't in the file are appended at the end. The file is
+// replaced atomically, so it's never left half written.
+func (cfg *Config) Rewrite() error {
+	if cfg.File == "" {
+		return ErrNoConfigFile
+	}
+
+	var lines []string
+	mode := fs.FileMode(0644)
+	data, err := os.ReadFile(cfg.File)
+	switch {
+	case err == nil:
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if info, err := os.Stat(cfg.File); err == nil {
+			mode = info.Mode().Perm()
+		}
+	case !errors.Is(err, fs.ErrNotExist): //a missing file is created from scratch
+		return err
+	}
+
+	out := []string{}
+	written := map[string]bool{}
+	signed := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == REWRITE_SIGNATURE {
+			signed = true
+		}
+		args, ok := utils.SplitArgs(trimmed)
+		if trimmed == "" || trimmed[0] == '#' || !ok || len(args) == 0 {
+			out = append(out, line)
+			continue
+		}
+
+		p := lookup(args[0])
+		if p == nil { //includes and anything we don't know about
+			out = append(out, line)
+			continue
+		}
+		if !written[p.name] {
+			if line, ok := p.line(cfg); ok {
+				out = append(out, line)
+			}
+			written[p.name] = true
+		}
+	}
+
+	defaults := Default()
+	for _, p := range params {
+		if written[p.name] || p.get(cfg) == p.get(defaults) {
+			continue
+		}
+		line, ok := p.line(cfg)
+		if !ok {
+			continue
+		}
+		if !signed {
+			out = append(out, REWRITE_SIGNATURE)
+			signed = true
+		}
+		out = append(out, line)
+	}
+
+	return utils.WriteFileAtomic(cfg.File, []byte(strings.Join(out, "\n")+"\n"), mode)
+}
+
+// line formats the setting as a config file directive. A list setting with nothing in it
+// has no directive, as one without arguments wouldn't load, and leaving it out gives the
+// same empty list back.
+func (p *param) line(cfg *Config) (string, bool) {
+	value := p.get(cfg)
+	args := []string{value}
+	if p.multi {
+		args = strings.Fields(value)
+		if len(args) == 0 {
+			return "", false
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(p.name)
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		sb.WriteString(quoteArg(arg))
+	}
+	return sb.String(), true
+}
+
+// quoteArg quotes an argument if it wouldn't read back as itself otherwise, using the
+// escapes utils.SplitArgs understands.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"'\\") && isPrintable(arg) {
+		return arg
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; {
+		case c == '\\' || c == '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\r':
+			sb.WriteString(`\r`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
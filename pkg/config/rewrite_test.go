@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rewriteAndLoad updates the settings loaded from a file holding contents, rewrites the
+// file and loads it back.
+func rewriteAndLoad(t *testing.T, contents string, pairs [][2]string) (*Config, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "reredis.conf")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := cfg.Update(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := Default()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("rewritten file doesn't load: %v\n%s", err, data)
+	}
+	return loaded, string(data)
+}
+
+func TestRewriteEmptyBind(t *testing.T) {
+	loaded, data := rewriteAndLoad(t, "# comment\nbind 127.0.0.1 ::1\nport 7000\n", [][2]string{{"bind", ""}})
+	if len(loaded.Bind) != 0 {
+		t.Errorf("bind loaded back as %q, want nothing", loaded.Bind)
+	}
+	if loaded.Port != 7000 {
+		t.Errorf("port loaded back as %d, want 7000", loaded.Port)
+	}
+	if strings.Contains(data, "bind") {
+		t.Errorf("rewritten file still has a bind directive:\n%s", data)
+	}
+}
+
+func TestRewriteRoundTrip(t *testing.T) {
+	loaded, data := rewriteAndLoad(t, "port 7000\n", [][2]string{
+		{"bind", "127.0.0.1 ::1"},
+		{"requirepass", "with space \"and\" quotes\n"},
+	})
+	if want := []string{"127.0.0.1", "::1"}; !slices.Equal(loaded.Bind, want) {
+		t.Errorf("bind loaded back as %q, want %q", loaded.Bind, want)
+	}
+	if want := "with space \"and\" quotes\n"; loaded.RequirePass != want {
+		t.Errorf("requirepass loaded back as %q, want %q", loaded.RequirePass, want)
+	}
+	if !strings.Contains(data, REWRITE_SIGNATURE) {
+		t.Errorf("appended settings aren't marked:\n%s", data)
+	}
+}
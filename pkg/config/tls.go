@@ -0,0 +1,65 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLS_PROTOCOLS are the protocol versions tls-protocols can enable, by their redis names.
+var TLS_PROTOCOLS = map[string]uint16{
+	"tlsv1":   tls.VersionTLS10,
+	"tlsv1.1": tls.VersionTLS11,
+	"tlsv1.2": tls.VersionTLS12,
+	"tlsv1.3": tls.VersionTLS13,
+}
+
+// TLS_AUTH_CLIENTS are the values of tls-auth-clients: whether clients must present a
+// certificate signed by the CA, may present one, or aren't asked for one.
+var TLS_AUTH_CLIENTS = map[string]tls.ClientAuthType{
+	"yes":      tls.RequireAndVerifyClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"no":       tls.NoClientCert,
+}
+
+// ParseTLSProtocols parses tls-protocols, a space separated list like "TLSv1.2 TLSv1.3",
+// into the range of versions it enables. An empty list leaves it to crypto/tls' defaults,
+// returning zeroes.
+func ParseTLSProtocols(protocols string) (uint16, uint16, error) {
+	var minVersion, maxVersion uint16
+	for _, name := range strings.Fields(protocols) {
+		version, ok := TLS_PROTOCOLS[strings.ToLower(name)]
+		if !ok {
+			return 0, 0, fmt.Errorf("Unknown TLS protocol '%s'", name)
+		}
+		if minVersion == 0 || version < minVersion {
+			minVersion = version
+		}
+		maxVersion = max(maxVersion, version)
+	}
+	return minVersion, maxVersion, nil
+}
+
+// ParseTLSCiphers parses tls-ciphers, a list of TLS 1.2 cipher suites by their IANA names,
+// like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, separated by colons. An empty list leaves
+// it to crypto/tls' defaults, returning nil. TLS 1.3 suites can't be configured.
+func ParseTLSCiphers(ciphers string) ([]uint16, error) {
+	if ciphers == "" {
+		return nil, nil
+	}
+
+	suites := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+
+	ids := []uint16{}
+	for _, name := range strings.Split(ciphers, ":") {
+		id, ok := suites[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("Unknown TLS cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"reredis/pkg/acl"
+	"reredis/pkg/resp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ACL_LOG_DEFAULT_COUNT is how many entries ACL LOG shows without a count.
+const ACL_LOG_DEFAULT_COUNT = 10
+
+// ACLCmd manages users and reports on what they're allowed to do.
+//
+//	ACL SETUSER username [rule [rule ...]]
+//	ACL GETUSER username
+//	ACL DELUSER username [username ...]
+//	ACL LIST
+//	ACL USERS
+//	ACL WHOAMI
+//	ACL CAT [category]
+//	ACL DRYRUN username command [arg [arg ...]]
+//	ACL LOG [count | RESET]
+//	ACL SAVE
+//	ACL LOAD
+func (handler *Handler) ACLCmd(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'acl' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	sub := strings.ToUpper(*args[0].Bulk)
+	switch {
+	case sub == "SETUSER" && len(args) >= 2:
+		rules := make([]string, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			rules = append(rules, *arg.Bulk)
+		}
+		if err := handler.ACL.SetUser(*args[1].Bulk, rules); err != nil {
+			return aclError(err)
+		}
+		return okValue()
+	case sub == "GETUSER" && len(args) == 2:
+		user := handler.ACL.User(*args[1].Bulk)
+		if user == nil {
+			return resp.Value{Type: "null"}
+		}
+		return describeUser(user)
+	case sub == "DELUSER" && len(args) >= 2:
+		names := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			names = append(names, *arg.Bulk)
+		}
+		deleted, err := handler.ACL.DelUser(names)
+		if err != nil {
+			return aclError(err)
+		}
+		count := int64(deleted)
+		return resp.Value{Type: "integer", Number: &count}
+	case sub == "LIST" && len(args) == 1:
+		return bulkArray(handler.ACL.List())
+	case sub == "USERS" && len(args) == 1:
+		return bulkArray(handler.ACL.Users())
+	case sub == "WHOAMI" && len(args) == 1:
+		return bulkString(client.User)
+	case sub == "CAT" && len(args) <= 2:
+		if len(args) == 1 {
+			return bulkArray(acl.CATEGORIES)
+		}
+		names, ok := handler.ACL.CategoryCommands(strings.ToLower(*args[1].Bulk))
+		if !ok {
+			errStr := "Unknown category '" + *args[1].Bulk + "'"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		return bulkArray(names)
+	case sub == "DRYRUN" && len(args) >= 3:
+		return handler.aclDryRun(*args[1].Bulk, *args[2].Bulk, args[3:])
+	case sub == "LOG" && len(args) <= 2:
+		return handler.aclLog(args[1:])
+	case (sub == "SAVE" || sub == "LOAD") && len(args) == 1:
+		path := handler.Config().ACLFile
+		if path == "" {
+			return aclError(acl.ErrNoACLFile)
+		}
+		var err error
+		if sub == "SAVE" {
+			err = handler.ACL.SaveFile(path)
+		} else {
+			err = handler.ACL.LoadFile(path)
+		}
+		if err != nil {
+			return aclError(err)
+		}
+		return okValue()
+	default:
+		errStr := "unknown subcommand or wrong number of arguments for '" + *args[0].Bulk + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+}
+
+// aclDryRun tells whether a user could run a command, without running it.
+func (handler *Handler) aclDryRun(username string, command string, args []resp.Value) resp.Value {
+	user := handler.ACL.User(username)
+	if user == nil {
+		errStr := "User '" + username + "' not found"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	cmd, ok := handler.ACL.Command(command, args)
+	if !ok {
+		errStr := "Command '" + command + "' not found"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if NOAUTH_CMDS[strings.ToUpper(command)] {
+		return okValue()
+	}
+	reason, object := handler.ACL.Check(user, cmd, args)
+	if reason == acl.ALLOWED {
+		return okValue()
+	}
+	return bulkString(acl.DenialMessage(user, cmd, reason, object))
+}
+
+// aclLog lists the latest denials, or forgets them all with RESET.
+func (handler *Handler) aclLog(args []resp.Value) resp.Value {
+	count := ACL_LOG_DEFAULT_COUNT
+	if len(args) == 1 {
+		if strings.EqualFold(*args[0].Bulk, "RESET") {
+			handler.ACL.Log.Reset()
+			return okValue()
+		}
+		n, err := strconv.Atoi(*args[0].Bulk)
+		if err != nil || n < 0 {
+			errStr := "value is out of range, must be positive"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		count = n
+	}
+
+	now := time.Now()
+	res := []resp.Value{}
+	for _, entry := range handler.ACL.Log.Entries(count) {
+		age := now.Sub(entry.Created).Seconds()
+		res = append(res, resp.Value{
+			Type: "map",
+			Array: []resp.Value{
+				bulkString("count"), integerValue(entry.Count),
+				bulkString("reason"), bulkString(entry.Reason),
+				bulkString("context"), bulkString(entry.Context),
+				bulkString("object"), bulkString(entry.Object),
+				bulkString("username"), bulkString(entry.Username),
+				bulkString("age-seconds"), {Type: "double", Double: &age},
+				bulkString("client-info"), bulkString(entry.ClientInfo),
+				bulkString("entry-id"), integerValue(entry.ID),
+				bulkString("timestamp-created"), integerValue(entry.Created.UnixMilli()),
+				bulkString("timestamp-last-updated"), integerValue(entry.Updated.UnixMilli()),
+			},
+		})
+	}
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+// describeUser is ACL GETUSER's reply: the user's flags, password hashes and the rules of
+// its root permissions and selectors.
+func describeUser(user *acl.User) resp.Value {
+	selectors := []resp.Value{}
+	for _, sel := range user.Selectors {
+		selectors = append(selectors, describeSelector(sel))
+	}
+
+	root := describeSelector(user.Root)
+	return resp.Value{
+		Type: "map",
+		Array: append([]resp.Value{
+			bulkString("flags"), {Type: "set", Array: bulkArray(user.Flags()).Array},
+			bulkString("passwords"), bulkArray(user.Passwords),
+		}, append(root.Array,
+			bulkString("selectors"), resp.Value{Type: "array", Array: selectors},
+		)...),
+	}
+}
+
+func describeSelector(sel *acl.Selector) resp.Value {
+	return resp.Value{
+		Type: "map",
+		Array: []resp.Value{
+			bulkString("commands"), bulkString(sel.Commands()),
+			bulkString("keys"), bulkString(sel.Keys()),
+			bulkString("channels"), bulkString(sel.Channels()),
+		},
+	}
+}
+
+func aclError(err error) resp.Value {
+	errStr := err.Error()
+	return resp.Value{
+		Type:   "error",
+		String: &errStr,
+	}
+}
+
+func okValue() resp.Value {
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+func integerValue(n int64) resp.Value {
+	return resp.Value{Type: "integer", Number: &n}
+}
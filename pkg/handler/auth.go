@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"reredis/pkg/acl"
+	"reredis/pkg/resp"
+	"strings"
+)
+
+const WRONGPASS_ERR = "WRONGPASS invalid username-password pair or user is disabled."
+
+// NOAUTH_CMDS can be run before authenticating, and by any user.
+var NOAUTH_CMDS = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+}
+
+// NewClient creates the state of a new connection. It starts out as the default user, and
+// is authenticated from the start if that user needs no password.
+func (handler *Handler) NewClient() *Client {
+	client := NewClient()
+	client.User = acl.DEFAULT_USER
+	if user := handler.ACL.User(acl.DEFAULT_USER); user.Enabled && user.NoPass {
+		client.Authenticated = true
+	}
+	return client
+}
+
+// Auth authenticates the connection as a user, the default one if no username is given.
+//
+//	AUTH [username] password
+func (handler *Handler) Auth(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 2 {
+		errStr := "wrong number of arguments for 'auth' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	username, password := acl.DEFAULT_USER, *args[0].Bulk
+	if len(args) == 2 {
+		username, password = *args[0].Bulk, *args[1].Bulk
+	} else if handler.ACL.User(acl.DEFAULT_USER).NoPass {
+		errStr := "AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if !handler.authenticate(client, username, password) {
+		errStr := WRONGPASS_ERR
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+// authenticate switches the client to username if password is one of its passwords,
+// logging the failure in the ACL log otherwise.
+func (handler *Handler) authenticate(client *Client, username string, password string) bool {
+	if _, ok := handler.ACL.Authenticate(username, password); !ok {
+		handler.logDenial(client, acl.DENIED_AUTH, "AUTH", username)
+		return false
+	}
+
+	client.User = username
+	client.Authenticated = true
+	return true
+}
+
+// checkACL returns the error to reply with if the client's user may not run the command
+// with args, logging the denial, or nil if it may.
+func (handler *Handler) checkACL(client *Client, command string, args []resp.Value) *resp.Value {
+	if NOAUTH_CMDS[command] {
+		return nil
+	}
+
+	user := handler.ACL.User(client.User)
+	if user == nil { //deleted while the client was using it, like redis we drop the connection
+		client.Close()
+		errStr := "NOPERM User " + client.User + " was deleted"
+		return &resp.Value{Type: "error", String: &errStr}
+	}
+
+	cmd, ok := handler.ACL.Command(command, args)
+	if !ok { //NewHandler makes sure this can't happen, but if it does the command is denied
+		object := strings.ToLower(command)
+		errStr := "NOPERM User " + user.Name + " has no permissions to run the '" + object + "' command"
+		handler.logDenial(client, acl.DENIED_CMD, object, user.Name)
+		return &resp.Value{Type: "error", String: &errStr}
+	}
+
+	reason, object := handler.ACL.Check(user, cmd, args)
+	var errStr string
+	switch reason {
+	case acl.ALLOWED:
+		return nil
+	case acl.DENIED_KEY:
+		errStr = "NOPERM No permissions to access a key"
+	case acl.DENIED_CHANNEL:
+		errStr = "NOPERM No permissions to access a channel"
+	default:
+		object = cmd.Name
+		errStr = "NOPERM User " + user.Name + " has no permissions to run the '" + cmd.Name + "' command"
+	}
+
+	handler.logDenial(client, reason, object, user.Name)
+	return &resp.Value{Type: "error", String: &errStr}
+}
+
+// logDenial adds a denied command or failed authentication to the ACL log.
+func (handler *Handler) logDenial(client *Client, reason int, object string, username string) {
+	context := "toplevel"
+	if client.InMulti {
+		context = "multi"
+	}
+
+	handler.ACL.Log.Add(acl.LogEntry{
+		Reason:     acl.REASONS[reason],
+		Context:    context,
+		Object:     object,
+		Username:   username,
+		ClientInfo: fmt.Sprintf("id=%d name=%s db=%d user=%s", client.ID, client.Name, client.DB, client.User),
+	}, handler.Config().ACLLogMaxLen)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"reredis/pkg/resp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// CLIENT_OUT_BUFFER is how many replies and pushed messages can be queued for a client
+// before it's considered too slow and gets disconnected.
+const CLIENT_OUT_BUFFER = 1024
+
+// Output is a reply or pushed message queued for the connection's writer. Flush asks the
+// writer to send everything buffered so far, which happens once per batch of pipelined
+// commands rather than once per reply.
+type Output struct {
+	Value resp.Value
+	Flush bool
+	Proto int //protocol version the client spoke when this was queued
+}
+
+// nextClientID hands out connection ids, which like redis are never reused.
+var nextClientID atomic.Int64
+
+// Client holds the state of a single connection.
+type Client struct {
+	ID            int64
+	Name          string //set with HELLO SETNAME
+	DB            int    //index of the selected logical database
+	User          string //ACL user the connection is authenticated as
+	Authenticated bool
+	InMulti       bool
+	MultiQ        []MultiQCmd
+	InExec        bool            //running a queued transaction, where blocking commands don't block
+	Channels      map[string]bool //pub/sub channels the client is subscribed to
+	Patterns      map[string]bool //pub/sub patterns the client is subscribed to
+	Shards        map[string]bool //sharded pub/sub channels the client is subscribed to
+	Out           chan Output     //replies and pushed messages, drained by the connection's writer
+	Done          chan struct{}   //closed once the connection is going away
+	Gone          chan struct{}   //closed once the peer hung up, so blocked commands can give up
+	proto         atomic.Int32    //RESP version, read by whoever pushes messages to the client
+	doneOnce      sync.Once
+	goneOnce      sync.Once
+}
+
+func NewClient() *Client {
+	client := &Client{
+		ID:       nextClientID.Add(1),
+		DB:       0,
+		InMulti:  false,
+		MultiQ:   nil,
+		Channels: map[string]bool{},
+		Patterns: map[string]bool{},
+		Shards:   map[string]bool{},
+		Out:      make(chan Output, CLIENT_OUT_BUFFER),
+		Done:     make(chan struct{}),
+		Gone:     make(chan struct{}),
+	}
+	client.proto.Store(resp.RESP2)
+
+	return client
+}
+
+// Proto returns the protocol version the client negotiated with HELLO.
+func (client *Client) Proto() int {
+	return int(client.proto.Load())
+}
+
+// Reply queues the reply to a command, waiting for room if the writer is behind.
+// It's only sent once Flush is called.
+func (client *Client) Reply(v resp.Value) {
+	client.queue(Output{Value: v})
+}
+
+// Flush asks the writer to send the replies queued so far.
+func (client *Client) Flush() {
+	client.queue(Output{Flush: true})
+}
+
+func (client *Client) queue(out Output) {
+	out.Proto = client.Proto()
+	select {
+	case client.Out <- out:
+	case <-client.Done:
+	}
+}
+
+// Push queues a message the client didn't ask for, like a pub/sub message. It never blocks:
+// if the client can't keep up it gets disconnected instead, like redis' output buffer limits.
+// RESP3 clients get it as a push message, telling it apart from replies.
+func (client *Client) Push(v resp.Value) bool {
+	v.Type = "push"
+	select {
+	case <-client.Done:
+		return false
+	default:
+	}
+
+	select {
+	case client.Out <- Output{Value: v, Flush: true, Proto: client.Proto()}:
+		return true
+	default:
+		client.Close()
+		return false
+	}
+}
+
+// Close marks the connection as going away, stopping its writer.
+func (client *Client) Close() {
+	client.doneOnce.Do(func() {
+		close(client.Done)
+	})
+}
+
+// Hangup marks the peer as gone. Commands already read still run, but blocked ones give up.
+func (client *Client) Hangup() {
+	client.goneOnce.Do(func() {
+		close(client.Gone)
+	})
+}
+
+// Subscriptions returns how many channels and patterns the client is subscribed to.
+// A client with any subscriptions, sharded or not, is in subscriber mode.
+func (client *Client) Subscriptions() int {
+	return len(client.Channels) + len(client.Patterns)
+}
+
+func (client *Client) InSubscriberMode() bool {
+	return client.Subscriptions()+len(client.Shards) > 0
+}
+
+func (handler *Handler) Select(client *Client, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		errStr := "wrong number of arguments for 'select' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	idx, err := strconv.Atoi(*args[0].Bulk)
+	if err != nil {
+		errStr := "value is not an integer or out of range"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if _, ok := handler.Databases.Get(idx); !ok {
+		errStr := "DB index is out of range"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	client.DB = idx
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
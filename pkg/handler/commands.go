@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"reredis/pkg/acl"
+	"strings"
+)
+
+// COMMANDS describes every command for ACLs: the categories it's in, and where its keys
+// and channels are in its arguments. Every command in HandlerFuncs needs an entry, or
+// NewHandler panics.
+var COMMANDS = commandTable(map[string]*acl.Command{
+	"MULTI":          {Categories: cats("fast transaction")},
+	"EXEC":           {Categories: cats("slow transaction")},
+	"DISCARD":        {Categories: cats("fast transaction")},
+	"SELECT":         {Categories: cats("fast connection")},
+	"HELLO":          {Categories: cats("fast connection")},
+	"AUTH":           {Categories: cats("fast connection")},
+	"SWAPDB":         {Categories: cats("keyspace write fast dangerous")},
+	"FLUSHALL":       {Categories: cats("keyspace write slow dangerous")},
+	"INFO":           {Categories: cats("slow dangerous")},
+	"CONFIG":         {Subcommands: subs("admin slow dangerous", "GET", "SET", "REWRITE", "RESETSTAT")},
+	"SHUTDOWN":       {Categories: cats("admin slow dangerous")},
+	"ACL":            {Subcommands: aclSubcommands()},
+	"SUBSCRIBE":      {Categories: cats("pubsub slow"), Channels: &acl.ChannelSpec{First: 0, Last: -1}},
+	"UNSUBSCRIBE":    {Categories: cats("pubsub slow")},
+	"PSUBSCRIBE":     {Categories: cats("pubsub slow"), Channels: &acl.ChannelSpec{First: 0, Last: -1, Pattern: true}},
+	"PUNSUBSCRIBE":   {Categories: cats("pubsub slow")},
+	"PUBLISH":        {Categories: cats("pubsub fast"), Channels: &acl.ChannelSpec{First: 0, Last: 0}},
+	"PUBSUB":         {Subcommands: subs("pubsub slow", "CHANNELS", "NUMSUB", "NUMPAT", "SHARDCHANNELS", "SHARDNUMSUB")},
+	"SSUBSCRIBE":     {Categories: cats("pubsub slow"), Channels: &acl.ChannelSpec{First: 0, Last: -1}},
+	"SUNSUBSCRIBE":   {Categories: cats("pubsub slow")},
+	"SPUBLISH":       {Categories: cats("pubsub fast"), Channels: &acl.ChannelSpec{First: 0, Last: 0}},
+	"PING":           {Categories: cats("fast connection")},
+	"SET":            {Categories: cats("write string slow"), Keys: key(acl.KEY_WRITE)},
+	"GET":            {Categories: cats("read string fast"), Keys: key(acl.KEY_READ)},
+	"DEL":            {Categories: cats("keyspace write slow"), Keys: allKeys(acl.KEY_WRITE)},
+	"HSET":           {Categories: cats("write hash fast"), Keys: key(acl.KEY_WRITE)},
+	"HGET":           {Categories: cats("read hash fast"), Keys: key(acl.KEY_READ)},
+	"HGETALL":        {Categories: cats("read hash slow"), Keys: key(acl.KEY_READ)},
+	"LPUSH":          {Categories: cats("write list fast"), Keys: key(acl.KEY_WRITE)},
+	"RPUSH":          {Categories: cats("write list fast"), Keys: key(acl.KEY_WRITE)},
+	"LPOP":           {Categories: cats("write list fast"), Keys: key(acl.KEY_RW)},
+	"RPOP":           {Categories: cats("write list fast"), Keys: key(acl.KEY_RW)},
+	"LLEN":           {Categories: cats("read list fast"), Keys: key(0)},
+	"LRANGE":         {Categories: cats("read list slow"), Keys: key(acl.KEY_READ)},
+	"KEYS":           {Categories: cats("keyspace read slow dangerous")},
+	"RENAME":         {Categories: cats("keyspace write slow"), Keys: twoKeys(acl.KEY_RW, acl.KEY_WRITE)},
+	"RENAMENX":       {Categories: cats("keyspace write fast"), Keys: twoKeys(acl.KEY_RW, acl.KEY_WRITE)},
+	"COPY":           {Categories: cats("keyspace write slow"), Keys: twoKeys(acl.KEY_READ, acl.KEY_WRITE)},
+	"MOVE":           {Categories: cats("keyspace write fast"), Keys: key(acl.KEY_RW)},
+	"RANDOMKEY":      {Categories: cats("keyspace read slow")},
+	"DBSIZE":         {Categories: cats("keyspace read fast")},
+	"FLUSHDB":        {Categories: cats("keyspace write slow dangerous")},
+	"DUMP":           {Categories: cats("keyspace read slow"), Keys: key(acl.KEY_READ)},
+	"RESTORE":        {Categories: cats("keyspace write slow dangerous"), Keys: key(acl.KEY_WRITE)},
+	"XADD":           {Categories: cats("write stream fast"), Keys: key(acl.KEY_WRITE)},
+	"XLEN":           {Categories: cats("read stream fast"), Keys: key(0)},
+	"XRANGE":         {Categories: cats("read stream slow"), Keys: key(acl.KEY_READ)},
+	"XREVRANGE":      {Categories: cats("read stream slow"), Keys: key(acl.KEY_READ)},
+	"XDEL":           {Categories: cats("write stream fast"), Keys: key(acl.KEY_WRITE)},
+	"XTRIM":          {Categories: cats("write stream slow"), Keys: key(acl.KEY_WRITE)},
+	"XREAD":          {Categories: cats("read stream slow blocking"), Keys: streamsKeys(acl.KEY_READ)},
+	"XGROUP":         {Subcommands: subs("write stream slow", "CREATE", "SETID", "DESTROY", "CREATECONSUMER", "DELCONSUMER"), Keys: []acl.KeySpec{{Perm: acl.KEY_WRITE, First: 1, Last: 1}}},
+	"XREADGROUP":     {Categories: cats("write stream slow blocking"), Keys: streamsKeys(acl.KEY_RW)},
+	"XACK":           {Categories: cats("write stream fast"), Keys: key(acl.KEY_WRITE)},
+	"XPENDING":       {Categories: cats("read stream slow"), Keys: key(acl.KEY_READ)},
+	"XCLAIM":         {Categories: cats("write stream fast"), Keys: key(acl.KEY_RW)},
+	"XAUTOCLAIM":     {Categories: cats("write stream fast"), Keys: key(acl.KEY_RW)},
+	"XINFO":          {Subcommands: subs("read stream slow", "STREAM", "GROUPS", "CONSUMERS"), Keys: []acl.KeySpec{{Perm: acl.KEY_READ, First: 1, Last: 1}}},
+	"GEOADD":         {Categories: cats("write geo slow"), Keys: key(acl.KEY_WRITE)},
+	"GEOPOS":         {Categories: cats("read geo slow"), Keys: key(acl.KEY_READ)},
+	"GEODIST":        {Categories: cats("read geo slow"), Keys: key(acl.KEY_READ)},
+	"GEOHASH":        {Categories: cats("read geo slow"), Keys: key(acl.KEY_READ)},
+	"GEOSEARCH":      {Categories: cats("read geo slow"), Keys: key(acl.KEY_READ)},
+	"GEOSEARCHSTORE": {Categories: cats("write geo slow"), Keys: twoKeys(acl.KEY_WRITE, acl.KEY_READ)},
+})
+
+func aclSubcommands() map[string]*acl.Command {
+	res := subs("admin slow dangerous", "SETUSER", "GETUSER", "DELUSER", "LIST", "USERS", "DRYRUN", "LOG", "SAVE", "LOAD")
+	for name, sub := range subs("slow", "WHOAMI", "CAT") {
+		res[name] = sub
+	}
+	return res
+}
+
+// commandTable names the commands after their keys, and has subcommands inherit the
+// keys and channels of their container.
+func commandTable(commands map[string]*acl.Command) map[string]*acl.Command {
+	for name, cmd := range commands {
+		cmd.Name = strings.ToLower(name)
+		for subName, sub := range cmd.Subcommands {
+			sub.Name = cmd.Name + "|" + subName
+			sub.Keys = cmd.Keys
+			sub.Channels = cmd.Channels
+		}
+	}
+	return commands
+}
+
+func cats(categories string) []string {
+	return strings.Fields(categories)
+}
+
+// subs describes subcommands that are all in the same categories.
+func subs(categories string, names ...string) map[string]*acl.Command {
+	res := map[string]*acl.Command{}
+	for _, name := range names {
+		res[strings.ToLower(name)] = &acl.Command{Categories: cats(categories)}
+	}
+	return res
+}
+
+// key is the key spec of a command whose first argument is its only key.
+func key(perm acl.KeyPerm) []acl.KeySpec {
+	return []acl.KeySpec{{Perm: perm, First: 0, Last: 0}}
+}
+
+// twoKeys is the key spec of a command whose first two arguments are keys, like RENAME.
+func twoKeys(first acl.KeyPerm, second acl.KeyPerm) []acl.KeySpec {
+	return []acl.KeySpec{{Perm: first, First: 0, Last: 0}, {Perm: second, First: 1, Last: 1}}
+}
+
+// allKeys is the key spec of a command whose arguments are all keys, like DEL.
+func allKeys(perm acl.KeyPerm) []acl.KeySpec {
+	return []acl.KeySpec{{Perm: perm, First: 0, Last: -1}}
+}
+
+// streamsKeys is the key spec of XREAD and XREADGROUP: STREAMS key [key ...] id [id ...].
+func streamsKeys(perm acl.KeyPerm) []acl.KeySpec {
+	return []acl.KeySpec{{Perm: perm, Keyword: "STREAMS", First: 0, Last: -1, Limit: 2}}
+}
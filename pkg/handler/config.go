@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"reredis/pkg/config"
+	"reredis/pkg/resp"
+	"strings"
+)
+
+// Config returns the settings currently in effect.
+func (handler *Handler) Config() *config.Config {
+	return handler.config.Load()
+}
+
+// ConfigCmd reads and changes settings at runtime.
+//
+//	CONFIG GET pattern [pattern ...]
+//	CONFIG SET parameter value [parameter value ...]
+//	CONFIG REWRITE
+//	CONFIG RESETSTAT
+func (handler *Handler) ConfigCmd(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'config' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	sub := strings.ToUpper(*args[0].Bulk)
+	switch {
+	case sub == "GET" && len(args) >= 2:
+		cfg := handler.Config()
+		seen := map[string]bool{}
+		res := []resp.Value{}
+		for _, arg := range args[1:] {
+			for _, pair := range cfg.Match(*arg.Bulk) {
+				if seen[pair[0]] {
+					continue
+				}
+				seen[pair[0]] = true
+				res = append(res, bulkString(pair[0]), bulkString(pair[1]))
+			}
+		}
+		return resp.Value{
+			Type:  "map",
+			Array: res,
+		}
+	case sub == "SET" && len(args) >= 3 && len(args)%2 == 1:
+		pairs := make([][2]string, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{*args[i].Bulk, *args[i+1].Bulk})
+		}
+		return handler.configSet(pairs)
+	case sub == "REWRITE" && len(args) == 1:
+		if err := handler.Config().Rewrite(); err != nil {
+			errStr := "Rewriting config file: " + err.Error()
+			if errors.Is(err, config.ErrNoConfigFile) {
+				errStr = err.Error()
+			}
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		ok := "OK"
+		return resp.Value{Type: "string", String: &ok}
+	case sub == "RESETSTAT" && len(args) == 1:
+		handler.Databases.Stats.Reset()
+		ok := "OK"
+		return resp.Value{Type: "string", String: &ok}
+	default:
+		errStr := "unknown subcommand or wrong number of arguments for '" + *args[0].Bulk + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+}
+
+// configSet validates every change up front and applies them together. If applying them
+// fails, say because the new port is taken, OnConfigSet is expected to undo whatever it
+// did and the old settings stay in effect.
+func (handler *Handler) configSet(pairs [][2]string) resp.Value {
+	handler.configMutex.Lock()
+	defer handler.configMutex.Unlock()
+
+	old := handler.Config()
+	updated, err := old.Update(pairs)
+	if err == nil && handler.OnConfigSet != nil {
+		params := make([]string, len(pairs))
+		for i, pair := range pairs {
+			params[i] = strings.ToLower(pair[0])
+		}
+		err = handler.OnConfigSet(old, updated, params)
+	}
+	if err != nil {
+		var cfgErr *config.Error
+		errStr := err.Error()
+		switch {
+		case errors.As(err, &cfgErr) && errors.Is(err, config.ErrBadDirective):
+			errStr = "Unknown option or number of arguments for CONFIG SET - '" + cfgErr.Text + "'"
+		case errors.As(err, &cfgErr):
+			errStr = "CONFIG SET failed (possibly related to argument '" + cfgErr.Text + "') - " + cfgErr.Err.Error()
+		}
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	handler.config.Store(updated)
+	handler.Databases.SetConfig(&updated.Config)
+	if updated.RequirePass != old.RequirePass {
+		handler.ACL.SetRequirePass(updated.RequirePass)
+	}
+
+	ok := "OK"
+	return resp.Value{Type: "string", String: &ok}
+}
@@ -1,39 +1,240 @@
 package handler
 
 import (
+	"reredis/pkg/acl"
+	"reredis/pkg/config"
+	"reredis/pkg/pubsub"
 	"reredis/pkg/resp"
 	"reredis/pkg/store"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type Handler struct {
-	HandlerFuncs map[string]func([]resp.Value) resp.Value
-	Store        *store.Store
-}
-
-func NewHandler(store *store.Store) *Handler {
-	return &Handler{
-		HandlerFuncs: map[string]func([]resp.Value) resp.Value{
-			"MULTI":   store.Multi,
-			"EXEC":    store.Exec,
-			"DISCARD": store.Discard,
-			"PING":    store.Ping,
-			"SET":     store.Set,
-			"GET":     store.Get,
-			"DEL":     store.Del,
-			"HSET":    store.HSet,
-			"HGET":    store.HGet,
-			"HGETALL": store.HGetAll,
-			"LPUSH":   store.LPush,
-			"RPUSH":   store.RPush,
-			"LPOP":    store.LPop,
-			"RPOP":    store.RPop,
-			"LLEN":    store.LLen,
-			"LRANGE":  store.LRange,
-		},
-		Store: store,
+	HandlerFuncs map[string]func(*Client, []resp.Value) resp.Value
+	Databases    *store.Databases
+	PubSub       *pubsub.PubSub
+	ACL          *acl.ACL
+
+	//OnConfigSet applies settings changed with CONFIG SET that the store doesn't read
+	//for itself, like the addresses to listen on. params are the names of the settings
+	//that were set, even if to the value they had. If it fails, the change is rejected.
+	OnConfigSet func(old *config.Config, updated *config.Config, params []string) error
+	//OnShutdown stops the server on behalf of client, skipping the wait for other clients'
+	//in-flight commands if now is set. It returns once the server is about to exit.
+	OnShutdown func(client *Client, now bool) error
+
+	config      atomic.Pointer[config.Config]
+	configMutex sync.Mutex //serializes CONFIG SET
+}
+
+func NewHandler(cfg *config.Config, databases *store.Databases, ps *pubsub.PubSub) *Handler {
+	handler := &Handler{
+		Databases: databases,
+		PubSub:    ps,
+	}
+	handler.config.Store(cfg)
+	handler.ACL = acl.New(COMMANDS)
+	handler.ACL.SetRequirePass(cfg.RequirePass)
+
+	handler.HandlerFuncs = map[string]func(*Client, []resp.Value) resp.Value{
+		"MULTI":          handler.Multi,
+		"EXEC":           handler.Exec,
+		"DISCARD":        handler.Discard,
+		"SELECT":         handler.Select,
+		"HELLO":          handler.Hello,
+		"AUTH":           handler.Auth,
+		"ACL":            handler.ACLCmd,
+		"SWAPDB":         global(databases.SwapDB),
+		"FLUSHALL":       global(databases.FlushAll),
+		"INFO":           global(databases.Info),
+		"CONFIG":         handler.ConfigCmd,
+		"SHUTDOWN":       handler.Shutdown,
+		"SUBSCRIBE":      handler.Subscribe,
+		"UNSUBSCRIBE":    handler.Unsubscribe,
+		"PSUBSCRIBE":     handler.PSubscribe,
+		"PUNSUBSCRIBE":   handler.PUnsubscribe,
+		"PUBLISH":        handler.Publish,
+		"PUBSUB":         handler.PubSubCmd,
+		"SSUBSCRIBE":     handler.SSubscribe,
+		"SUNSUBSCRIBE":   handler.SUnsubscribe,
+		"SPUBLISH":       handler.SPublish,
+		"PING":           handler.db((*store.Store).Ping),
+		"SET":            handler.db((*store.Store).Set),
+		"GET":            handler.db((*store.Store).Get),
+		"DEL":            handler.db((*store.Store).Del),
+		"HSET":           handler.db((*store.Store).HSet),
+		"HGET":           handler.db((*store.Store).HGet),
+		"HGETALL":        handler.db((*store.Store).HGetAll),
+		"LPUSH":          handler.db((*store.Store).LPush),
+		"RPUSH":          handler.db((*store.Store).RPush),
+		"LPOP":           handler.db((*store.Store).LPop),
+		"RPOP":           handler.db((*store.Store).RPop),
+		"LLEN":           handler.db((*store.Store).LLen),
+		"LRANGE":         handler.db((*store.Store).LRange),
+		"KEYS":           handler.db((*store.Store).Keys),
+		"RENAME":         handler.db((*store.Store).Rename),
+		"RENAMENX":       handler.db((*store.Store).RenameNX),
+		"COPY":           handler.db((*store.Store).Copy),
+		"MOVE":           handler.db((*store.Store).Move),
+		"RANDOMKEY":      handler.db((*store.Store).RandomKey),
+		"DBSIZE":         handler.db((*store.Store).DBSize),
+		"FLUSHDB":        handler.db((*store.Store).FlushDB),
+		"DUMP":           handler.db((*store.Store).Dump),
+		"RESTORE":        handler.db((*store.Store).Restore),
+		"XADD":           handler.db((*store.Store).XAdd),
+		"XLEN":           handler.db((*store.Store).XLen),
+		"XRANGE":         handler.db((*store.Store).XRange),
+		"XREVRANGE":      handler.db((*store.Store).XRevRange),
+		"XDEL":           handler.db((*store.Store).XDel),
+		"XTRIM":          handler.db((*store.Store).XTrim),
+		"XREAD":          handler.XRead,
+		"XGROUP":         handler.db((*store.Store).XGroup),
+		"XREADGROUP":     handler.XReadGroup,
+		"XACK":           handler.db((*store.Store).XAck),
+		"XPENDING":       handler.db((*store.Store).XPending),
+		"XCLAIM":         handler.db((*store.Store).XClaim),
+		"XAUTOCLAIM":     handler.db((*store.Store).XAutoClaim),
+		"XINFO":          handler.db((*store.Store).XInfo),
+		"GEOADD":         handler.db((*store.Store).GeoAdd),
+		"GEOPOS":         handler.db((*store.Store).GeoPos),
+		"GEODIST":        handler.db((*store.Store).GeoDist),
+		"GEOHASH":        handler.db((*store.Store).GeoHash),
+		"GEOSEARCH":      handler.db((*store.Store).GeoSearch),
+		"GEOSEARCHSTORE": handler.db((*store.Store).GeoSearchStore),
+	}
+
+	//a command ACLs know nothing about would be denied to everyone, so catch it here
+	for command := range handler.HandlerFuncs {
+		if _, ok := COMMANDS[command]; !ok {
+			panic("handler: command " + command + " has no entry in COMMANDS")
+		}
+	}
+
+	return handler
+}
+
+// db adapts a store command so it runs against the client's selected database.
+func (handler *Handler) db(fn func(*store.Store, []resp.Value) resp.Value) func(*Client, []resp.Value) resp.Value {
+	return func(client *Client, args []resp.Value) resp.Value {
+		return fn(handler.Databases.Stores[client.DB], args)
+	}
+}
+
+// global adapts a command that doesn't depend on which database the client selected.
+func global(fn func([]resp.Value) resp.Value) func(*Client, []resp.Value) resp.Value {
+	return func(_ *Client, args []resp.Value) resp.Value {
+		return fn(args)
+	}
+}
+
+// Dispatch runs a single command for client and returns its reply.
+func (handler *Handler) Dispatch(client *Client, command string, args []resp.Value) resp.Value {
+	handlerFn, ok := handler.HandlerFuncs[command]
+	if !ok {
+		//like redis, only as much of what the client sent is echoed as fits in an error
+		errStr := "unknown command '" + truncate(command, UNKNOWN_CMD_ECHO_MAX) + "', with args beginning with: "
+		echoed := ""
+		for _, arg := range args {
+			if len(echoed) >= UNKNOWN_CMD_ECHO_MAX {
+				break
+			}
+			echoed += "'" + truncate(*arg.Bulk, UNKNOWN_CMD_ECHO_MAX-len(echoed)) + "' "
+		}
+		errStr += echoed
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if !client.Authenticated && !NOAUTH_CMDS[command] {
+		errStr := "NOAUTH Authentication required."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if denied := handler.checkACL(client, command, args); denied != nil {
+		return *denied
+	}
+
+	//RESP3 tells pushed messages apart from replies, so only RESP2 clients are limited
+	//while subscribed
+	if client.InSubscriberMode() && client.Proto() == resp.RESP2 {
+		if !SUBSCRIBER_CMDS[command] {
+			errStr := "Can't execute '" + strings.ToLower(command) + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING are allowed in this context"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		if command == "PING" { //in subscriber mode PING replies like a pushed message
+			pong, msg := "pong", ""
+			if len(args) > 0 {
+				msg = *args[0].Bulk
+			}
+			return resp.Value{
+				Type:  "array",
+				Array: []resp.Value{{Type: "bulk", Bulk: &pong}, {Type: "bulk", Bulk: &msg}},
+			}
+		}
+	}
+
+	//make room before running anything, refusing commands that would need more
+	//memory if we couldn't
+	if !handler.Databases.PerformEvictions() && DENYOOM_CMDS[command] {
+		errStr := "OOM command not allowed when used memory > 'maxmemory'."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if client.InMulti && command != EXEC_CMD && command != DISCARD_CMD {
+		return client.QMultiCmd(handlerFn, args)
 	}
+
+	return handlerFn(client, args)
+}
+
+// CloseClient releases everything held on behalf of a client that disconnected.
+func (handler *Handler) CloseClient(client *Client) {
+	handler.unsubscribeAll(client)
+	client.Close()
 }
 
 const (
-	EXEC_CMD = "EXEC"
+	EXEC_CMD    = "EXEC"
+	DISCARD_CMD = "DISCARD"
+
+	UNKNOWN_CMD_ECHO_MAX = 128 //how much of an unknown command and its args the error quotes
 )
+
+// truncate cuts s down to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// DENYOOM_CMDS can grow memory usage, so they're refused while over maxmemory.
+var DENYOOM_CMDS = map[string]bool{
+	"SET":            true,
+	"HSET":           true,
+	"LPUSH":          true,
+	"RPUSH":          true,
+	"COPY":           true,
+	"RESTORE":        true,
+	"XADD":           true,
+	"XGROUP":         true,
+	"XREADGROUP":     true,
+	"XCLAIM":         true,
+	"XAUTOCLAIM":     true,
+	"GEOADD":         true,
+	"GEOSEARCHSTORE": true,
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"reredis/pkg/config"
+	"reredis/pkg/pubsub"
+	"reredis/pkg/resp"
+	"reredis/pkg/store"
+	"strings"
+	"testing"
+)
+
+func newTestHandler() *Handler {
+	cfg := config.Default()
+	return NewHandler(cfg, store.NewDatabases(&cfg.Config), pubsub.NewPubSub())
+}
+
+func TestUnknownCommandEchoIsTruncated(t *testing.T) {
+	handler := newTestHandler()
+	client := NewClient()
+	client.Authenticated = true
+
+	long := strings.Repeat("x", 1000)
+	args := []resp.Value{}
+	for i := 0; i < 10; i++ {
+		args = append(args, resp.Value{Type: "bulk", Bulk: &long})
+	}
+
+	res := handler.Dispatch(client, long, args)
+	if res.Type != "error" {
+		t.Fatalf("got a %s, want an error", res.Type)
+	}
+	if limit := 2*UNKNOWN_CMD_ECHO_MAX + 100; len(*res.String) > limit {
+		t.Errorf("error is %d bytes long, want at most %d", len(*res.String), limit)
+	}
+	if want := "unknown command '" + long[:UNKNOWN_CMD_ECHO_MAX] + "', with args beginning with: 'xxx"; !strings.HasPrefix(*res.String, want) {
+		t.Errorf("got %.200q", *res.String)
+	}
+}
+
+// There's nothing to save to, so SHUTDOWN SAVE must fail instead of exiting without saving.
+func TestShutdownSaveIsRefused(t *testing.T) {
+	handler := newTestHandler()
+	shutdowns := 0
+	handler.OnShutdown = func(*Client, bool) error {
+		shutdowns++
+		return nil
+	}
+
+	tests := []struct {
+		args     []string
+		shutdown bool
+	}{
+		{[]string{"SAVE"}, false},
+		{[]string{"NOW", "save"}, false},
+		{[]string{"SAVE", "NOSAVE"}, false},
+		{[]string{"NOSAVE", "FORCE"}, true},
+		{[]string{}, true},
+	}
+	for _, test := range tests {
+		args := []resp.Value{}
+		for i := range test.args {
+			args = append(args, resp.Value{Type: "bulk", Bulk: &test.args[i]})
+		}
+		before := shutdowns
+		res := handler.Shutdown(NewClient(), args)
+		if shut := shutdowns > before; shut != test.shutdown || shut == (res.Type == "error") {
+			t.Errorf("SHUTDOWN %v: shut down %v, replied %s %v", test.args, shut, res.Type, res.String)
+		}
+	}
+}
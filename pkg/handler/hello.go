@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"reredis/pkg/resp"
+	"strconv"
+	"strings"
+)
+
+// REDIS_VERSION is the redis version whose commands and protocol we follow, reported to
+// clients by HELLO.
+const REDIS_VERSION = "7.2.0"
+
+// Hello switches the connection to the requested protocol version, optionally
+// authenticating and naming it on the way, and replies with the server's details:
+//
+//	HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (handler *Handler) Hello(client *Client, args []resp.Value) resp.Value {
+	proto := client.Proto()
+	if len(args) > 0 {
+		ver, err := strconv.ParseInt(*args[0].Bulk, 10, 64)
+		if err != nil {
+			errStr := "Protocol version is not an integer or out of range"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		if ver != resp.RESP2 && ver != resp.RESP3 {
+			errStr := "NOPROTO unsupported protocol version"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		proto = int(ver)
+	}
+
+	var name, username, password *string
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(*args[i].Bulk)
+		switch {
+		case opt == "AUTH" && i+2 < len(args):
+			username, password = args[i+1].Bulk, args[i+2].Bulk
+			i += 2
+		case opt == "SETNAME" && i+1 < len(args):
+			name = args[i+1].Bulk
+			if !validClientName(*name) {
+				errStr := "Client names cannot contain spaces, newlines or special characters."
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			i++
+		default:
+			errStr := "Syntax error in HELLO option '" + *args[i].Bulk + "'"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	if password == nil && !client.Authenticated {
+		errStr := "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	//only touch the connection once every option checked out, authenticating last since
+	//it's the one that can't be undone
+	if password != nil && !handler.authenticate(client, *username, *password) {
+		errStr := WRONGPASS_ERR
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	if name != nil {
+		client.Name = *name
+	}
+	client.proto.Store(int32(proto))
+
+	server, version, mode, role := "redis", REDIS_VERSION, "standalone", "master"
+	protoNum, id := int64(proto), client.ID
+	return resp.Value{
+		Type: "map",
+		Array: []resp.Value{
+			bulkString("server"), {Type: "bulk", Bulk: &server},
+			bulkString("version"), {Type: "bulk", Bulk: &version},
+			bulkString("proto"), {Type: "integer", Number: &protoNum},
+			bulkString("id"), {Type: "integer", Number: &id},
+			bulkString("mode"), {Type: "bulk", Bulk: &mode},
+			bulkString("role"), {Type: "bulk", Bulk: &role},
+			bulkString("modules"), {Type: "array", Array: []resp.Value{}},
+		},
+	}
+}
+
+// validClientName checks a name only uses printable characters other than space, so it
+// can't break up CLIENT LIST output.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func bulkString(s string) resp.Value {
+	return resp.Value{Type: "bulk", Bulk: &s}
+}
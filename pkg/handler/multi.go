@@ -0,0 +1,114 @@
+package handler
+
+import "reredis/pkg/resp"
+
+type MultiQCmd struct {
+	Fn   func(*Client, []resp.Value) resp.Value
+	Args []resp.Value
+}
+
+func (handler *Handler) Multi(client *Client, args []resp.Value) resp.Value {
+	if len(args) > 0 {
+		errStr := "incorrect number of arguments passed for 'MULTI'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if client.InMulti {
+		errStr := "instance already in 'MULTI'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	client.InMulti = true
+	if client.MultiQ == nil {
+		client.MultiQ = []MultiQCmd{}
+	}
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+func (client *Client) QMultiCmd(fn func(*Client, []resp.Value) resp.Value, args []resp.Value) resp.Value {
+	if !client.InMulti {
+		errStr := "instance not in 'MULTI'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	client.MultiQ = append(client.MultiQ, MultiQCmd{
+		Fn:   fn,
+		Args: args,
+	})
+
+	qd := "QUEUED"
+	return resp.Value{
+		Type:   "string",
+		String: &qd,
+	}
+}
+
+func (handler *Handler) Exec(client *Client, args []resp.Value) resp.Value {
+	if len(args) > 0 {
+		errStr := "wrong number of arguments for 'exec' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if !client.InMulti {
+		errStr := "instance not in 'MULTI'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	res := []resp.Value{}
+
+	//the queued commands run with the client, so a SELECT inside the transaction
+	//applies to the commands after it
+	queue := client.MultiQ
+	client.InMulti = false
+	client.MultiQ = nil
+
+	client.InExec = true
+	for _, val := range queue {
+		resp := val.Fn(client, val.Args)
+		res = append(res, resp)
+	}
+	client.InExec = false
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+func (handler *Handler) Discard(client *Client, args []resp.Value) resp.Value {
+	if len(args) > 0 {
+		errStr := "wrong number of arguments for 'discard' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	client.InMulti = false
+	client.MultiQ = nil
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"reredis/pkg/pubsub"
+	"reredis/pkg/resp"
+	"strings"
+)
+
+// SUBSCRIBER_CMDS are the only commands a client in subscriber mode may run.
+var SUBSCRIBER_CMDS = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"SSUBSCRIBE":   true,
+	"SUNSUBSCRIBE": true,
+	"PING":         true,
+}
+
+// subscriptionReply builds the confirmation pushed for every channel or pattern a client
+// (un)subscribes from, e.g. ["subscribe", "news", 1].
+func subscriptionReply(kind string, name *string, count int) resp.Value {
+	num := int64(count)
+	nameVal := resp.Value{Type: "null"}
+	if name != nil {
+		nameVal = resp.Value{Type: "bulk", Bulk: name}
+	}
+
+	return resp.Value{
+		Type: "push",
+		Array: []resp.Value{
+			{Type: "bulk", Bulk: &kind},
+			nameVal,
+			{Type: "integer", Number: &num},
+		},
+	}
+}
+
+// Subscribe subscribes the client to the given channels. Like redis, there is one reply
+// per channel, so they're pushed directly and nothing is returned.
+func (handler *Handler) Subscribe(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'subscribe' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	for _, arg := range args {
+		channel := *arg.Bulk
+		if handler.PubSub.Subscribe(client, channel) {
+			client.Channels[channel] = true
+		}
+		client.Reply(subscriptionReply("subscribe", &channel, client.Subscriptions()))
+	}
+
+	return resp.Value{}
+}
+
+// Unsubscribe unsubscribes the client from the given channels, or all of them if none are given.
+func (handler *Handler) Unsubscribe(client *Client, args []resp.Value) resp.Value {
+	channels := []string{}
+	for _, arg := range args {
+		channels = append(channels, *arg.Bulk)
+	}
+	if len(args) == 0 {
+		for channel := range client.Channels {
+			channels = append(channels, channel)
+		}
+	}
+
+	if len(channels) == 0 {
+		client.Reply(subscriptionReply("unsubscribe", nil, client.Subscriptions()))
+		return resp.Value{}
+	}
+
+	for _, channel := range channels {
+		handler.PubSub.Unsubscribe(client, channel)
+		delete(client.Channels, channel)
+		client.Reply(subscriptionReply("unsubscribe", &channel, client.Subscriptions()))
+	}
+
+	return resp.Value{}
+}
+
+// PSubscribe subscribes the client to every channel matching the given glob patterns.
+func (handler *Handler) PSubscribe(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'psubscribe' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	for _, arg := range args {
+		pattern := *arg.Bulk
+		if handler.PubSub.PSubscribe(client, pattern) {
+			client.Patterns[pattern] = true
+		}
+		client.Reply(subscriptionReply("psubscribe", &pattern, client.Subscriptions()))
+	}
+
+	return resp.Value{}
+}
+
+// PUnsubscribe unsubscribes the client from the given patterns, or all of them if none are given.
+func (handler *Handler) PUnsubscribe(client *Client, args []resp.Value) resp.Value {
+	patterns := []string{}
+	for _, arg := range args {
+		patterns = append(patterns, *arg.Bulk)
+	}
+	if len(args) == 0 {
+		for pattern := range client.Patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	if len(patterns) == 0 {
+		client.Reply(subscriptionReply("punsubscribe", nil, client.Subscriptions()))
+		return resp.Value{}
+	}
+
+	for _, pattern := range patterns {
+		handler.PubSub.PUnsubscribe(client, pattern)
+		delete(client.Patterns, pattern)
+		client.Reply(subscriptionReply("punsubscribe", &pattern, client.Subscriptions()))
+	}
+
+	return resp.Value{}
+}
+
+// SSubscribe subscribes the client to the given sharded channels. The count in each
+// reply only includes sharded subscriptions, like redis.
+func (handler *Handler) SSubscribe(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'ssubscribe' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	for _, arg := range args {
+		channel := *arg.Bulk
+		if handler.PubSub.SSubscribe(client, channel) {
+			client.Shards[channel] = true
+		}
+		client.Reply(subscriptionReply("ssubscribe", &channel, len(client.Shards)))
+	}
+
+	return resp.Value{}
+}
+
+// SUnsubscribe unsubscribes the client from the given sharded channels, or all of them if none are given.
+func (handler *Handler) SUnsubscribe(client *Client, args []resp.Value) resp.Value {
+	channels := []string{}
+	for _, arg := range args {
+		channels = append(channels, *arg.Bulk)
+	}
+	if len(args) == 0 {
+		for channel := range client.Shards {
+			channels = append(channels, channel)
+		}
+	}
+
+	if len(channels) == 0 {
+		client.Reply(subscriptionReply("sunsubscribe", nil, len(client.Shards)))
+		return resp.Value{}
+	}
+
+	for _, channel := range channels {
+		handler.PubSub.SUnsubscribe(client, channel)
+		delete(client.Shards, channel)
+		client.Reply(subscriptionReply("sunsubscribe", &channel, len(client.Shards)))
+	}
+
+	return resp.Value{}
+}
+
+// SPublish sends a message to a sharded channel and returns how many clients received it.
+func (handler *Handler) SPublish(client *Client, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'spublish' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	receivers := int64(handler.PubSub.SPublish(*args[0].Bulk, *args[1].Bulk))
+	return resp.Value{
+		Type:   "integer",
+		Number: &receivers,
+	}
+}
+
+// Publish sends a message to a channel and returns how many clients received it.
+func (handler *Handler) Publish(client *Client, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'publish' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	receivers := int64(handler.PubSub.Publish(*args[0].Bulk, *args[1].Bulk))
+	return resp.Value{
+		Type:   "integer",
+		Number: &receivers,
+	}
+}
+
+// PubSubCmd implements the PUBSUB introspection subcommands.
+//
+//	PUBSUB CHANNELS [pattern]
+//	PUBSUB NUMSUB [channel ...]
+//	PUBSUB NUMPAT
+//	PUBSUB SHARDCHANNELS [pattern]
+//	PUBSUB SHARDNUMSUB [channel ...]
+func (handler *Handler) PubSubCmd(client *Client, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'pubsub' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	sub := strings.ToUpper(*args[0].Bulk)
+	switch {
+	case sub == "CHANNELS" && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = *args[1].Bulk
+		}
+		return bulkArray(handler.PubSub.ActiveChannels(pattern))
+	case sub == "SHARDCHANNELS" && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = *args[1].Bulk
+		}
+		return bulkArray(handler.PubSub.ActiveShardChannels(pattern))
+	case sub == "NUMSUB" || sub == "SHARDNUMSUB":
+		numSub := handler.PubSub.NumSub
+		if sub == "SHARDNUMSUB" {
+			numSub = handler.PubSub.ShardNumSub
+		}
+		res := []resp.Value{}
+		for _, arg := range args[1:] {
+			count := int64(numSub(*arg.Bulk))
+			res = append(res, resp.Value{Type: "bulk", Bulk: arg.Bulk})
+			res = append(res, resp.Value{Type: "integer", Number: &count})
+		}
+		return resp.Value{
+			Type:  "map",
+			Array: res,
+		}
+	case sub == "NUMPAT" && len(args) == 1:
+		count := int64(handler.PubSub.NumPat())
+		return resp.Value{
+			Type:   "integer",
+			Number: &count,
+		}
+	default:
+		errStr := "unknown subcommand or wrong number of arguments for '" + *args[0].Bulk + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+}
+
+// unsubscribeAll drops every subscription of a client that is disconnecting.
+func (handler *Handler) unsubscribeAll(client *Client) {
+	for channel := range client.Channels {
+		handler.PubSub.Unsubscribe(client, channel)
+	}
+	for pattern := range client.Patterns {
+		handler.PubSub.PUnsubscribe(client, pattern)
+	}
+	for channel := range client.Shards {
+		handler.PubSub.SUnsubscribe(client, channel)
+	}
+	client.Channels = map[string]bool{}
+	client.Patterns = map[string]bool{}
+	client.Shards = map[string]bool{}
+}
+
+func bulkArray(strs []string) resp.Value {
+	res := make([]resp.Value, len(strs))
+	for i := range strs {
+		res[i] = resp.Value{Type: "bulk", Bulk: &strs[i]}
+	}
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+var _ pubsub.Subscriber = (*Client)(nil)
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"reredis/pkg/resp"
+	"strings"
+)
+
+// Shutdown stops the server. Like redis it doesn't reply when it succeeds, the connection
+// just closes once the server is done:
+//
+//	SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] [ABORT]
+//
+// NOW skips waiting for other clients' in-flight commands. There's no persistence yet, so
+// SAVE is refused rather than exiting without the save it asked for, while NOSAVE is what
+// happens anyway and FORCE has no save errors to ignore. There are no replicas to wait for
+// either, so a shutdown never sits in a state ABORT could cancel.
+func (handler *Handler) Shutdown(client *Client, args []resp.Value) resp.Value {
+	save, noSave, now, abort := false, false, false, false
+	for _, arg := range args {
+		switch strings.ToUpper(*arg.Bulk) {
+		case "SAVE":
+			save = true
+		case "NOSAVE":
+			noSave = true
+		case "NOW":
+			now = true
+		case "FORCE":
+		case "ABORT":
+			abort = true
+		default:
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	if (save && noSave) || (abort && len(args) > 1) {
+		errStr := "syntax error"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if save {
+		errStr := "SAVE is not supported, there's no persistence to save to. Use SHUTDOWN NOSAVE."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if abort {
+		errStr := "No shutdown in progress."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if handler.OnShutdown == nil {
+		errStr := "Errors trying to SHUTDOWN. Check logs."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if err := handler.OnShutdown(client, now); err != nil {
+		errStr := err.Error()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	return resp.Value{} //nothing is written, the connection is closed as the server exits
+}
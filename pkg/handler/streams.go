@@ -0,0 +1,22 @@
+package handler
+
+import "reredis/pkg/resp"
+
+// XRead runs XREAD against the client's database.
+func (handler *Handler) XRead(client *Client, args []resp.Value) resp.Value {
+	return handler.Databases.Stores[client.DB].XRead(args, blockCancel(client))
+}
+
+// XReadGroup runs XREADGROUP against the client's database.
+func (handler *Handler) XReadGroup(client *Client, args []resp.Value) resp.Value {
+	return handler.Databases.Stores[client.DB].XReadGroup(args, blockCancel(client))
+}
+
+// blockCancel gives blocking commands a way to find out the client went away. Inside a
+// transaction commands can't block, which the store is told with a nil channel.
+func blockCancel(client *Client) <-chan struct{} {
+	if client.InExec {
+		return nil
+	}
+	return client.Gone
+}
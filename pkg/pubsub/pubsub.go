@@ -0,0 +1,252 @@
+package pubsub
+
+import (
+	"reredis/pkg/resp"
+	"reredis/pkg/utils"
+	"sort"
+	"sync"
+)
+
+// Subscriber is anything messages can be pushed to, in practice a client connection.
+// Push must not block, a subscriber that can't keep up should drop itself instead.
+type Subscriber interface {
+	Push(msg resp.Value) bool
+}
+
+// PubSub routes published messages to the subscribers of a channel, and to the
+// subscribers of any glob pattern matching it. Sharded channels are kept apart, grouped
+// by the hash slot of their name so their traffic can be routed per slot.
+type PubSub struct {
+	Channels      map[string]map[Subscriber]bool
+	Patterns      map[string]map[Subscriber]bool
+	ShardChannels map[int]map[string]map[Subscriber]bool //slot -> channel -> subscribers
+	Mutex         sync.RWMutex
+}
+
+func NewPubSub() *PubSub {
+	return &PubSub{
+		Channels:      map[string]map[Subscriber]bool{},
+		Patterns:      map[string]map[Subscriber]bool{},
+		ShardChannels: map[int]map[string]map[Subscriber]bool{},
+	}
+}
+
+// Subscribe adds sub to channel. Returns false if it was already subscribed.
+func (ps *PubSub) Subscribe(sub Subscriber, channel string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	return add(ps.Channels, channel, sub)
+}
+
+// Unsubscribe removes sub from channel. Returns false if it wasn't subscribed.
+func (ps *PubSub) Unsubscribe(sub Subscriber, channel string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	return remove(ps.Channels, channel, sub)
+}
+
+// PSubscribe adds sub to every channel matching pattern. Returns false if it was already subscribed.
+func (ps *PubSub) PSubscribe(sub Subscriber, pattern string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	return add(ps.Patterns, pattern, sub)
+}
+
+// PUnsubscribe removes sub from pattern. Returns false if it wasn't subscribed.
+func (ps *PubSub) PUnsubscribe(sub Subscriber, pattern string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	return remove(ps.Patterns, pattern, sub)
+}
+
+// Publish sends message to everyone subscribed to channel, directly or through a
+// pattern, and returns how many subscribers received it.
+func (ps *PubSub) Publish(channel string, message string) int {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	receivers := 0
+
+	if subs, ok := ps.Channels[channel]; ok {
+		msg := NewMessage("message", channel, message)
+		for sub := range subs {
+			if sub.Push(msg) {
+				receivers++
+			}
+		}
+	}
+
+	for pattern, subs := range ps.Patterns {
+		if !utils.GlobMatch(pattern, channel, false) {
+			continue
+		}
+
+		msg := NewMessage("pmessage", pattern, channel, message)
+		for sub := range subs {
+			if sub.Push(msg) {
+				receivers++
+			}
+		}
+	}
+
+	return receivers
+}
+
+// ActiveChannels returns the channels with at least one subscriber, optionally
+// filtered by a glob pattern.
+func (ps *PubSub) ActiveChannels(pattern string) []string {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	res := []string{}
+	for channel := range ps.Channels {
+		if pattern == "" || utils.GlobMatch(pattern, channel, false) {
+			res = append(res, channel)
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// NumSub returns how many subscribers channel has, not counting pattern subscribers.
+func (ps *PubSub) NumSub(channel string) int {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	return len(ps.Channels[channel])
+}
+
+// NumPat returns the number of unique patterns subscribed to.
+func (ps *PubSub) NumPat() int {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	return len(ps.Patterns)
+}
+
+// SSubscribe adds sub to a sharded channel. Returns false if it was already subscribed.
+func (ps *PubSub) SSubscribe(sub Subscriber, channel string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	slot := utils.KeyHashSlot(channel)
+	index, ok := ps.ShardChannels[slot]
+	if !ok {
+		index = map[string]map[Subscriber]bool{}
+		ps.ShardChannels[slot] = index
+	}
+
+	return add(index, channel, sub)
+}
+
+// SUnsubscribe removes sub from a sharded channel. Returns false if it wasn't subscribed.
+func (ps *PubSub) SUnsubscribe(sub Subscriber, channel string) bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+
+	slot := utils.KeyHashSlot(channel)
+	index, ok := ps.ShardChannels[slot]
+	if !ok {
+		return false
+	}
+
+	removed := remove(index, channel, sub)
+	if len(index) == 0 {
+		delete(ps.ShardChannels, slot)
+	}
+
+	return removed
+}
+
+// SPublish sends message to the subscribers of a sharded channel. Patterns never
+// match sharded channels.
+func (ps *PubSub) SPublish(channel string, message string) int {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	receivers := 0
+	msg := NewMessage("smessage", channel, message)
+	for sub := range ps.ShardChannels[utils.KeyHashSlot(channel)][channel] {
+		if sub.Push(msg) {
+			receivers++
+		}
+	}
+
+	return receivers
+}
+
+// ActiveShardChannels returns the sharded channels with at least one subscriber,
+// optionally filtered by a glob pattern.
+func (ps *PubSub) ActiveShardChannels(pattern string) []string {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	res := []string{}
+	for _, index := range ps.ShardChannels {
+		for channel := range index {
+			if pattern == "" || utils.GlobMatch(pattern, channel, false) {
+				res = append(res, channel)
+			}
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// ShardNumSub returns how many subscribers a sharded channel has.
+func (ps *PubSub) ShardNumSub(channel string) int {
+	ps.Mutex.RLock()
+	defer ps.Mutex.RUnlock()
+
+	return len(ps.ShardChannels[utils.KeyHashSlot(channel)][channel])
+}
+
+// NewMessage builds a pushed pub/sub message like ["message", channel, payload].
+func NewMessage(kind string, parts ...string) resp.Value {
+	msg := resp.Value{
+		Type:  "array",
+		Array: make([]resp.Value, 0, len(parts)+1),
+	}
+
+	msg.Array = append(msg.Array, resp.Value{Type: "bulk", Bulk: &kind})
+	for i := range parts {
+		msg.Array = append(msg.Array, resp.Value{Type: "bulk", Bulk: &parts[i]})
+	}
+
+	return msg
+}
+
+func add(index map[string]map[Subscriber]bool, name string, sub Subscriber) bool {
+	subs, ok := index[name]
+	if !ok {
+		subs = map[Subscriber]bool{}
+		index[name] = subs
+	}
+
+	if subs[sub] {
+		return false
+	}
+	subs[sub] = true
+
+	return true
+}
+
+func remove(index map[string]map[Subscriber]bool, name string, sub Subscriber) bool {
+	subs, ok := index[name]
+	if !ok || !subs[sub] {
+		return false
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 { //don't keep empty channels around, PUBSUB CHANNELS would list them
+		delete(index, name)
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// These measure the allocations per command of decoding requests and encoding replies,
+// the costs paid on every command a connection runs. Run them with
+//
+//	go test ./pkg/resp -run '^$' -bench .
+
+const setRequest = "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+
+// repeater is an endless stream of the same request, so readers never run dry.
+type repeater struct {
+	data []byte
+	off  int
+}
+
+func (r *repeater) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.data[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.data)
+	}
+	return n, nil
+}
+
+func newRequestReader(request string) *Resp {
+	return NewResp(bufio.NewReaderSize(&repeater{data: []byte(request)}, 16*1024))
+}
+
+func BenchmarkReadRequest(b *testing.B) {
+	r := newRequestReader(setRequest)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ReadRequest(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadRequestInline(b *testing.B) {
+	r := newRequestReader("SET key value\r\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ReadRequest(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRead decodes the same request with the generic reader, for comparison.
+func BenchmarkRead(b *testing.B) {
+	r := newRequestReader(setRequest)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Read(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkWrite(b *testing.B, v Value) {
+	w := NewWriter(bufio.NewWriterSize(io.Discard, 16*1024))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := w.Write(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteOK(b *testing.B) {
+	ok := "OK"
+	benchmarkWrite(b, Value{Type: "string", String: &ok})
+}
+
+func BenchmarkWriteInteger(b *testing.B) {
+	n := int64(12345)
+	benchmarkWrite(b, Value{Type: "integer", Number: &n})
+}
+
+func BenchmarkWriteBulk(b *testing.B) {
+	s := "value"
+	benchmarkWrite(b, Value{Type: "bulk", Bulk: &s})
+}
+
+// lrangeReply is an LRANGE reply of 100 elements.
+func lrangeReply() Value {
+	elems := make([]Value, 100)
+	for i := range elems {
+		s := "element:" + strconv.Itoa(i)
+		elems[i] = Value{Type: "bulk", Bulk: &s}
+	}
+	return Value{Type: "array", Array: elems}
+}
+
+func BenchmarkWriteArray(b *testing.B) {
+	benchmarkWrite(b, lrangeReply())
+}
+
+func BenchmarkMarshalArray(b *testing.B) {
+	v := lrangeReply()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.Marshal()
+	}
+}
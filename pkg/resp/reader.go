@@ -2,52 +2,355 @@ package resp
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"reredis/pkg/utils"
+	"slices"
 	"strconv"
+	"strings"
 )
 
+const (
+	INLINE_MAX_SIZE         = 64 * 1024         //longest inline command accepted, like redis' PROTO_INLINE_MAX_SIZE
+	PROTO_MAX_BULK_LEN      = 512 * 1024 * 1024 //default proto-max-bulk-len
+	PROTO_MAX_MULTIBULK_LEN = 1024 * 1024       //most arguments a single command can have
+	BULK_PREALLOC_MAX       = 32 * 1024         //bulks up to this long are allocated up front
+	ARRAY_PREALLOC_MAX      = 1024              //arrays up to this long are allocated up front
+	ARG_BUF_KEEP_MAX        = 1024 * 1024       //argument buffers that grew past this aren't reused
+)
+
+// ProtocolError is a malformed request. The client is told what was wrong and then
+// disconnected, since there's no telling where the next request starts.
+type ProtocolError struct {
+	Msg string
+}
+
+func (err *ProtocolError) Error() string {
+	return "Protocol error: " + err.Msg
+}
+
 type Resp struct {
-	reader *bufio.Reader
+	reader          *bufio.Reader
+	MaxBulkLen      int //longest bulk string accepted, like redis' proto-max-bulk-len
+	MaxMultibulkLen int //most elements accepted in an array
+	args            [][]byte
+	argBuf          []byte //holds the arguments of the last command, reused by the next one
+	argEnds         []int
 }
 
 func NewResp(reader *bufio.Reader) *Resp {
-	return &Resp{reader: reader}
+	return &Resp{
+		reader:          reader,
+		MaxBulkLen:      PROTO_MAX_BULK_LEN,
+		MaxMultibulkLen: PROTO_MAX_MULTIBULK_LEN,
+	}
 }
 
+// ReadLine reads a line terminated by CRLF, returning it without the CRLF along with how
+// many bytes were consumed. The line is only valid until the next read. Lines that don't fit
+// in the reader's buffer are refused, so a peer can't make us buffer without end.
 func (resp *Resp) ReadLine() ([]byte, int, error) {
-	numOfBytes := 0
-	line := []byte{}
-	for {
-		by, err := resp.reader.ReadByte()
+	line, err := resp.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, 0, &ProtocolError{Msg: "too big count string"}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, 0, &ProtocolError{Msg: "expected CRLF"}
+	}
+
+	return line[:len(line)-2], len(line), nil
+}
+
+// errInvalidInt is returned by ReadInt for lines that aren't a decimal integer.
+var errInvalidInt = errors.New("invalid integer")
+
+func (resp *Resp) ReadInt() (int, int, error) {
+	line, numOfBytes, err := resp.ReadLine()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	num, ok := parseInt(line)
+	if !ok {
+		return 0, 0, errInvalidInt
+	}
+
+	return num, numOfBytes, nil
+}
+
+// parseInt parses a decimal integer straight from the line, since converting every length
+// header to a string first would allocate.
+func parseInt(b []byte) (int, bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 { //18 digits can't overflow
+		return 0, false
+	}
+
+	num := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		num = num*10 + int(c-'0')
+	}
+
+	if neg {
+		return -num, true
+	}
+	return num, true
+}
+
+// ReadRequest reads the next command, either a RESP array of bulk strings or an inline
+// command: a line of space separated arguments, like the ones typed in telnet.
+// The arguments are parsed into buffers reused from one command to the next and then
+// copied out by commandValue, since handlers keep them as strings, so this isn't
+// zero-copy: what the buffers save is allocating each argument separately.
+func (resp *Resp) ReadRequest() (Value, error) {
+	first, err := resp.reader.Peek(1)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if first[0] != ARRAY {
+		return resp.ReadInline()
+	}
+
+	args, err := resp.readMultibulk()
+	if err != nil {
+		return Value{}, err
+	}
+	return commandValue(args), nil
+}
+
+// commandValue turns the arguments of a command into the array of bulk strings handlers
+// take. Small commands share a single string for all their arguments, so converting them
+// costs the same few allocations however many arguments there are.
+func commandValue(args [][]byte) Value {
+	total := 0
+	for _, arg := range args {
+		total += len(arg)
+	}
+
+	strs := make([]string, len(args))
+	if total <= BULK_PREALLOC_MAX {
+		var sb strings.Builder
+		sb.Grow(total)
+		for _, arg := range args {
+			sb.Write(arg)
+		}
+
+		all, off := sb.String(), 0
+		for i, arg := range args {
+			strs[i] = all[off : off+len(arg)]
+			off += len(arg)
+		}
+	} else { //separate strings, so keeping one argument doesn't keep all of them alive
+		for i, arg := range args {
+			strs[i] = string(arg)
+		}
+	}
+
+	val := Value{
+		Type:  "array",
+		Array: make([]Value, len(args)),
+	}
+	for i := range strs {
+		val.Array[i] = Value{Type: "bulk", Bulk: &strs[i]}
+	}
+
+	return val
+}
+
+// ReadInline reads an inline command. An empty line gives an empty array.
+func (resp *Resp) ReadInline() (Value, error) {
+	line, err := resp.readInlineLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	if bytes.ContainsAny(line, "\"'") { //quoting is rare enough to not be worth a fast path
+		args, ok := utils.SplitArgs(string(line))
+		if !ok {
+			return Value{}, &ProtocolError{Msg: "unbalanced quotes in request"}
+		}
+
+		val := Value{
+			Type:  "array",
+			Array: make([]Value, len(args)),
+		}
+		for i := range args {
+			val.Array[i] = Value{Type: "bulk", Bulk: &args[i]}
+		}
+		return val, nil
+	}
+
+	resp.args = resp.args[:0]
+	for i := 0; i < len(line); {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isInlineSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			resp.args = append(resp.args, line[start:i])
+		}
+	}
+
+	return commandValue(resp.args), nil
+}
+
+// readInlineLine reads the line of an inline command without its line ending. The line
+// points into the reader's buffer or into the reused argument buffer when it didn't fit,
+// so it's only valid until the next read.
+func (resp *Resp) readInlineLine() ([]byte, error) {
+	line, err := resp.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		if cap(resp.argBuf) > ARG_BUF_KEEP_MAX {
+			resp.argBuf = nil
+		}
+		resp.argBuf = append(resp.argBuf[:0], line...)
+		for err == bufio.ErrBufferFull && len(resp.argBuf) <= INLINE_MAX_SIZE {
+			line, err = resp.reader.ReadSlice('\n')
+			resp.argBuf = append(resp.argBuf, line...)
+		}
+		line = resp.argBuf
+	}
+	if len(line) > INLINE_MAX_SIZE+2 || err == bufio.ErrBufferFull {
+		return nil, &ProtocolError{Msg: "too big inline request"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// isInlineSpace reports whether c separates the arguments of an inline command, the
+// same characters utils.SplitArgs splits on.
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// readMultibulk reads a command sent as a RESP array, which may only hold bulk strings,
+// into the reused argument buffer. Like redis, a null or empty array is an empty request.
+func (resp *Resp) readMultibulk() ([][]byte, error) {
+	if err := resp.expect(ARRAY); err != nil {
+		return nil, err
+	}
+
+	length, err := resp.readLength(resp.MaxMultibulkLen, "invalid multibulk length")
+	if err != nil {
+		return nil, err
+	}
+
+	if cap(resp.argBuf) > ARG_BUF_KEEP_MAX {
+		resp.argBuf = nil
+	}
+	resp.argBuf = resp.argBuf[:0]
+	resp.argEnds = resp.argEnds[:0]
+
+	for i := 0; i < length; i++ {
+		if err := resp.expect(BULK); err != nil {
+			return nil, err
+		}
+
+		bulkLen, err := resp.readLength(resp.MaxBulkLen, "invalid bulk length")
 		if err != nil {
-			return nil, 0, err
+			return nil, err
+		}
+		if bulkLen < 0 {
+			return nil, &ProtocolError{Msg: "invalid bulk length"}
 		}
-		numOfBytes++
-		line = append(line, by)
 
-		if len(line) >= 2 && line[len(line)-2] == '\r' { //checking if we reached '\r' which means the end of a RESP statement
-			break
+		if err := resp.readArg(bulkLen); err != nil {
+			return nil, err
 		}
+		resp.argEnds = append(resp.argEnds, len(resp.argBuf))
+	}
 
+	//only slice the buffer once it's done growing
+	resp.args = resp.args[:0]
+	start := 0
+	for _, end := range resp.argEnds {
+		resp.args = append(resp.args, resp.argBuf[start:end:end])
+		start = end
 	}
 
-	return line[:len(line)-2], numOfBytes, nil
+	return resp.args, nil
 }
 
-func (resp *Resp) ReadInt() (int, int, error) {
-	line, numOfBytes, err := resp.ReadLine()
+// readArg appends a bulk string's payload to the argument buffer and checks its trailing
+// CRLF. The buffer grows a chunk at a time as data arrives, so a length alone can't make
+// us allocate up to the limit.
+func (resp *Resp) readArg(length int) error {
+	for left := length; left > 0; {
+		chunk := min(left, BULK_PREALLOC_MAX)
+		start := len(resp.argBuf)
+		resp.argBuf = slices.Grow(resp.argBuf, chunk)[:start+chunk]
+		if _, err := io.ReadFull(resp.reader, resp.argBuf[start:]); err != nil {
+			return err
+		}
+		left -= chunk
+	}
+
+	for _, want := range []byte{'\r', '\n'} {
+		by, err := resp.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if by != want {
+			return &ProtocolError{Msg: "expected CRLF after bulk string"}
+		}
+	}
+	return nil
+}
+
+// expect reads the type byte of the next value, which must be want.
+func (resp *Resp) expect(want byte) error {
+	byteType, err := resp.reader.ReadByte()
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
 
-	num, err := strconv.Atoi(string(line))
+	if byteType != want {
+		return &ProtocolError{Msg: fmt.Sprintf("expected '%c', got '%c'", want, byteType)}
+	}
+	return nil
+}
+
+// readLength reads the length line of an array or bulk string. -1 is a null, anything
+// below that or above limit is refused with msg.
+func (resp *Resp) readLength(limit int, msg string) (int, error) {
+	length, _, err := resp.ReadInt()
+	if err == errInvalidInt {
+		return 0, &ProtocolError{Msg: msg}
+	}
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
-	return num, numOfBytes, nil
+	if length < -1 || length > limit {
+		return 0, &ProtocolError{Msg: msg}
+	}
+	return length, nil
 }
 
+// Read reads any RESP2 value, including null bulk strings and arrays.
 func (resp *Resp) Read() (Value, error) {
 	byteType, err := resp.reader.ReadByte()
 
@@ -65,23 +368,44 @@ func (resp *Resp) Read() (Value, error) {
 		}
 
 		return val, nil
+	case STRING, ERROR:
+		line, _, err := resp.ReadLine()
+		if err != nil {
+			return Value{}, err
+		}
+		str := string(line)
+		if byteType == ERROR {
+			return Value{Type: "error", String: &str}, nil
+		}
+		return Value{Type: "string", String: &str}, nil
+	case INTEGER:
+		line, _, err := resp.ReadLine()
+		if err != nil {
+			return Value{}, err
+		}
+		num, err := strconv.ParseInt(string(line), 10, 64)
+		if err != nil {
+			return Value{}, &ProtocolError{Msg: "invalid integer"}
+		}
+		return Value{Type: "integer", Number: &num}, nil
 	default:
-		fmt.Printf("Unknown type: %v", string(byteType))
-		return Value{}, err
+		return Value{}, &ProtocolError{Msg: fmt.Sprintf("unknown type '%c'", byteType)}
 	}
 }
 
 func (resp *Resp) ReadArray() (Value, error) {
-	val := Value{
-		Type: "array",
-	}
-
-	length, _, err := resp.ReadInt() //num of elements kinda
+	length, err := resp.readLength(resp.MaxMultibulkLen, "invalid multibulk length")
 	if err != nil {
 		return Value{}, err
 	}
+	if length == -1 {
+		return Value{Type: "nullarray"}, nil
+	}
 
-	val.Array = make([]Value, length)
+	val := Value{
+		Type:  "array",
+		Array: make([]Value, 0, min(length, ARRAY_PREALLOC_MAX)), //grown as elements actually arrive
+	}
 
 	for i := 0; i < length; i++ {
 		value, err := resp.Read()
@@ -89,29 +413,53 @@ func (resp *Resp) ReadArray() (Value, error) {
 			return Value{}, err
 		}
 
-		val.Array[i] = value
+		val.Array = append(val.Array, value)
 	}
 
 	return val, nil
 }
 
 func (resp *Resp) ReadBulk() (Value, error) {
-	val := Value{
-		Type: "bulk",
-	}
-
-	length, _, err := resp.ReadInt()
+	length, err := resp.readLength(resp.MaxBulkLen, "invalid bulk length")
 	if err != nil {
-		return val, err
+		return Value{}, err
+	}
+	if length == -1 {
+		return Value{Type: "null"}, nil
 	}
 
-	bulk := make([]byte, length)
-	resp.reader.Read(bulk)
+	return resp.readBulkBody(length)
+}
 
-	bulkVal := string(bulk)
-	val.Bulk = &bulkVal
+// readBulkBody reads the payload of a bulk string along with its trailing CRLF. Small
+// bulks are read in one go; big ones grow with the data that actually arrives, so a
+// length alone can't make us allocate up to the limit.
+func (resp *Resp) readBulkBody(length int) (Value, error) {
+	var bulk []byte
+	if length <= BULK_PREALLOC_MAX {
+		//a single Read stops at whatever is buffered, which with pipelining can be half a value
+		bulk = make([]byte, length+2)
+		if _, err := io.ReadFull(resp.reader, bulk); err != nil {
+			return Value{}, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, resp.reader, int64(length)+2); err != nil {
+			return Value{}, err
+		}
+		bulk = buf.Bytes()
+	}
 
-	resp.ReadLine() //read till the end of the line
+	if bulk[length] != '\r' || bulk[length+1] != '\n' {
+		return Value{}, &ProtocolError{Msg: "expected CRLF after bulk string"}
+	}
 
-	return val, nil
+	bulkVal := string(bulk[:length])
+	return Value{Type: "bulk", Bulk: &bulkVal}, nil
+}
+
+// Buffered returns how many bytes were received but not parsed yet. Zero after parsing a
+// command means the client has nothing more pipelined for now.
+func (resp *Resp) Buffered() int {
+	return resp.reader.Buffered()
 }
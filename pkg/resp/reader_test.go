@@ -0,0 +1,145 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newStringReader(input string, size int) *Resp {
+	return NewResp(bufio.NewReaderSize(strings.NewReader(input), size))
+}
+
+// args returns the arguments of a command read by ReadRequest.
+func args(t *testing.T, v Value) []string {
+	t.Helper()
+	if v.Type != "array" {
+		t.Fatalf("got a %s, want an array", v.Type)
+	}
+	strs := []string{}
+	for _, arg := range v.Array {
+		strs = append(strs, *arg.Bulk)
+	}
+	return strs
+}
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		input string
+		want  [][]string
+	}{
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nvalue\r\n", [][]string{{"SET", "k", "value"}}},
+		{"*1\r\n$0\r\n\r\n", [][]string{{""}}},
+		{"*0\r\n*-1\r\n", [][]string{{}, {}}},
+		{"*2\r\n$3\r\nGET\r\n$4\r\na\r\nb\r\n", [][]string{{"GET", "a\r\nb"}}},
+		{"SET k value\r\n", [][]string{{"SET", "k", "value"}}},
+		{"  GET \t k  \n", [][]string{{"GET", "k"}}},
+		{"\r\n\n", [][]string{{}, {}}},
+		{`SET k "a b\r\n" 'c d'` + "\r\n", [][]string{{"SET", "k", "a b\r\n", "c d"}}},
+		{"PING\r\n*1\r\n$4\r\nPING\r\nPING\r\n", [][]string{{"PING"}, {"PING"}, {"PING"}}},
+	}
+
+	for _, test := range tests {
+		r := newStringReader(test.input, 16)
+		for i, want := range test.want {
+			v, err := r.ReadRequest()
+			if err != nil {
+				t.Fatalf("%q: request %d: %v", test.input, i, err)
+			}
+			if got := args(t, v); !slices.Equal(got, want) {
+				t.Errorf("%q: request %d: got %q, want %q", test.input, i, got, want)
+			}
+		}
+		if _, err := r.ReadRequest(); err != io.EOF {
+			t.Errorf("%q: got %v after the last request, want EOF", test.input, err)
+		}
+	}
+}
+
+// The arguments of a command must survive reading the next one, as handlers keep them.
+func TestReadRequestArgsOutliveBuffers(t *testing.T) {
+	r := newStringReader("*2\r\n$3\r\nGET\r\n$1\r\na\r\nGET b\r\n*2\r\n$3\r\nSET\r\n$1\r\nc\r\n", 16)
+	var got [][]string
+	for i := 0; i < 3; i++ {
+		v, err := r.ReadRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, args(t, v))
+	}
+	want := [][]string{{"GET", "a"}, {"GET", "b"}, {"SET", "c"}}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("request %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadRequestLongInline(t *testing.T) {
+	arg := strings.Repeat("x", INLINE_MAX_SIZE-10)
+	r := newStringReader("ECHO "+arg+"\r\nPING\r\n", 16)
+	for _, want := range [][]string{{"ECHO", arg}, {"PING"}} {
+		v, err := r.ReadRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := args(t, v); !slices.Equal(got, want) {
+			t.Errorf("got %d args, want %d", len(got), len(want))
+		}
+	}
+}
+
+func TestReadRequestErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"*a\r\n", "invalid multibulk length"},
+		{"*-2\r\n", "invalid multibulk length"},
+		{"*1048577\r\n", "invalid multibulk length"},
+		{"*1\r\n:1\r\n", "expected '$', got ':'"},
+		{"*1\r\n$-1\r\n", "invalid bulk length"},
+		{"*1\r\n$x\r\n", "invalid bulk length"},
+		{"*1\r\n$536870913\r\n", "invalid bulk length"},
+		{"*1\r\n$3\r\nGETX\r\n", "expected CRLF after bulk string"},
+		{"*1\n", "expected CRLF"},
+		{"*1" + strings.Repeat("1", 100) + "\r\n", "too big count string"},
+		{"GET \"k\r\n", "unbalanced quotes in request"},
+		{strings.Repeat("x", INLINE_MAX_SIZE+1) + "\r\n", "too big inline request"},
+		{strings.Repeat("x", 3*INLINE_MAX_SIZE), "too big inline request"},
+	}
+
+	for _, test := range tests {
+		_, err := newStringReader(test.input, 16).ReadRequest()
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) || protoErr.Msg != test.want {
+			t.Errorf("%.40q: got %v, want %q", test.input, err, test.want)
+		}
+	}
+}
+
+func TestReadRequestMaxBulkLen(t *testing.T) {
+	r := newStringReader("*1\r\n$5\r\nhello\r\n*1\r\n$6\r\nhello!\r\n", 16)
+	r.MaxBulkLen = 5
+	if _, err := r.ReadRequest(); err != nil {
+		t.Fatalf("bulk at the limit: %v", err)
+	}
+	var protoErr *ProtocolError
+	if _, err := r.ReadRequest(); !errors.As(err, &protoErr) {
+		t.Errorf("bulk past the limit: got %v, want a protocol error", err)
+	}
+}
+
+// A request cut short is a broken connection, not a protocol error.
+func TestReadRequestTruncated(t *testing.T) {
+	for _, input := range []string{"*2\r\n$3\r\nGET\r\n", "*1\r\n$3\r\nGE", "GET k"} {
+		_, err := newStringReader(input, 16).ReadRequest()
+		var protoErr *ProtocolError
+		if err == nil || errors.As(err, &protoErr) {
+			t.Errorf("%q: got %v, want an I/O error", input, err)
+		}
+	}
+}
@@ -6,14 +6,76 @@ const (
 	INTEGER = ':'
 	BULK    = '$'
 	ARRAY   = '*'
+
+	//RESP3 types, sent only to clients that switched protocols with HELLO 3
+	MAP       = '%'
+	SET       = '~'
+	NULL      = '_'
+	BOOLEAN   = '#'
+	DOUBLE    = ','
+	BIGNUM    = '('
+	VERBATIM  = '='
+	ATTRIBUTE = '|'
+	PUSH      = '>'
+)
+
+// ERROR_CODES are the error prefixes clients tell apart, like "WRONGTYPE Operation against
+// a key holding the wrong kind of value". Errors that don't start with one of them are sent
+// as generic "ERR ..." errors.
+var ERROR_CODES = map[string]bool{
+	"ERR":        true,
+	"WRONGTYPE":  true,
+	"NOSCRIPT":   true,
+	"NOAUTH":     true,
+	"WRONGPASS":  true,
+	"NOPERM":     true,
+	"NOPROTO":    true,
+	"OOM":        true,
+	"BUSYKEY":    true,
+	"BUSYGROUP":  true,
+	"NOGROUP":    true,
+	"EXECABORT":  true,
+	"LOADING":    true,
+	"READONLY":   true,
+	"BUSY":       true,
+	"NOTBUSY":    true,
+	"UNBLOCKED":  true,
+	"CROSSSLOT":  true,
+	"MOVED":      true,
+	"ASK":        true,
+	"MASTERDOWN": true,
+}
+
+// Protocol versions a connection can speak. Every connection starts with RESP2.
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
+// Value is a single reply or request. Besides the RESP2 types, a reply can be one of the
+// RESP3 types, which are turned into their closest RESP2 equivalent for older clients:
+//
+//	nullarray a missing array, like a blocking read that timed out; *-1 under RESP2
+//	map      Array holds keys and values interleaved; a flat array under RESP2
+//	set      Array holds the members; an array under RESP2
+//	push     Array holds the message; an array under RESP2
+//	boolean  Bool; the integer 1 or 0 under RESP2
+//	double   Double; a bulk string under RESP2
+//	bignum   Bulk holds the digits; a bulk string under RESP2
+//	verbatim Bulk holds the text and Format its 3 letter format; a bulk string under RESP2
+//
+// Attrs, also interleaved keys and values, are sent ahead of the reply under RESP3 and
+// dropped under RESP2.
 type Value struct {
 	Type   string
 	String *string
 	Number *int64
 	Bulk   *string
 	Array  []Value
+	Bool   *bool
+	Double *float64
+	Format string
+	Attrs  []Value
 }
 
 //type Array []Value
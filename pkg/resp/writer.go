@@ -1,92 +1,270 @@
 package resp
 
 import (
+	"bufio"
+	"bytes"
 	"io"
+	"math"
 	"strconv"
+	"strings"
 )
 
+// Writer streams replies straight into a connection's buffered writer, without building
+// them up in intermediate byte slices first.
 type Writer struct {
-	writer io.Writer
+	writer *bufio.Writer
+	Proto  int //protocol version replies are encoded for
+	enc    encoder
 }
 
+// NewWriter encodes replies into w, reusing it as the buffer if it's already buffered.
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{writer: w}
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+
+	writer := &Writer{writer: bw, Proto: RESP2}
+	writer.enc.dst = bw
+	return writer
 }
 
+// Write encodes v into the buffer. It's only sent once the buffer fills up or Flush is called.
 func (w *Writer) Write(v Value) error {
-	var bytes = v.Marshal()
+	w.enc.proto = w.Proto
+	w.enc.err = nil
+	w.enc.value(&v)
 
-	_, err := w.writer.Write(bytes)
-	if err != nil {
-		return err
-	}
+	return w.enc.err
+}
 
-	return nil
+func (w *Writer) Flush() error {
+	return w.writer.Flush()
 }
 
+// Marshal encodes v for a RESP2 client.
 func (v Value) Marshal() []byte {
+	return v.MarshalProto(RESP2)
+}
+
+// MarshalProto encodes v for a client speaking the given protocol version, turning RESP3
+// types into their RESP2 equivalents when needed.
+func (v Value) MarshalProto(proto int) []byte {
+	var buf bytes.Buffer
+	enc := encoder{dst: &buf, proto: proto}
+	enc.value(&v)
+
+	return buf.Bytes()
+}
+
+// byteWriter is what replies are encoded into, a bufio.Writer or a bytes.Buffer.
+type byteWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// encoder writes values piece by piece. num and float are scratch space for formatting
+// lengths and numbers, kept here so they don't need allocating for every reply.
+type encoder struct {
+	dst   byteWriter
+	proto int
+	num   [24]byte
+	float [32]byte
+	err   error //the first write error, later writes are skipped
+}
+
+func (enc *encoder) value(v *Value) {
+	if enc.proto == RESP3 && len(v.Attrs) > 0 {
+		enc.aggregate(ATTRIBUTE, len(v.Attrs)/2, v.Attrs)
+	}
+
 	switch v.Type {
 	case "array":
-		return v.marshalArray()
+		enc.aggregate(ARRAY, len(v.Array), v.Array)
+	case "map":
+		if enc.proto == RESP3 {
+			enc.aggregate(MAP, len(v.Array)/2, v.Array)
+		} else {
+			enc.aggregate(ARRAY, len(v.Array), v.Array)
+		}
+	case "set":
+		enc.aggregate(enc.resp3(SET, ARRAY), len(v.Array), v.Array)
+	case "push":
+		enc.aggregate(enc.resp3(PUSH, ARRAY), len(v.Array), v.Array)
 	case "bulk":
-		return v.marshalBulk()
+		enc.bulk(*v.Bulk)
 	case "string":
-		return v.marshalString()
+		enc.line(STRING, *v.String)
+	case "integer":
+		enc.integer(INTEGER, *v.Number)
 	case "null":
-		return v.marshallNull()
+		if enc.proto == RESP3 {
+			enc.writeString("_\r\n")
+		} else {
+			enc.writeString("$-1\r\n")
+		}
+	case "nullarray":
+		if enc.proto == RESP3 {
+			enc.writeString("_\r\n")
+		} else {
+			enc.writeString("*-1\r\n")
+		}
 	case "error":
-		return v.marshallError()
-	default:
-		return []byte{}
+		enc.error(*v.String)
+	case "boolean":
+		enc.boolean(*v.Bool)
+	case "double":
+		enc.double(*v.Double)
+	case "bignum":
+		if enc.proto == RESP3 {
+			enc.line(BIGNUM, *v.Bulk)
+		} else {
+			enc.bulk(*v.Bulk)
+		}
+	case "verbatim":
+		enc.verbatim(v.Format, *v.Bulk)
+	default: //no type, nothing to send (e.g. commands that pushed their own replies)
 	}
 }
 
-func (v Value) marshalString() []byte {
-	var bytes []byte
-	str := *v.String
-	bytes = append(bytes, STRING)
-	bytes = append(bytes, str...)
-	bytes = append(bytes, '\r', '\n')
+// resp3 picks the RESP3 type byte, or its RESP2 fallback for older clients.
+func (enc *encoder) resp3(typ byte, fallback byte) byte {
+	if enc.proto == RESP3 {
+		return typ
+	}
+	return fallback
+}
 
-	return bytes
+// aggregate encodes arrays, sets, pushes, maps and attributes. n is the length sent, which
+// for maps and attributes counts pairs rather than elements.
+func (enc *encoder) aggregate(prefix byte, n int, elems []Value) {
+	enc.integer(prefix, int64(n))
+	for i := range elems {
+		enc.value(&elems[i])
+	}
 }
 
-func (v Value) marshalBulk() []byte {
-	var bytes []byte
-	bulk := *v.Bulk
-	bytes = append(bytes, BULK)
-	bytes = append(bytes, strconv.Itoa(len(bulk))...)
-	bytes = append(bytes, '\r', '\n')
-	bytes = append(bytes, bulk...)
-	bytes = append(bytes, '\r', '\n')
+func (enc *encoder) bulk(s string) {
+	enc.integer(BULK, int64(len(s)))
+	enc.writeString(s)
+	enc.writeString("\r\n")
+}
 
-	return bytes
+func (enc *encoder) line(prefix byte, s string) {
+	enc.writeByte(prefix)
+	enc.writeLine(s)
+	enc.writeString("\r\n")
 }
 
-func (v Value) marshalArray() []byte {
-	len := len(v.Array)
-	var bytes []byte
-	bytes = append(bytes, ARRAY)
-	bytes = append(bytes, strconv.Itoa(len)...)
-	bytes = append(bytes, '\r', '\n')
+// integer writes prefix, n and CRLF, which is also how every length header looks.
+func (enc *encoder) integer(prefix byte, n int64) {
+	buf := append(enc.num[:0], prefix)
+	buf = strconv.AppendInt(buf, n, 10)
+	buf = append(buf, '\r', '\n')
+	enc.write(buf)
+}
 
-	for i := 0; i < len; i++ {
-		bytes = append(bytes, v.Array[i].Marshal()...)
+// error sends the error as is if it starts with an error code, and as a generic ERR error
+// otherwise.
+func (enc *encoder) error(msg string) {
+	enc.writeByte(ERROR)
+	code, _, _ := strings.Cut(msg, " ")
+	if !ERROR_CODES[code] {
+		enc.writeString("ERR ")
 	}
+	enc.writeLine(msg)
+	enc.writeString("\r\n")
+}
 
-	return bytes
+func (enc *encoder) boolean(b bool) {
+	switch {
+	case enc.proto == RESP3 && b:
+		enc.writeString("#t\r\n")
+	case enc.proto == RESP3:
+		enc.writeString("#f\r\n")
+	case b:
+		enc.writeString(":1\r\n")
+	default:
+		enc.writeString(":0\r\n")
+	}
+}
+
+func (enc *encoder) double(f float64) {
+	var buf []byte
+	switch {
+	case math.IsInf(f, 1):
+		buf = append(enc.float[:0], "inf"...)
+	case math.IsInf(f, -1):
+		buf = append(enc.float[:0], "-inf"...)
+	case math.IsNaN(f):
+		buf = append(enc.float[:0], "nan"...)
+	default:
+		buf = strconv.AppendFloat(enc.float[:0], f, 'f', -1, 64)
+	}
+
+	if enc.proto == RESP3 {
+		enc.writeByte(DOUBLE)
+		enc.write(buf)
+		enc.writeString("\r\n")
+		return
+	}
+
+	enc.integer(BULK, int64(len(buf)))
+	enc.write(buf)
+	enc.writeString("\r\n")
+}
+
+// verbatim encodes a verbatim string, whose payload starts with its format, like "txt:".
+// RESP2 clients get a plain bulk string.
+func (enc *encoder) verbatim(format string, text string) {
+	if enc.proto != RESP3 {
+		enc.bulk(text)
+		return
+	}
+
+	if format == "" {
+		format = "txt"
+	}
+	enc.integer(VERBATIM, int64(len(format)+1+len(text)))
+	enc.writeString(format)
+	enc.writeByte(':')
+	enc.writeString(text)
+	enc.writeString("\r\n")
+}
+
+func (enc *encoder) write(p []byte) {
+	if enc.err == nil {
+		_, enc.err = enc.dst.Write(p)
+	}
 }
 
-func (v Value) marshallError() []byte {
-	var bytes []byte
-	str := *v.String
-	bytes = append(bytes, ERROR)
-	bytes = append(bytes, str...)
-	bytes = append(bytes, '\r', '\n')
+// writeLine writes the payload of a simple string or error, which ends at the first CRLF.
+// Like redis, newlines are turned into spaces, so a message quoting what a client sent
+// can't end the reply early and smuggle in one of its own.
+func (enc *encoder) writeLine(s string) {
+	if !strings.ContainsAny(s, "\r\n") {
+		enc.writeString(s)
+		return
+	}
 
-	return bytes
+	line := []byte(s)
+	for i, c := range line {
+		if c == '\r' || c == '\n' {
+			line[i] = ' '
+		}
+	}
+	enc.write(line)
 }
 
-func (v Value) marshallNull() []byte {
-	return []byte("$-1\r\n")
+func (enc *encoder) writeString(s string) {
+	if enc.err == nil {
+		_, enc.err = enc.dst.WriteString(s)
+	}
+}
+
+func (enc *encoder) writeByte(b byte) {
+	if enc.err == nil {
+		enc.err = enc.dst.WriteByte(b)
+	}
 }
@@ -0,0 +1,96 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func TestMarshal(t *testing.T) {
+	n := int64(-42)
+	yes := true
+	half := 0.5
+	tests := []struct {
+		name  string
+		value Value
+		resp2 string
+		resp3 string
+	}{
+		{"string", Value{Type: "string", String: str("OK")}, "+OK\r\n", "+OK\r\n"},
+		{"bulk", Value{Type: "bulk", Bulk: str("a\r\nb")}, "$4\r\na\r\nb\r\n", "$4\r\na\r\nb\r\n"},
+		{"empty bulk", Value{Type: "bulk", Bulk: str("")}, "$0\r\n\r\n", "$0\r\n\r\n"},
+		{"integer", Value{Type: "integer", Number: &n}, ":-42\r\n", ":-42\r\n"},
+		{"null", Value{Type: "null"}, "$-1\r\n", "_\r\n"},
+		{"null array", Value{Type: "nullarray"}, "*-1\r\n", "_\r\n"},
+		{"error", Value{Type: "error", String: str("bad thing")}, "-ERR bad thing\r\n", "-ERR bad thing\r\n"},
+		{"error code", Value{Type: "error", String: str("WRONGTYPE no")}, "-WRONGTYPE no\r\n", "-WRONGTYPE no\r\n"},
+		{"boolean", Value{Type: "boolean", Bool: &yes}, ":1\r\n", "#t\r\n"},
+		{"double", Value{Type: "double", Double: &half}, "$3\r\n0.5\r\n", ",0.5\r\n"},
+		{"array", Value{Type: "array", Array: []Value{{Type: "bulk", Bulk: str("a")}, {Type: "null"}}},
+			"*2\r\n$1\r\na\r\n$-1\r\n", "*2\r\n$1\r\na\r\n_\r\n"},
+		{"map", Value{Type: "map", Array: []Value{{Type: "bulk", Bulk: str("k")}, {Type: "integer", Number: &n}}},
+			"*2\r\n$1\r\nk\r\n:-42\r\n", "%1\r\n$1\r\nk\r\n:-42\r\n"},
+		{"verbatim", Value{Type: "verbatim", Bulk: str("hi")}, "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{"no type", Value{}, "", ""},
+	}
+
+	for _, test := range tests {
+		if got := string(test.value.MarshalProto(RESP2)); got != test.resp2 {
+			t.Errorf("%s over RESP2: got %q, want %q", test.name, got, test.resp2)
+		}
+		if got := string(test.value.MarshalProto(RESP3)); got != test.resp3 {
+			t.Errorf("%s over RESP3: got %q, want %q", test.name, got, test.resp3)
+		}
+	}
+}
+
+// Simple strings and errors end at the first CRLF, so newlines in them, say from an
+// argument quoted in an error, mustn't make it out as is.
+func TestMarshalLineBreaks(t *testing.T) {
+	tests := []struct {
+		value Value
+		want  string
+	}{
+		{Value{Type: "string", String: str("a\r\n+OK")}, "+a  +OK\r\n"},
+		{Value{Type: "error", String: str("unknown 'x\r\n-ERR'")}, "-ERR unknown 'x  -ERR'\r\n"},
+		{Value{Type: "error", String: str("\nWRONGTYPE")}, "-ERR  WRONGTYPE\r\n"},
+		{Value{Type: "string", String: str("bin\xff\r")}, "+bin\xff \r\n"},
+	}
+
+	for _, test := range tests {
+		if got := string(test.value.Marshal()); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+// Whatever is written must read back as the same number of values, one per write.
+func TestWriteReadBack(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	messages := []string{"OK", "a\r\nb", "\r\n\r\n", strings.Repeat("x\n", 100)}
+	for _, msg := range messages {
+		w.Write(Value{Type: "string", String: str(msg)})
+		w.Write(Value{Type: "error", String: str(msg)})
+	}
+	w.Flush()
+
+	r := NewResp(bufio.NewReader(&buf))
+	for i := 0; i < 2*len(messages); i++ {
+		v, err := r.Read()
+		if err != nil {
+			t.Fatalf("value %d: %v", i, err)
+		}
+		if v.Type != "string" && v.Type != "error" {
+			t.Errorf("value %d: got a %s", i, v.Type)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left over after reading back every value", buf.Len())
+	}
+}
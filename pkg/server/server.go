@@ -2,85 +2,416 @@ package server
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"reredis/pkg/config"
 	"reredis/pkg/handler"
+	"reredis/pkg/pubsub"
 	"reredis/pkg/resp"
 	"reredis/pkg/store"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-func StartServer() {
-	fmt.Println("Listening on tcp:6379")
+const (
+	IO_BUF_SIZE         = 16 * 1024 //size of the read and write buffers of each connection
+	CLIENT_IN_BUFFER    = 128       //commands read ahead of the one running
+	CLOSE_FLUSH_TIMEOUT = time.Second
+)
 
-	//create
-	l, err := net.Listen("tcp", ":6379")
-	if err != nil {
-		fmt.Println(err)
-		return
+// Server accepts connections on the configured addresses and hands them to the handler.
+type Server struct {
+	handler   *handler.Handler
+	tlsConfig atomic.Pointer[tls.Config] //certificates and settings for new TLS connections
+
+	mutex     sync.Mutex
+	listeners []net.Listener //replaced when bind or port change
+	conns     map[*handler.Client]*connection
+	stopping  bool            //shutting down, so nothing new is accepted
+	caller    *handler.Client //the client that sent SHUTDOWN, if any
+	exit      chan error      //what StartServer returns: nil after a shutdown, or why we can't go on
+}
+
+// connection is a client connection, tracked so shutting down can wait for it.
+type connection struct {
+	conn   net.Conn
+	client *handler.Client
+	closed chan struct{} //closed once its replies are written and it's closed
+}
+
+// StartServer serves clients on every address in cfg until the server is shut down, with
+// SHUTDOWN or a SIGTERM or SIGINT, or a listener fails.
+func StartServer(cfg *config.Config) error {
+	if err := os.Chdir(cfg.Dir); err != nil {
+		return fmt.Errorf("can't chdir to '%s': %w", cfg.Dir, err)
 	}
 
-	storeObj := store.NewStore()
-	handlerObj := handler.NewHandler(storeObj)
+	ps := pubsub.NewPubSub()
+	databases := store.NewDatabases(&cfg.Config)
+	databases.PubSub = ps
 
-	//cleanup goroutine goes here ig
-	go store.CleanUp(storeObj)
+	srv := &Server{
+		handler: handler.NewHandler(cfg, databases, ps),
+		conns:   map[*handler.Client]*connection{},
+		exit:    make(chan error, 1),
+	}
+	srv.handler.OnConfigSet = srv.applyConfig
+	if err := srv.loadTLS(cfg); err != nil {
+		return err
+	}
+	if cfg.ACLFile != "" {
+		if err := srv.handler.ACL.LoadFile(cfg.ACLFile); err != nil {
+			return fmt.Errorf("can't load the ACL file: %w", err)
+		}
+	}
+	srv.handler.OnShutdown = func(client *handler.Client, now bool) error {
+		return srv.Shutdown(client, now, fmt.Sprintf("User requested shutdown (client id=%d)", client.ID))
+	}
 
-	for {
-		//listen and accept incoming connections
-		conn, err := l.Accept() //this blocks
+	if err := srv.listen(cfg); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go srv.handleSignals(signals)
+
+	go store.ActiveExpire(databases)
+
+	return <-srv.exit
+}
+
+// stop makes StartServer return err, unless it's already returning something else.
+func (srv *Server) stop(err error) {
+	select {
+	case srv.exit <- err:
+	default:
+	}
+}
+
+// applyConfig reloads the TLS certificates if CONFIG SET touched any TLS setting, and
+// moves the listeners if it changed where we listen, going back to the old addresses and
+// certificates if the new ones can't be used.
+func (srv *Server) applyConfig(old *config.Config, updated *config.Config, params []string) error {
+	oldTLS := srv.tlsConfig.Load()
+	for _, param := range params {
+		if strings.HasPrefix(param, "tls-") {
+			if err := srv.loadTLS(updated); err != nil {
+				return &config.Error{Source: "CONFIG SET", Text: param, Err: err}
+			}
+			break
+		}
+	}
+
+	param := ""
+	switch {
+	case old.TLSPort != updated.TLSPort:
+		param = "tls-port"
+	case old.Port != updated.Port:
+		param = "port"
+	case !slices.Equal(old.Bind, updated.Bind):
+		param = "bind"
+	default:
+		return nil
+	}
+
+	srv.mutex.Lock()
+	if srv.stopping {
+		srv.mutex.Unlock()
+		srv.tlsConfig.Store(oldTLS)
+		return errors.New("the server is shutting down")
+	}
+	for _, l := range srv.listeners {
+		l.Close()
+	}
+	srv.listeners = nil
+	srv.mutex.Unlock()
+
+	err := srv.listen(updated)
+	if err == nil {
+		return nil
+	}
+	srv.tlsConfig.Store(oldTLS)
+	if restoreErr := srv.listen(old); restoreErr != nil {
+		err = fmt.Errorf("%w, and the old addresses couldn't be restored: %v", err, restoreErr)
+	}
+	return &config.Error{Source: "CONFIG SET", Text: param, Err: err}
+}
+
+// listen opens TCP and TLS listeners on every bind address, or on all interfaces if
+// there are none, and one on the unix socket if there is one, and starts accepting on
+// them. Nothing is left open if any of them fails.
+func (srv *Server) listen(cfg *config.Config) error {
+	if cfg.Port == 0 && cfg.TLSPort == 0 && cfg.UnixSocket == "" {
+		return errors.New("no port or unix socket to listen on")
+	}
+
+	addrs := cfg.Bind
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+
+	listeners := []net.Listener{}
+	open := func(addr string, port int, secure bool) error {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
+		}
+
+		if secure {
+			l = tls.NewListener(l, &tls.Config{GetConfigForClient: srv.getTLSConfig})
+			fmt.Println("Listening on tls:" + l.Addr().String())
+		} else {
+			fmt.Println("Listening on tcp:" + l.Addr().String())
+		}
+		listeners = append(listeners, l)
+		return nil
+	}
+
+	fail := func(err error) error {
+		for _, opened := range listeners {
+			opened.Close()
+		}
+		return err
+	}
+
+	for _, addr := range addrs {
+		if addr == "*" {
+			addr = ""
+		}
+
+		var err error
+		if cfg.Port != 0 {
+			err = open(addr, cfg.Port, false)
+		}
+		if err == nil && cfg.TLSPort != 0 {
+			err = open(addr, cfg.TLSPort, true)
+		}
+		if err != nil {
+			return fail(err)
 		}
+	}
 
-		go handleConn(conn, handlerObj)
+	if cfg.UnixSocket != "" {
+		l, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println("Listening on unix:" + cfg.UnixSocket)
+		listeners = append(listeners, l)
 	}
 
+	srv.mutex.Lock()
+	srv.listeners = append(srv.listeners, listeners...)
+	srv.mutex.Unlock()
+
+	for _, l := range listeners {
+		go srv.serve(l)
+	}
+	return nil
 }
 
-func handleConn(conn net.Conn, handlerObj *handler.Handler) {
-	defer conn.Close()
-	//buf := make([]byte, 1024)
+// listenUnix listens on a unix socket, replacing whatever socket file a previous run left
+// behind. The file is removed again when the listener is closed.
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("can't set the permissions of the unix socket: %w", err)
+		}
+	}
+	return l, nil
+}
 
+func (srv *Server) serve(l net.Listener) {
 	for {
-		r := resp.NewResp(bufio.NewReader(conn))
-		value, err := r.Read()
+		//listen and accept incoming connections, this blocks
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) { //replaced by CONFIG SET, or shutting down
+			return
+		}
 		if err != nil {
-			fmt.Println(err)
+			srv.stop(err)
 			return
 		}
 
-		if value.Type != "array" {
-			fmt.Println("Invalid request, expected array")
-			continue
+		c := &connection{conn: conn, client: srv.handler.NewClient(), closed: make(chan struct{})}
+		if !srv.track(c) {
+			conn.Close()
+			return
+		}
+		go srv.handleConn(c)
+	}
+}
+
+// track registers a new connection, unless we're shutting down.
+func (srv *Server) track(c *connection) bool {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if srv.stopping {
+		return false
+	}
+	srv.conns[c.client] = c
+	return true
+}
+
+func (srv *Server) untrack(c *connection) {
+	srv.mutex.Lock()
+	delete(srv.conns, c.client)
+	srv.mutex.Unlock()
+	close(c.closed)
+}
+
+// request is a command read off a connection. last marks the end of a pipelined batch,
+// when nothing else was buffered after it. err is set instead for a malformed request,
+// which is replied to before closing the connection.
+type request struct {
+	value resp.Value
+	last  bool
+	err   *resp.ProtocolError
+}
+
+// handleConn serves a connection with three goroutines: readLoop parses commands, this one
+// runs them in order, and writeLoop sends the replies. Replies to a pipelined batch are
+// buffered and written together once the batch is done.
+func (srv *Server) handleConn(c *connection) {
+	conn, client, handlerObj := c.conn, c.client, srv.handler
+	defer handlerObj.CloseClient(client)
+
+	if err := srv.handshake(c); err != nil {
+		conn.Close()
+		srv.untrack(c)
+		return
+	}
+
+	go func() {
+		writeLoop(conn, client, srv.farewell)
+		srv.untrack(c)
+	}()
+
+	requests := make(chan request, CLIENT_IN_BUFFER)
+	go readLoop(conn, client, requests, handlerObj)
+
+	for req := range requests {
+		if req.err != nil {
+			errStr := req.err.Error()
+			client.Reply(resp.Value{Type: "error", String: &errStr})
+			break
 		}
 
-		if len(value.Array) == 0 {
-			fmt.Println("Invalid request, expected array length > 0")
+		value := req.value
+		if len(value.Array) == 0 { //like redis, empty requests (blank inline lines, empty or null arrays) get no reply
+			if req.last {
+				client.Flush()
+			}
 			continue
 		}
 
 		command := strings.ToUpper(*value.Array[0].Bulk)
 		args := value.Array[1:]
 
-		writer := resp.NewWriter(conn)
+		result := handlerObj.Dispatch(client, command, args)
+		client.Reply(result)
+		if req.last {
+			client.Flush()
+		}
+	}
+
+	client.Flush()
+}
 
-		handlerFn, ok := handlerObj.HandlerFuncs[command]
-		if !ok {
-			fmt.Println("Invalid command: ", command)
-			str := ""
-			writer.Write(resp.Value{Type: "string", String: &str})
-			continue
+// readLoop parses commands off the connection with a single buffered reader, so bytes of
+// pipelined commands that were read along with the current one aren't lost.
+func readLoop(conn net.Conn, client *handler.Client, requests chan<- request, handlerObj *handler.Handler) {
+	defer close(requests)
+	defer client.Hangup()
+
+	r := resp.NewResp(bufio.NewReaderSize(conn, IO_BUF_SIZE))
+	for {
+		r.MaxBulkLen = handlerObj.Config().ProtoMaxBulkLen //can change with CONFIG SET
+		value, err := r.ReadRequest()
+		var protoErr *resp.ProtocolError
+		if errors.As(err, &protoErr) {
+			select {
+			case requests <- request{err: protoErr}:
+			case <-client.Done:
+			}
+			return
+		}
+		if err != nil { //the peer hung up, the connection broke, or we're shutting down
+			return
 		}
 
-		var result resp.Value
+		select {
+		case requests <- request{value: value, last: r.Buffered() == 0}:
+		case <-client.Done:
+			return
+		}
+	}
+}
 
-		if handlerObj.Store.InMulti && command != handler.EXEC_CMD {
-			result = handlerObj.Store.QMultiCmd(handlerFn, args)
-		} else {
-			result = handlerFn(args)
+// writeLoop writes everything queued for the client, replies and pushed messages alike,
+// so pub/sub messages can be delivered while the connection is waiting on a command.
+// It owns the connection and closes it once the client is done, after whatever farewell
+// returns for it, if anything.
+func writeLoop(conn net.Conn, client *handler.Client, farewell func(*handler.Client) (resp.Value, bool)) {
+	defer conn.Close() //also unblocks the reader if we stopped because the client was too slow
+	bw := bufio.NewWriterSize(conn, IO_BUF_SIZE)
+	writer := resp.NewWriter(bw)
+
+	write := func(out handler.Output) error {
+		writer.Proto = out.Proto
+		if err := writer.Write(out.Value); err != nil {
+			return err
+		}
+		if out.Flush {
+			return writer.Flush()
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case out := <-client.Out:
+			if err := write(out); err != nil {
+				client.Close()
+				return
+			}
+		case <-client.Done:
+			//send off what's left, without waiting forever on a client that stopped reading
+			conn.SetWriteDeadline(time.Now().Add(CLOSE_FLUSH_TIMEOUT))
+			for {
+				select {
+				case out := <-client.Out:
+					if write(out) != nil {
+						return
+					}
+				default:
+					if v, ok := farewell(client); ok {
+						writer.Proto = client.Proto()
+						writer.Write(v)
+					}
+					writer.Flush()
+					return
+				}
+			}
 		}
-		writer.Write(result)
 	}
 }
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reredis/pkg/handler"
+	"reredis/pkg/resp"
+	"syscall"
+	"time"
+)
+
+// handleSignals shuts down gracefully on the first SIGTERM or SIGINT, and gives up on
+// waiting if another one comes in while that's going on.
+func (srv *Server) handleSignals(signals <-chan os.Signal) {
+	name := func(sig os.Signal) string {
+		if sig == syscall.SIGTERM {
+			return "SIGTERM"
+		}
+		return "SIGINT"
+	}
+
+	sig := <-signals
+	go srv.Shutdown(nil, false, "Received "+name(sig))
+
+	sig = <-signals
+	fmt.Println("Received " + name(sig) + " again while shutting down, exiting now")
+	srv.stop(errors.New("shutdown interrupted by " + name(sig)))
+}
+
+// Shutdown stops accepting connections and stops reading from the open ones. Commands
+// clients already sent still run and get their replies, while blocked ones give up. It
+// waits up to shutdown-timeout for that, or not at all if now is set, closes whatever is
+// left and makes StartServer return. Each client is told the server is shutting down
+// right before its connection closes. caller is the client that sent SHUTDOWN, if any,
+// which is waiting on this and so isn't waited for.
+func (srv *Server) Shutdown(caller *handler.Client, now bool, reason string) error {
+	srv.mutex.Lock()
+	if srv.stopping {
+		srv.mutex.Unlock()
+		return errors.New("Shutdown already in progress")
+	}
+	srv.stopping = true
+	srv.caller = caller
+	for _, l := range srv.listeners {
+		l.Close()
+	}
+	srv.listeners = nil
+	conns := make([]*connection, 0, len(srv.conns))
+	for _, c := range srv.conns {
+		conns = append(conns, c)
+	}
+	srv.mutex.Unlock()
+
+	fmt.Println(reason + ", shutting down")
+
+	for _, c := range conns {
+		c.conn.SetReadDeadline(time.Now()) //wakes up the reader, what it already read still runs
+		c.client.Hangup()
+		if now {
+			c.client.Close()
+		}
+	}
+
+	timer := time.NewTimer(srv.handler.Config().ShutdownTimeout)
+	defer timer.Stop()
+	expired := false
+	for _, c := range conns {
+		if c.client == caller {
+			continue
+		}
+		if !expired {
+			select {
+			case <-c.closed:
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		fmt.Printf("Closing client id=%d: in-flight commands didn't finish within shutdown-timeout\n", c.client.ID)
+		c.client.Close()
+		<-c.closed //bounded by CLOSE_FLUSH_TIMEOUT
+	}
+
+	fmt.Println("Server is now ready to exit, bye bye...")
+	srv.stop(nil)
+	return nil
+}
+
+// farewell is the error a client gets as its connection closes while shutting down, so it
+// knows why it was hung up on. Like redis, the client that sent SHUTDOWN gets nothing.
+func (srv *Server) farewell(client *handler.Client) (resp.Value, bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if !srv.stopping || client == srv.caller {
+		return resp.Value{}, false
+	}
+
+	errStr := "Server is shutting down"
+	return resp.Value{
+		Type:   "error",
+		String: &errStr,
+	}, true
+}
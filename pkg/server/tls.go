@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reredis/pkg/config"
+	"time"
+)
+
+// TLS_HANDSHAKE_TIMEOUT bounds how long a TLS client has to complete the handshake.
+const TLS_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+// loadTLS reads the certificates the TLS settings point at and puts them to use for new
+// connections, leaving the ones already established alone. Without a TLS port it only
+// drops the TLS settings in use.
+func (srv *Server) loadTLS(cfg *config.Config) error {
+	if cfg.TLSPort == 0 {
+		srv.tlsConfig.Store(nil)
+		return nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	srv.tlsConfig.Store(tlsConfig)
+	return nil
+}
+
+// getTLSConfig is what TLS listeners use for each handshake, so reloaded certificates
+// are picked up without reopening them.
+func (srv *Server) getTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tlsConfig := srv.tlsConfig.Load()
+	if tlsConfig == nil {
+		return nil, errors.New("TLS isn't configured")
+	}
+	return tlsConfig, nil
+}
+
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file must be set to listen on tls-port")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load the certificate: %w", err)
+	}
+
+	minVersion, maxVersion, err := config.ParseTLSProtocols(cfg.TLSProtocols)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := config.ParseTLSCiphers(cfg.TLSCiphers)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   config.TLS_AUTH_CLIENTS[cfg.TLSAuthClients],
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+		CipherSuites: ciphers,
+	}
+
+	if tlsConfig.ClientAuth != tls.NoClientCert {
+		pool, err := loadCAs(cfg.TLSCACertFile, cfg.TLSCACertDir)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCAs reads the CA certificates in a PEM file and in every file of a directory.
+func loadCAs(file string, dir string) (*x509.CertPool, error) {
+	if file == "" && dir == "" {
+		return nil, errors.New("Either tls-ca-cert-file or tls-ca-cert-dir must be specified when tls-auth-clients is enabled")
+	}
+
+	pool := x509.NewCertPool()
+	if file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the CA certificates: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the CA certificates: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			pem, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("can't load the CA certificates: %w", err)
+			}
+			pool.AppendCertsFromPEM(pem) //like OpenSSL's CA directories, other files are ignored
+		}
+	}
+
+	return pool, nil
+}
+
+// handshake completes the TLS handshake of a new connection, if it's a TLS one, so clients
+// that never finish it don't hold on to a connection.
+func (srv *Server) handshake(c *connection) error {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(TLS_HANDSHAKE_TIMEOUT))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	//a shutdown that started meanwhile stopped the reads with a deadline we just cleared
+	srv.mutex.Lock()
+	if srv.stopping {
+		tlsConn.SetReadDeadline(time.Now())
+	}
+	srv.mutex.Unlock()
+	return nil
+}
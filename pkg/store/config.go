@@ -0,0 +1,49 @@
+package store
+
+import "time"
+
+// Config holds the store's tunables. A Config is never modified once in use: changing
+// settings swaps in a new one, so readers always see a consistent set.
+type Config struct {
+	Databases        int           //logical databases clients can SELECT between
+	DefaultTTL       time.Duration //expiry of strings and hashes written without one, 0 for none
+	InitialMapSize   int           //buckets each keyspace map starts out with
+	Hz               int           //active expiry cycles per second
+	MaxMemory        int64         //bytes, 0 means no limit
+	MaxMemoryPolicy  string
+	MaxMemorySamples int //keys sampled per db when looking for eviction candidates
+	NotifyFlags      int //enabled notify-keyspace-events classes, see ParseNotifyFlags
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Databases:        16,
+		DefaultTTL:       time.Hour,
+		InitialMapSize:   16,
+		Hz:               10,
+		MaxMemory:        0,
+		MaxMemoryPolicy:  MAXMEMORY_NO_EVICTION,
+		MaxMemorySamples: 5,
+		NotifyFlags:      0,
+	}
+}
+
+// Config returns the settings currently in effect.
+func (dbs *Databases) Config() *Config {
+	return dbs.config.Load()
+}
+
+// SetConfig swaps in new settings. The number of databases can't change once created.
+func (dbs *Databases) SetConfig(cfg *Config) {
+	dbs.config.Store(cfg)
+}
+
+// defaultExpiry is when a string or hash written now without an expiry expires, the
+// zero time if there's no default TTL.
+func (store *Store) defaultExpiry(now time.Time) time.Time {
+	ttl := store.Databases.Config().DefaultTTL
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"reredis/pkg/pubsub"
+	"reredis/pkg/resp"
+	"reredis/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Databases holds the logical databases a client can switch between with SELECT.
+// Each one is a fully independent Store.
+type Databases struct {
+	Stores       []*Store
+	Stats        *Stats
+	PubSub       *pubsub.PubSub //where keyspace notifications are published
+	config       atomic.Pointer[Config]
+	expireCursor int //db the active expiry cycle resumes from
+	evictPool    []evictionCandidate
+	evictMutex   sync.Mutex
+}
+
+func NewDatabases(cfg *Config) *Databases {
+	dbs := &Databases{
+		Stores: make([]*Store, cfg.Databases),
+		Stats:  &Stats{},
+	}
+	dbs.config.Store(cfg)
+
+	for i := range dbs.Stores {
+		store := NewStore(cfg.InitialMapSize)
+		store.Index = i
+		store.Databases = dbs
+		store.Stats = dbs.Stats
+		dbs.Stores[i] = store
+	}
+
+	return dbs
+}
+
+// Get returns the database at idx, or false if idx is out of range.
+func (dbs *Databases) Get(idx int) (*Store, bool) {
+	if idx < 0 || idx >= len(dbs.Stores) {
+		return nil, false
+	}
+
+	return dbs.Stores[idx], true
+}
+
+// lockPair write-locks two databases, lowest index first so two commands locking the
+// same pair in opposite directions can't deadlock.
+func lockPair(a *Store, b *Store) {
+	if a.Index > b.Index {
+		a, b = b, a
+	}
+	a.lockAll()
+	if a != b {
+		b.lockAll()
+	}
+}
+
+func unlockPair(a *Store, b *Store) {
+	if a.Index > b.Index {
+		a, b = b, a
+	}
+	if a != b {
+		b.unlockAll()
+	}
+	a.unlockAll()
+}
+
+// maps returns every map in the store, the keyspaces followed by Expires and Meta.
+func (store *Store) maps() []*utils.HashMap {
+	maps := []*utils.HashMap{}
+	for _, ks := range store.keyspaces() {
+		maps = append(maps, ks.hMap)
+	}
+	return append(maps, store.Expires, store.Meta)
+}
+
+// flushLocked drops every key in the store. Callers must hold the write locks.
+// The maps are emptied in place rather than replaced, since the fields pointing at them
+// are read without any lock, and their old buckets are simply left to the GC, so this is
+// already cheap.
+func (store *Store) flushLocked() {
+	store.Meta.Range(func(key string, meta any) bool {
+		store.Stats.UsedMemory.Add(-meta.(*KeyMeta).Size)
+		return true
+	})
+
+	size := store.Databases.Config().InitialMapSize
+	for _, hMap := range store.maps() {
+		*hMap = *utils.NewHashMap(size)
+	}
+}
+
+// parseFlushMode validates the optional ASYNC|SYNC argument of FLUSHDB and FLUSHALL.
+// Since flushing just swaps in fresh maps and lets the GC reclaim the old ones both
+// modes behave the same way.
+func parseFlushMode(cmd string, args []resp.Value) *resp.Value {
+	if len(args) > 1 {
+		errStr := "wrong number of arguments for '" + cmd + "' command"
+		return &resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if len(args) == 1 {
+		mode := strings.ToUpper(*args[0].Bulk)
+		if mode != "ASYNC" && mode != "SYNC" {
+			errStr := "syntax error"
+			return &resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	return nil
+}
+
+// FlushDB removes every key from this database.
+func (store *Store) FlushDB(args []resp.Value) resp.Value {
+	if errVal := parseFlushMode("flushdb", args); errVal != nil {
+		return *errVal
+	}
+
+	store.lockAll()
+	store.flushLocked()
+	store.unlockAll()
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+// FlushAll removes every key from every database.
+func (dbs *Databases) FlushAll(args []resp.Value) resp.Value {
+	if errVal := parseFlushMode("flushall", args); errVal != nil {
+		return *errVal
+	}
+
+	for _, store := range dbs.Stores {
+		store.lockAll()
+		store.flushLocked()
+		store.unlockAll()
+	}
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+// SwapDB exchanges the contents of two databases, so clients connected to one
+// immediately see the data of the other.
+func (dbs *Databases) SwapDB(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'swapdb' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	var pair [2]*Store
+	for i := range pair {
+		idx, err := strconv.Atoi(*args[i].Bulk)
+		if err != nil {
+			errStr := "invalid DB index"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		store, ok := dbs.Get(idx)
+		if !ok {
+			errStr := "DB index is out of range"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		pair[i] = store
+	}
+
+	a, b := pair[0], pair[1]
+	if a != b {
+		//the contents are swapped rather than the maps, like flushLocked
+		lockPair(a, b)
+		bMaps := b.maps()
+		for i, hMap := range a.maps() {
+			*hMap, *bMaps[i] = *bMaps[i], *hMap
+		}
+		unlockPair(a, b)
+	}
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
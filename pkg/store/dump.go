@@ -0,0 +1,217 @@
+package store
+
+import (
+	"reredis/pkg/resp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dump returns the serialized value stored at key, or null if it doesn't exist.
+func (store *Store) Dump(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		errStr := "wrong number of arguments for 'dump' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	now := time.Now()
+
+	store.rLockAll()
+	defer store.rUnlockAll()
+
+	for _, ks := range store.keyspaces() {
+		value, ok := ks.hMap.Get(key)
+		if !ok || isExpired(value, now) {
+			continue
+		}
+
+		payload, ok := serializeValue(value)
+		if !ok {
+			errStr := "INTERNAL ERROR"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		bulk := string(payload)
+		return resp.Value{
+			Type: "bulk",
+			Bulk: &bulk,
+		}
+	}
+
+	return resp.Value{
+		Type: "null",
+	}
+}
+
+// Restore recreates a key from a DUMP payload.
+//
+//	RESTORE key ttl payload [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+//
+// A ttl of 0 restores the key without an expiry, like redis, so it doesn't get default-ttl
+// the way SET without EX does. Lists, streams and geo sets never expire, so they can only
+// be restored with a ttl of 0. IDLETIME and FREQ seed the key's LRU and LFU info for
+// eviction.
+func (store *Store) Restore(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		errStr := "wrong number of arguments for 'restore' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	replace := false
+	absTTL := false
+	idleTime := int64(-1)
+	freq := int64(-1)
+
+	ttl, err := strconv.ParseInt(*args[1].Bulk, 10, 64)
+	if err != nil {
+		errStr := "value is not an integer or out of range"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	if ttl < 0 {
+		errStr := "Invalid TTL value, must be >= 0"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(*args[i].Bulk) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			if i+1 >= len(args) || idleTime != -1 || freq != -1 { //IDLETIME and FREQ are mutually exclusive
+				errStr := "syntax error"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			opt := strings.ToUpper(*args[i].Bulk)
+			i++
+			num, err := strconv.ParseInt(*args[i].Bulk, 10, 64)
+			if err != nil || num < 0 {
+				errStr := "Invalid " + opt + " value, must be >= 0"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			if opt == "IDLETIME" {
+				idleTime = num
+			} else {
+				if num > 255 {
+					errStr := "Invalid FREQ value, must be >= 0 and <= 255"
+					return resp.Value{
+						Type:   "error",
+						String: &errStr,
+					}
+				}
+				freq = num
+			}
+		default:
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	value, err := deserializeValue([]byte(*args[2].Bulk))
+	if err != nil {
+		errStr := err.Error()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	switch value.(type) {
+	case *Deque, *Stream, *GeoSet:
+		if ttl != 0 {
+			errStr := "Lists, streams and geo sets can't expire, restore them with a ttl of 0"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	now := time.Now()
+	var expiresAt time.Time
+	switch {
+	case ttl == 0: //persistent, whatever default-ttl says
+	case absTTL:
+		expiresAt = time.UnixMilli(ttl)
+	default:
+		expiresAt = now.Add(time.Duration(ttl) * time.Millisecond)
+	}
+
+	store.lockAll()
+	defer store.unlockAll()
+
+	if !replace && store.existsLocked(key, now) {
+		errStr := "BUSYKEY Target key name already exists."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	store.deleteLocked(key)
+
+	ok := "OK"
+	if ttl != 0 && !expiresAt.After(now) { //already expired, nothing to create
+		return resp.Value{
+			Type:   "string",
+			String: &ok,
+		}
+	}
+
+	switch v := value.(type) {
+	case ValueStringObj:
+		v.ExpiresAt = expiresAt
+		value = v
+		store.Pairs.Set(key, v)
+	case *HSet:
+		v.ExpiresAt = expiresAt
+		store.Hsets.Set(key, v)
+	case *Deque:
+		store.Lists.Set(key, v)
+	case *Stream:
+		store.Streams.Set(key, v)
+	case *GeoSet:
+		store.Geos.Set(key, v)
+	}
+	store.trackLocked(key, value)
+	store.notify(NOTIFY_GENERIC, "restore", key)
+
+	meta := store.metaLocked(key)
+	if idleTime != -1 {
+		meta.LastAccess = now.Add(-time.Duration(idleTime) * time.Second).UnixMilli()
+	}
+	if freq != -1 {
+		meta.Freq = uint8(freq)
+	}
+
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
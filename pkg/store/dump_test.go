@@ -0,0 +1,111 @@
+package store
+
+import (
+	"bytes"
+	"reredis/pkg/resp"
+	"testing"
+)
+
+// restore runs RESTORE key ttl payload [options...], payloads being binary don't fit run.
+func restore(store *Store, key string, ttl string, payload string, options ...string) resp.Value {
+	return store.Restore(bulkArgs(append([]string{key, ttl, payload}, options...)...))
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		create []string
+		read   string
+	}{
+		{"string", []string{"SET k hello"}, "GET k"},
+		{"hash", []string{"HSET k f1 v1 f2 v2"}, "HGETALL k"},
+		{"list", []string{"RPUSH k a b c", "LPUSH k z"}, "LRANGE k 0 -1"},
+		{"stream", []string{
+			"XADD k 1-1 f v", "XADD k 2-1 f w", "XADD k 3-1 f x", "XDEL k 3-1",
+			"XGROUP CREATE k g 0", "XREADGROUP GROUP g c COUNT 1 STREAMS k >",
+		}, "XINFO STREAM k FULL"},
+		{"geo", []string{"GEOADD k 13.361389 38.115556 Palermo 15.087269 37.502669 Catania"}, "GEOPOS k Palermo Catania"},
+	}
+
+	for _, test := range tests {
+		src := newTestDatabases().Stores[0]
+		for _, line := range test.create {
+			if res := run(src, line); res.Type == "error" {
+				t.Fatalf("%s: %s: %s", test.name, line, *res.String)
+			}
+		}
+		dump := src.Dump(bulkArgs("k"))
+		if dump.Type != "bulk" {
+			t.Fatalf("%s: DUMP replied %s", test.name, dump.Type)
+		}
+
+		dst := newTestDatabases().Stores[0]
+		if res := restore(dst, "k", "0", *dump.Bulk); res.Type != "string" {
+			t.Fatalf("%s: RESTORE replied %s %v", test.name, res.Type, res.String)
+		}
+		want, got := run(src, test.read).Marshal(), run(dst, test.read).Marshal()
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: %s after RESTORE\ngot  %q\nwant %q", test.name, test.read, got, want)
+		}
+
+		if res := restore(dst, "k", "0", *dump.Bulk); res.Type != "error" {
+			t.Errorf("%s: RESTORE over an existing key without REPLACE replied %s", test.name, res.Type)
+		}
+		if res := restore(dst, "k", "0", *dump.Bulk, "REPLACE"); res.Type != "string" {
+			t.Errorf("%s: RESTORE REPLACE replied %s %v", test.name, res.Type, res.String)
+		}
+	}
+}
+
+// A ttl of 0 means the restored key doesn't expire, default-ttl only applies to SET.
+func TestRestoreWithoutTTLPersists(t *testing.T) {
+	src := newTestDatabases().Stores[0]
+	run(src, "SET k v")
+	run(src, "HSET h f v")
+
+	dst := newTestDatabases().Stores[0]
+	for _, key := range []string{"k", "h"} {
+		dump := src.Dump(bulkArgs(key))
+		if res := restore(dst, key, "0", *dump.Bulk); res.Type != "string" {
+			t.Fatalf("RESTORE %s replied %s %v", key, res.Type, res.String)
+		}
+	}
+
+	if value, _ := dst.Pairs.Get("k"); !value.(ValueStringObj).ExpiresAt.IsZero() {
+		t.Errorf("restored string expires at %v", value.(ValueStringObj).ExpiresAt)
+	}
+	if value, _ := dst.Hsets.Get("h"); !value.(*HSet).ExpiresAt.IsZero() {
+		t.Errorf("restored hash expires at %v", value.(*HSet).ExpiresAt)
+	}
+}
+
+func TestRestoreRejectsBadPayloads(t *testing.T) {
+	src := newTestDatabases().Stores[0]
+	run(src, "SET k hello")
+	payload := []byte(*src.Dump(bulkArgs("k")).Bulk)
+
+	flipped := bytes.Clone(payload)
+	flipped[2] ^= 1
+
+	// A stream whose LastID is below its last entry would hand out duplicate IDs.
+	stream := NewStream()
+	stream.Append(StreamID{Ms: 5, Seq: 0}, []string{"f", "v"})
+	stream.LastID = StreamID{Ms: 1, Seq: 0}
+	badStream, _ := serializeValue(stream)
+
+	for name, bad := range map[string][]byte{
+		"truncated":   payload[:len(payload)-1],
+		"flipped bit": flipped,
+		"empty":       {},
+		"stream id":   badStream,
+	} {
+		dst := newTestDatabases().Stores[0]
+		res := restore(dst, "k", "0", string(bad))
+		if res.Type != "error" || *res.String != ErrBadPayload.Error() {
+			t.Errorf("%s: got %s %v, want %q", name, res.Type, res.String, ErrBadPayload)
+		}
+		if size := run(dst, "DBSIZE"); *size.Number != 0 {
+			t.Errorf("%s: DBSIZE is %d after a rejected RESTORE", name, *size.Number)
+		}
+	}
+}
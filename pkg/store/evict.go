@@ -0,0 +1,220 @@
+package store
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+const (
+	MAXMEMORY_NO_EVICTION    = "noeviction"
+	MAXMEMORY_ALLKEYS_LRU    = "allkeys-lru"
+	MAXMEMORY_ALLKEYS_LFU    = "allkeys-lfu"
+	MAXMEMORY_ALLKEYS_RANDOM = "allkeys-random"
+	MAXMEMORY_VOLATILE_LRU   = "volatile-lru"
+	MAXMEMORY_VOLATILE_LFU   = "volatile-lfu"
+	MAXMEMORY_VOLATILE_RAND  = "volatile-random"
+	MAXMEMORY_VOLATILE_TTL   = "volatile-ttl"
+
+	EVPOOL_SIZE = 16 //best candidates kept around between evictions
+)
+
+// MAXMEMORY_POLICIES lists every valid maxmemory-policy value.
+var MAXMEMORY_POLICIES = []string{
+	MAXMEMORY_NO_EVICTION,
+	MAXMEMORY_ALLKEYS_LRU,
+	MAXMEMORY_ALLKEYS_LFU,
+	MAXMEMORY_ALLKEYS_RANDOM,
+	MAXMEMORY_VOLATILE_LRU,
+	MAXMEMORY_VOLATILE_LFU,
+	MAXMEMORY_VOLATILE_RAND,
+	MAXMEMORY_VOLATILE_TTL,
+}
+
+// evictionCandidate is a key sampled for eviction. The higher the score the better
+// it is to evict: idle time for LRU, inverted frequency for LFU and inverted expiry for TTL.
+type evictionCandidate struct {
+	store *Store
+	key   string
+	score int64
+}
+
+// PerformEvictions evicts keys until memory usage is back under maxmemory.
+// It returns false if that wasn't possible, in which case commands that would use
+// more memory have to be refused.
+func (dbs *Databases) PerformEvictions() bool {
+	cfg := dbs.Config()
+	if cfg.MaxMemory <= 0 || dbs.Stats.UsedMemory.Load() <= cfg.MaxMemory {
+		return true
+	}
+
+	if cfg.MaxMemoryPolicy == MAXMEMORY_NO_EVICTION {
+		return false
+	}
+
+	dbs.evictMutex.Lock()
+	defer dbs.evictMutex.Unlock()
+
+	for dbs.Stats.UsedMemory.Load() > cfg.MaxMemory {
+		var ok bool
+		switch cfg.MaxMemoryPolicy {
+		case MAXMEMORY_ALLKEYS_RANDOM, MAXMEMORY_VOLATILE_RAND:
+			ok = dbs.evictRandom()
+		default:
+			ok = dbs.evictFromPool()
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// volatile policies only consider keys with an expiry set.
+func (dbs *Databases) volatile() bool {
+	switch dbs.Config().MaxMemoryPolicy {
+	case MAXMEMORY_VOLATILE_LRU, MAXMEMORY_VOLATILE_LFU, MAXMEMORY_VOLATILE_RAND, MAXMEMORY_VOLATILE_TTL:
+		return true
+	default:
+		return false
+	}
+}
+
+func (dbs *Databases) evictRandom() bool {
+	start := rand.IntN(len(dbs.Stores))
+	for i := 0; i < len(dbs.Stores); i++ {
+		store := dbs.Stores[(start+i)%len(dbs.Stores)]
+
+		store.EMutex.RLock()
+		var sample []string
+		if dbs.volatile() {
+			for _, entry := range store.Expires.Sample(1) {
+				sample = append(sample, entry.Key)
+			}
+		} else {
+			for _, entry := range store.Meta.Sample(1) {
+				sample = append(sample, entry.Key)
+			}
+		}
+		store.EMutex.RUnlock()
+
+		if len(sample) > 0 && store.evict(sample[0]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evictFromPool refills the eviction pool with samples from every db and evicts the
+// best candidate in it, approximating true LRU/LFU/TTL ordering without having to
+// keep every key sorted.
+func (dbs *Databases) evictFromPool() bool {
+	now := time.Now()
+	for _, store := range dbs.Stores {
+		dbs.evictPool = append(dbs.evictPool, store.evictionSamples(dbs.Config().MaxMemoryPolicy, now)...)
+	}
+
+	sort.Slice(dbs.evictPool, func(i, j int) bool {
+		return dbs.evictPool[i].score > dbs.evictPool[j].score
+	})
+	dbs.evictPool = dedupeCandidates(dbs.evictPool)
+	if len(dbs.evictPool) > EVPOOL_SIZE {
+		dbs.evictPool = dbs.evictPool[:EVPOOL_SIZE]
+	}
+
+	//the pool can have keys that were deleted since they were sampled, skip those
+	for len(dbs.evictPool) > 0 {
+		best := dbs.evictPool[0]
+		dbs.evictPool = dbs.evictPool[1:]
+		if best.store.evict(best.key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func dedupeCandidates(pool []evictionCandidate) []evictionCandidate {
+	type poolKey struct {
+		store *Store
+		key   string
+	}
+
+	seen := map[poolKey]bool{}
+	res := pool[:0]
+	for _, c := range pool {
+		k := poolKey{store: c.store, key: c.key}
+		if !seen[k] {
+			seen[k] = true
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
+
+func (store *Store) evictionSamples(policy string, now time.Time) []evictionCandidate {
+	store.EMutex.RLock()
+	defer store.EMutex.RUnlock()
+
+	samples := store.Databases.Config().MaxMemorySamples
+	var sample []string
+	if policy == MAXMEMORY_VOLATILE_LRU || policy == MAXMEMORY_VOLATILE_LFU || policy == MAXMEMORY_VOLATILE_TTL {
+		for _, entry := range store.Expires.Sample(samples) {
+			sample = append(sample, entry.Key)
+		}
+	} else {
+		for _, entry := range store.Meta.Sample(samples) {
+			sample = append(sample, entry.Key)
+		}
+	}
+
+	res := []evictionCandidate{}
+	for _, key := range sample {
+		c := evictionCandidate{store: store, key: key}
+
+		switch policy {
+		case MAXMEMORY_VOLATILE_TTL:
+			expiresAt, ok := store.Expires.Get(key)
+			if !ok {
+				continue
+			}
+			c.score = math.MaxInt64 - expiresAt.(time.Time).UnixMilli() //sooner to expire is better
+		default:
+			meta, ok := store.Meta.Get(key)
+			if !ok {
+				continue
+			}
+			if policy == MAXMEMORY_ALLKEYS_LFU || policy == MAXMEMORY_VOLATILE_LFU {
+				c.score = 255 - int64(meta.(*KeyMeta).decayedFreq(now))
+			} else {
+				c.score = now.UnixMilli() - meta.(*KeyMeta).LastAccess
+			}
+		}
+
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// evict deletes key for being over the memory limit. Returns false if it was already gone.
+func (store *Store) evict(key string) bool {
+	store.lockAll()
+	defer store.unlockAll()
+
+	_, ok := store.Meta.Get(key)
+	if !ok {
+		return false
+	}
+
+	store.deleteLocked(key)
+	store.Stats.EvictedKeys.Add(1)
+	store.notify(NOTIFY_EVICTED, "evicted", key)
+
+	return true
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"reredis/pkg/utils"
+	"time"
+)
+
+// The active expiry cycle works like redis': a few times a second it samples keys that
+// have a TTL, deletes the expired ones and, if a large share of the sample was expired,
+// assumes there are many more and samples again. Each cycle gets a bounded slice of
+// time so a huge backlog of expired keys can't starve clients.
+// How many cycles run per second is the hz setting.
+const (
+	ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP    = 20 //keys sampled per db per iteration
+	ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE = 10 //% of expired keys in a sample above which we keep going
+	ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC   = 25 //% of each cycle's period we're allowed to spend
+)
+
+// ActiveExpire runs the expiry cycle over every database until the process exits.
+// The period is picked up again after every cycle, so changes to hz apply right away.
+func ActiveExpire(dbs *Databases) {
+	for {
+		period := time.Second / time.Duration(dbs.Config().Hz)
+		time.Sleep(period)
+		dbs.activeExpireCycle(period * ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC / 100)
+	}
+}
+
+func (dbs *Databases) activeExpireCycle(budget time.Duration) {
+	start := time.Now()
+	sampled, expired := 0, 0
+
+	//resume from where the last cycle ran out of time so every db gets its turn
+	for i := 0; i < len(dbs.Stores); i++ {
+		store := dbs.Stores[(dbs.expireCursor+i)%len(dbs.Stores)]
+
+		for {
+			s, e := store.expireSample(ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP)
+			sampled += s
+			expired += e
+
+			if time.Since(start) > budget {
+				dbs.expireCursor = (dbs.expireCursor + i) % len(dbs.Stores)
+				dbs.Stats.ExpiredTimeCapReachedCount.Add(1)
+				dbs.Stats.updateStalePerc(sampled, expired)
+				return
+			}
+
+			if s == 0 || e*100/s <= ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE {
+				break
+			}
+		}
+	}
+
+	dbs.Stats.updateStalePerc(sampled, expired)
+}
+
+// expireSample checks up to n keys with a TTL and deletes the expired ones.
+// Returns how many keys were sampled and how many of those were expired.
+func (store *Store) expireSample(n int) (int, int) {
+	now := time.Now()
+
+	store.EMutex.RLock()
+	sample := store.Expires.Sample(n)
+	store.EMutex.RUnlock()
+
+	candidates := []string{}
+	for _, entry := range sample {
+		if now.After(entry.Value.(time.Time)) {
+			candidates = append(candidates, entry.Key)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return len(sample), 0
+	}
+
+	//things might have changed since we sampled, so check against the actual values
+	expired := 0
+	store.lockAll()
+	for _, key := range candidates {
+		if store.expireLocked(key, now) {
+			expired++
+		}
+	}
+	store.unlockAll()
+
+	return len(sample), expired
+}
+
+// expireLocked deletes key if it has expired. Callers must hold all the write locks.
+func (store *Store) expireLocked(key string, now time.Time) bool {
+	found := false
+	for _, ks := range store.keyspaces() {
+		value, ok := ks.hMap.Get(key)
+		if !ok {
+			continue
+		}
+		if !isExpired(value, now) {
+			return false
+		}
+		found = true
+	}
+
+	store.deleteLocked(key)
+	if found {
+		store.Stats.ExpiredKeys.Add(1)
+		store.notify(NOTIFY_EXPIRED, "expired", key)
+	}
+
+	return found
+}
+
+// expireLazily deletes an expired key found by a read. Callers must hold the write lock
+// of hMap, the value is checked again since it could have been overwritten in between.
+func (store *Store) expireLazily(hMap *utils.HashMap, key string) {
+	value, ok := hMap.Get(key)
+	if !ok || !isExpired(value, time.Now()) {
+		return
+	}
+
+	hMap.Delete(key)
+	store.forget(key)
+	store.Stats.ExpiredKeys.Add(1)
+	store.notify(NOTIFY_EXPIRED, "expired", key)
+}
@@ -0,0 +1,649 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"reredis/pkg/resp"
+	"reredis/pkg/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GEO_ENTRY_OVERHEAD approximates the memory of a member's map entry and skip list node.
+const GEO_ENTRY_OVERHEAD = 80
+
+// GeoSet holds members ordered by score. For points the score is their 52 bit geohash,
+// which a float64 represents exactly, so a search area turns into a few score ranges.
+type GeoSet struct {
+	Scores *utils.HashMap //member -> float64 score
+	Index  *utils.SkipList
+	Bytes  int
+}
+
+func NewGeoSet() *GeoSet {
+	return &GeoSet{
+		Scores: utils.NewHashMap(4),
+		Index:  utils.NewSkipList(),
+	}
+}
+
+// Add sets the score of member, returning whether it was added and whether its score changed.
+func (gs *GeoSet) Add(member string, score float64) (added bool, changed bool) {
+	if old, ok := gs.Scores.Get(member); ok {
+		if old.(float64) == score {
+			return false, false
+		}
+		gs.Index.Delete(old.(float64), member)
+		gs.Index.Insert(score, member)
+		gs.Scores.Set(member, score)
+		return false, true
+	}
+
+	gs.Index.Insert(score, member)
+	gs.Scores.Set(member, score)
+	gs.Bytes += len(member) + GEO_ENTRY_OVERHEAD
+	return true, true
+}
+
+// Score returns the score of member.
+func (gs *GeoSet) Score(member string) (float64, bool) {
+	score, ok := gs.Scores.Get(member)
+	if !ok {
+		return 0, false
+	}
+	return score.(float64), true
+}
+
+// Copy returns a deep copy of the set.
+func (gs *GeoSet) Copy() *GeoSet {
+	dup := NewGeoSet()
+	for node := gs.Index.First(math.Inf(-1)); node != nil; node = node.Next() {
+		dup.Add(node.Member, node.Score)
+	}
+	return dup
+}
+
+// geoUnits are the distance units accepted by the geo commands, in meters.
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(arg string) (float64, string) {
+	unit, ok := geoUnits[strings.ToLower(arg)]
+	if !ok {
+		return 0, "unsupported unit provided. please use M, KM, FT, MI"
+	}
+	return unit, ""
+}
+
+func parseCoords(lonArg string, latArg string) (float64, float64, string) {
+	lon, err1 := strconv.ParseFloat(lonArg, 64)
+	lat, err2 := strconv.ParseFloat(latArg, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, "value is not a valid float"
+	}
+	if !utils.GeoValid(lon, lat) {
+		return 0, 0, fmt.Sprintf("invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, ""
+}
+
+// coordValue replies with a coordinate, a double under RESP3 and a bulk string with
+// enough digits to round trip under RESP2, like redis does.
+func coordValue(f float64) resp.Value {
+	return resp.Value{Type: "double", Double: &f}
+}
+
+func formatDistance(meters float64, unit float64) string {
+	return strconv.FormatFloat(meters/unit, 'f', 4, 64)
+}
+
+// GeoAdd adds points to a geo set, returning how many members were added (or changed,
+// with CH):
+//
+//	GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func (store *Store) GeoAdd(args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		errStr := "wrong number of arguments for 'geoadd' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	nx, xx, ch := false, false, false
+
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(*args[i].Bulk) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+
+	if nx && xx {
+		errStr := "XX and NX options at the same time are not compatible"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	points := args[i:]
+	if len(points) == 0 || len(points)%3 != 0 {
+		errStr := "syntax error"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	scores := make([]float64, 0, len(points)/3)
+	for j := 0; j < len(points); j += 3 {
+		lon, lat, errStr := parseCoords(*points[j].Bulk, *points[j+1].Bulk)
+		if errStr != "" {
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		scores = append(scores, float64(utils.GeoEncode(lon, lat)))
+	}
+
+	unlock, ok := store.lockForWrite(key, store.Geos, &store.GMutex)
+	if !ok {
+		return wrongTypeValue()
+	}
+	defer unlock()
+
+	value, ok := store.Geos.Get(key)
+	gs, _ := value.(*GeoSet)
+	if !ok {
+		if xx {
+			res := int64(0)
+			return resp.Value{
+				Type:   "integer",
+				Number: &res,
+			}
+		}
+		gs = NewGeoSet()
+	}
+
+	res := int64(0)
+	for j, score := range scores {
+		member := *points[j*3+2].Bulk
+		_, exists := gs.Score(member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+
+		added, changed := gs.Add(member, score)
+		if added || (ch && changed) {
+			res++
+		}
+	}
+
+	if gs.Index.Length > 0 {
+		store.Geos.Set(key, gs)
+		store.track(key, gs)
+		store.notify(NOTIFY_ZSET, "zadd", key)
+	}
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// GeoPos returns the longitude and latitude of members, null for missing ones.
+func (store *Store) GeoPos(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'geopos' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	res := []resp.Value{}
+	found := store.forEachScore(args[0], args[1:], func(score float64, ok bool) {
+		if !ok {
+			res = append(res, resp.Value{Type: "nullarray"})
+			return
+		}
+		lon, lat := utils.GeoDecode(uint64(score))
+		res = append(res, arrayValue(coordValue(lon), coordValue(lat)))
+	})
+	if !found {
+		return wrongTypeValue()
+	}
+
+	return arrayValue(res...)
+}
+
+// GeoHash returns the standard geohash strings of members, null for missing ones.
+func (store *Store) GeoHash(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'geohash' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	res := []resp.Value{}
+	found := store.forEachScore(args[0], args[1:], func(score float64, ok bool) {
+		if !ok {
+			res = append(res, resp.Value{Type: "null"})
+			return
+		}
+		res = append(res, bulkValue(utils.GeoHashString(utils.GeoDecode(uint64(score)))))
+	})
+	if !found {
+		return wrongTypeValue()
+	}
+
+	return arrayValue(res...)
+}
+
+// forEachScore looks up the score of each member of the geo set at key. It reports false,
+// without calling fn, if key holds another type.
+func (store *Store) forEachScore(key resp.Value, members []resp.Value, fn func(score float64, ok bool)) bool {
+	if store.wrongType(*key.Bulk, store.Geos, &store.GMutex) {
+		return false
+	}
+
+	store.GMutex.RLock()
+	value, _ := store.Geos.Get(*key.Bulk)
+	gs, _ := value.(*GeoSet)
+	for _, member := range members {
+		if gs == nil {
+			fn(0, false)
+			continue
+		}
+		fn(gs.Score(*member.Bulk))
+	}
+	store.GMutex.RUnlock()
+	store.touch(*key.Bulk)
+	return true
+}
+
+// GeoDist returns the distance between two members, null if either is missing:
+//
+//	GEODIST key member1 member2 [M|KM|FT|MI]
+func (store *Store) GeoDist(args []resp.Value) resp.Value {
+	if len(args) != 3 && len(args) != 4 {
+		errStr := "wrong number of arguments for 'geodist' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	unit := 1.0
+	if len(args) == 4 {
+		var errStr string
+		if unit, errStr = parseGeoUnit(*args[3].Bulk); errStr != "" {
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	scores := []float64{}
+	found := store.forEachScore(args[0], args[1:3], func(score float64, ok bool) {
+		if ok {
+			scores = append(scores, score)
+		}
+	})
+	if !found {
+		return wrongTypeValue()
+	}
+	if len(scores) != 2 {
+		return resp.Value{
+			Type: "null",
+		}
+	}
+
+	lon1, lat1 := utils.GeoDecode(uint64(scores[0]))
+	lon2, lat2 := utils.GeoDecode(uint64(scores[1]))
+	return bulkValue(formatDistance(utils.GeoDistance(lon1, lat1, lon2, lat2), unit))
+}
+
+// geoSearch holds the parsed options of GEOSEARCH and GEOSEARCHSTORE.
+type geoSearch struct {
+	fromMember *string
+	lon, lat   float64
+	fromLonLat bool
+	radius     float64 //meters, for BYRADIUS
+	width      float64 //meters, for BYBOX
+	height     float64
+	byBox      bool
+	byRadius   bool
+	unit       float64
+	sort       string //"ASC", "DESC" or empty
+	count      int
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+type geoPoint struct {
+	member string
+	score  float64
+	dist   float64
+	lon    float64
+	lat    float64
+}
+
+func parseGeoSearch(cmd string, args []resp.Value, store bool) (*geoSearch, string) {
+	search := &geoSearch{}
+
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(*args[i].Bulk)
+		left := len(args) - i - 1
+
+		switch {
+		case arg == "FROMMEMBER" && left >= 1:
+			if search.fromMember != nil || search.fromLonLat {
+				return nil, "exactly one of FROMMEMBER or FROMLONLAT can be specified for " + strings.ToLower(cmd)
+			}
+			search.fromMember = args[i+1].Bulk
+			i++
+		case arg == "FROMLONLAT" && left >= 2:
+			if search.fromMember != nil || search.fromLonLat {
+				return nil, "exactly one of FROMMEMBER or FROMLONLAT can be specified for " + strings.ToLower(cmd)
+			}
+			lon, lat, errStr := parseCoords(*args[i+1].Bulk, *args[i+2].Bulk)
+			if errStr != "" {
+				return nil, errStr
+			}
+			search.lon, search.lat, search.fromLonLat = lon, lat, true
+			i += 2
+		case arg == "BYRADIUS" && left >= 2:
+			if search.byBox || search.byRadius {
+				return nil, "exactly one of BYRADIUS and BYBOX arguments must be provided for " + strings.ToLower(cmd)
+			}
+			radius, err := strconv.ParseFloat(*args[i+1].Bulk, 64)
+			if err != nil || radius < 0 {
+				return nil, "radius cannot be negative"
+			}
+			unit, errStr := parseGeoUnit(*args[i+2].Bulk)
+			if errStr != "" {
+				return nil, errStr
+			}
+			search.radius, search.unit, search.byRadius = radius*unit, unit, true
+			i += 2
+		case arg == "BYBOX" && left >= 3:
+			if search.byBox || search.byRadius {
+				return nil, "exactly one of BYRADIUS and BYBOX arguments must be provided for " + strings.ToLower(cmd)
+			}
+			width, err1 := strconv.ParseFloat(*args[i+1].Bulk, 64)
+			height, err2 := strconv.ParseFloat(*args[i+2].Bulk, 64)
+			if err1 != nil || err2 != nil || width < 0 || height < 0 {
+				return nil, "height or width cannot be negative"
+			}
+			unit, errStr := parseGeoUnit(*args[i+3].Bulk)
+			if errStr != "" {
+				return nil, errStr
+			}
+			search.width, search.height, search.unit, search.byBox = width*unit, height*unit, unit, true
+			i += 3
+		case arg == "ASC" || arg == "DESC":
+			search.sort = arg
+		case arg == "COUNT" && left >= 1:
+			count, err := strconv.Atoi(*args[i+1].Bulk)
+			if err != nil || count <= 0 {
+				return nil, "COUNT must be > 0"
+			}
+			search.count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(*args[i+1].Bulk) == "ANY" {
+				search.any = true
+				i++
+			}
+		case arg == "WITHCOORD" && !store:
+			search.withCoord = true
+		case arg == "WITHDIST" && !store:
+			search.withDist = true
+		case arg == "WITHHASH" && !store:
+			search.withHash = true
+		case arg == "STOREDIST" && store:
+			search.storeDist = true
+		default:
+			return nil, "syntax error"
+		}
+	}
+
+	if search.fromMember == nil && !search.fromLonLat {
+		return nil, "exactly one of FROMMEMBER or FROMLONLAT can be specified for " + strings.ToLower(cmd)
+	}
+	if !search.byBox && !search.byRadius {
+		return nil, "exactly one of BYRADIUS and BYBOX arguments must be provided for " + strings.ToLower(cmd)
+	}
+
+	return search, ""
+}
+
+// run finds the points of gs matching the search. Callers must hold GMutex.
+func (search *geoSearch) run(gs *GeoSet) ([]geoPoint, string) {
+	if search.fromMember != nil {
+		score, ok := gs.Score(*search.fromMember)
+		if !ok {
+			return nil, "could not decode requested zset member"
+		}
+		search.lon, search.lat = utils.GeoDecode(uint64(score))
+	}
+
+	width, height := search.width, search.height
+	if search.byRadius {
+		width, height = search.radius*2, search.radius*2
+	}
+
+	points := []geoPoint{}
+	for _, r := range utils.GeoCoveringRanges(search.lon, search.lat, width, height) {
+		for node := gs.Index.First(float64(r.Min)); node != nil && node.Score < float64(r.Max); node = node.Next() {
+			lon, lat := utils.GeoDecode(uint64(node.Score))
+
+			var dist float64
+			var ok bool
+			if search.byBox {
+				dist, ok = utils.GeoInBox(search.lon, search.lat, search.width, search.height, lon, lat)
+			} else {
+				dist = utils.GeoDistance(search.lon, search.lat, lon, lat)
+				ok = dist <= search.radius
+			}
+			if !ok {
+				continue
+			}
+
+			points = append(points, geoPoint{member: node.Member, score: node.Score, dist: dist, lon: lon, lat: lat})
+			if search.any && len(points) >= search.count {
+				break
+			}
+		}
+		if search.any && len(points) >= search.count {
+			break
+		}
+	}
+
+	//without ANY, COUNT returns the closest matches
+	order := search.sort
+	if order == "" && search.count > 0 && !search.any {
+		order = "ASC"
+	}
+	switch order {
+	case "ASC":
+		slices.SortStableFunc(points, func(a, b geoPoint) int { return cmpFloat(a.dist, b.dist) })
+	case "DESC":
+		slices.SortStableFunc(points, func(a, b geoPoint) int { return cmpFloat(b.dist, a.dist) })
+	}
+
+	if search.count > 0 && len(points) > search.count {
+		points = points[:search.count]
+	}
+
+	return points, ""
+}
+
+func cmpFloat(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// GeoSearch returns the members within a circle or box:
+//
+//	GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+//	          BYRADIUS radius unit|BYBOX width height unit
+//	          [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func (store *Store) GeoSearch(args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		errStr := "wrong number of arguments for 'geosearch' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	search, errStr := parseGeoSearch("GEOSEARCH", args[1:], false)
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	if store.wrongType(key, store.Geos, &store.GMutex) {
+		return wrongTypeValue()
+	}
+
+	store.GMutex.RLock()
+	value, ok := store.Geos.Get(key)
+	if !ok {
+		store.GMutex.RUnlock()
+		return arrayValue()
+	}
+	points, errStr := search.run(value.(*GeoSet))
+	store.GMutex.RUnlock()
+	store.touch(key)
+
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	res := make([]resp.Value, 0, len(points))
+	for _, p := range points {
+		if !search.withDist && !search.withHash && !search.withCoord {
+			res = append(res, bulkValue(p.member))
+			continue
+		}
+
+		item := []resp.Value{bulkValue(p.member)}
+		if search.withDist {
+			item = append(item, bulkValue(formatDistance(p.dist, search.unit)))
+		}
+		if search.withHash {
+			item = append(item, integerValue(int64(p.score)))
+		}
+		if search.withCoord {
+			item = append(item, arrayValue(coordValue(p.lon), coordValue(p.lat)))
+		}
+		res = append(res, arrayValue(item...))
+	}
+
+	return arrayValue(res...)
+}
+
+// GeoSearchStore is GEOSEARCH storing the matching members and their positions at
+// destination, or their distances with STOREDIST. Returns how many members were stored:
+//
+//	GEOSEARCHSTORE destination source FROMMEMBER ...|FROMLONLAT ... BYRADIUS ...|BYBOX ...
+//	               [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func (store *Store) GeoSearchStore(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		errStr := "wrong number of arguments for 'geosearchstore' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	search, errStr := parseGeoSearch("GEOSEARCHSTORE", args[2:], true)
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	dst, src := *args[0].Bulk, *args[1].Bulk
+
+	//the destination can be of any type, like any other write that overwrites a key
+	store.lockAll()
+	defer store.unlockAll()
+
+	points := []geoPoint{}
+	value, ok := store.Geos.Get(src)
+	if !ok && store.heldElsewhereLocked(src, store.Geos) {
+		return wrongTypeValue()
+	}
+	if ok {
+		points, errStr = search.run(value.(*GeoSet))
+		if errStr != "" {
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	existed := store.existsLocked(dst, time.Now())
+	store.deleteLocked(dst)
+	if len(points) == 0 {
+		if existed {
+			store.notify(NOTIFY_GENERIC, "del", dst)
+		}
+		return integerValue(0)
+	}
+
+	gs := NewGeoSet()
+	for _, p := range points {
+		score := p.score
+		if search.storeDist {
+			score = p.dist / search.unit
+		}
+		gs.Add(p.member, score)
+	}
+	store.Geos.Set(dst, gs)
+	store.trackLocked(dst, gs)
+	store.notify(NOTIFY_ZSET, "geosearchstore", dst)
+
+	return integerValue(int64(gs.Index.Length))
+}
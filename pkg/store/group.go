@@ -0,0 +1,300 @@
+package store
+
+import (
+	"slices"
+	"sort"
+)
+
+// Approximate memory used by consumer group bookkeeping, counted towards the stream's Bytes.
+const (
+	STREAM_GROUP_OVERHEAD    = 64
+	STREAM_CONSUMER_OVERHEAD = 64
+	STREAM_PEL_OVERHEAD      = 48
+)
+
+// PendingEntry is an entry delivered to a consumer that wasn't acknowledged yet.
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      *Consumer
+	DeliveryTime  int64 //unix millis of the last delivery
+	DeliveryCount int64
+}
+
+type Consumer struct {
+	Name       string
+	SeenTime   int64 //unix millis of the last command from this consumer
+	ActiveTime int64 //unix millis of the last successful read or claim, -1 if never
+	Pending    map[StreamID]*PendingEntry
+}
+
+// ConsumerGroup tracks which entries were delivered to which consumer. Pending entries
+// belong to the group rather than to a connection, so they outlive the consumer's client
+// and can be claimed by another consumer.
+type ConsumerGroup struct {
+	Name        string
+	LastID      StreamID        //last entry delivered with ">"
+	EntriesRead int64           //entries delivered so far, for computing the lag, -1 if unknown
+	PEL         []*PendingEntry //pending entries list, sorted by ID
+	Consumers   map[string]*Consumer
+}
+
+// CreateGroup adds a consumer group starting after lastID. Returns false if it already exists.
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) bool {
+	if s.Groups == nil {
+		s.Groups = map[string]*ConsumerGroup{}
+	}
+	if _, ok := s.Groups[name]; ok {
+		return false
+	}
+
+	s.Groups[name] = &ConsumerGroup{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		PEL:         []*PendingEntry{},
+		Consumers:   map[string]*Consumer{},
+	}
+	s.Bytes += STREAM_GROUP_OVERHEAD + len(name)
+
+	return true
+}
+
+// DestroyGroup removes a consumer group with all its consumers and pending entries.
+func (s *Stream) DestroyGroup(name string) bool {
+	group, ok := s.Groups[name]
+	if !ok {
+		return false
+	}
+
+	for consumer := range group.Consumers {
+		s.DeleteConsumer(group, consumer)
+	}
+	delete(s.Groups, name)
+	s.Bytes -= STREAM_GROUP_OVERHEAD + len(name)
+
+	return true
+}
+
+// GroupNames returns the names of the stream's groups in order.
+func (s *Stream) GroupNames() []string {
+	names := make([]string, 0, len(s.Groups))
+	for name := range s.Groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Consumer looks up a consumer of the group, creating it if needed. created reports
+// whether it was just created.
+func (s *Stream) Consumer(group *ConsumerGroup, name string, now int64) (consumer *Consumer, created bool) {
+	if consumer, ok := group.Consumers[name]; ok {
+		return consumer, false
+	}
+
+	consumer = &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+		Pending:    map[StreamID]*PendingEntry{},
+	}
+	group.Consumers[name] = consumer
+	s.Bytes += STREAM_CONSUMER_OVERHEAD + len(name)
+
+	return consumer, true
+}
+
+// DeleteConsumer removes a consumer and its pending entries, returning how many it had.
+func (s *Stream) DeleteConsumer(group *ConsumerGroup, name string) int {
+	consumer, ok := group.Consumers[name]
+	if !ok {
+		return 0
+	}
+
+	pending := len(consumer.Pending)
+	if pending > 0 {
+		group.PEL = slices.DeleteFunc(group.PEL, func(pe *PendingEntry) bool {
+			return pe.Consumer == consumer
+		})
+	}
+	delete(group.Consumers, name)
+	s.Bytes -= STREAM_CONSUMER_OVERHEAD + len(name) + pending*STREAM_PEL_OVERHEAD
+
+	return pending
+}
+
+// AddPending records that id was delivered to consumer, moving it over if it was pending
+// for another consumer.
+func (s *Stream) AddPending(group *ConsumerGroup, consumer *Consumer, id StreamID, now int64) *PendingEntry {
+	idx, found := group.search(id)
+	if !found {
+		group.PEL = slices.Insert(group.PEL, idx, &PendingEntry{ID: id})
+		s.Bytes += STREAM_PEL_OVERHEAD
+	}
+
+	pe := group.PEL[idx]
+	if pe.Consumer != nil {
+		delete(pe.Consumer.Pending, id)
+	}
+	pe.Consumer = consumer
+	pe.DeliveryTime = now
+	consumer.Pending[id] = pe
+
+	return pe
+}
+
+// Ack removes id from the group's pending entries. Returns false if it wasn't pending.
+func (s *Stream) Ack(group *ConsumerGroup, id StreamID) bool {
+	idx, found := group.search(id)
+	if !found {
+		return false
+	}
+
+	delete(group.PEL[idx].Consumer.Pending, id)
+	group.PEL = slices.Delete(group.PEL, idx, idx+1)
+	s.Bytes -= STREAM_PEL_OVERHEAD
+
+	return true
+}
+
+// Pending returns the pending entry for id, or nil.
+func (group *ConsumerGroup) Pending(id StreamID) *PendingEntry {
+	idx, found := group.search(id)
+	if !found {
+		return nil
+	}
+	return group.PEL[idx]
+}
+
+// PendingRange returns the pending entries with start <= ID <= end, optionally only
+// those of one consumer, up to count (0 for no limit).
+func (group *ConsumerGroup) PendingRange(start StreamID, end StreamID, consumer *Consumer, count int) []*PendingEntry {
+	res := []*PendingEntry{}
+
+	idx, _ := group.search(start)
+	for _, pe := range group.PEL[idx:] {
+		if end.Less(pe.ID) || (count > 0 && len(res) >= count) {
+			break
+		}
+		if consumer == nil || pe.Consumer == consumer {
+			res = append(res, pe)
+		}
+	}
+
+	return res
+}
+
+// search finds where id is or would be inserted in the PEL.
+func (group *ConsumerGroup) search(id StreamID) (int, bool) {
+	idx := sort.Search(len(group.PEL), func(i int) bool {
+		return !group.PEL[i].ID.Less(id)
+	})
+	return idx, idx < len(group.PEL) && group.PEL[idx].ID == id
+}
+
+// Entry returns the entry with the given ID, if it's still in the stream.
+func (s *Stream) Entry(id StreamID) (StreamEntry, bool) {
+	entries := s.Range(id, id, 1, false)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// hasTombstones reports whether entries were deleted from the stream at or after start,
+// in which case the number of entries in a range can't be worked out from EntriesAdded.
+func (s *Stream) hasTombstones(start StreamID) bool {
+	if s.Length == 0 || s.MaxDeletedID == MinStreamID {
+		return false
+	}
+
+	if first, ok := s.FirstID(); ok && start.Less(first) {
+		start = first
+	}
+	return !s.MaxDeletedID.Less(start)
+}
+
+// estimateEntriesRead works out how many entries were added up to and including id,
+// or -1 if deletions make that impossible to tell.
+func (s *Stream) estimateEntriesRead(id StreamID) int64 {
+	if s.EntriesAdded == 0 {
+		return 0
+	}
+	if !id.Less(s.LastID) || s.Length == 0 {
+		return int64(s.EntriesAdded)
+	}
+
+	first, _ := s.FirstID()
+	if (s.MaxDeletedID == MinStreamID || s.MaxDeletedID.Less(first)) && id.Less(first) {
+		return int64(s.EntriesAdded) - int64(s.Length)
+	}
+
+	return -1
+}
+
+// Delivered advances the group past an entry delivered with ">".
+func (s *Stream) Delivered(group *ConsumerGroup, id StreamID) {
+	group.LastID = id
+
+	if group.EntriesRead != -1 && !s.hasTombstones(id) {
+		group.EntriesRead++
+	} else if s.EntriesAdded > 0 {
+		group.EntriesRead = s.estimateEntriesRead(id)
+	}
+}
+
+// Lag returns how many entries the group still has to read, if that can be known.
+func (s *Stream) Lag(group *ConsumerGroup) (int64, bool) {
+	if s.EntriesAdded == 0 {
+		return 0, true
+	}
+
+	entriesRead := group.EntriesRead
+	if entriesRead == -1 || s.hasTombstones(group.LastID) {
+		entriesRead = s.estimateEntriesRead(group.LastID)
+		if entriesRead == -1 {
+			return 0, false
+		}
+	}
+
+	return int64(s.EntriesAdded) - entriesRead, true
+}
+
+// copyGroups deep copies the consumer groups of a stream.
+func copyGroups(groups map[string]*ConsumerGroup) map[string]*ConsumerGroup {
+	if groups == nil {
+		return nil
+	}
+
+	dup := make(map[string]*ConsumerGroup, len(groups))
+	for name, group := range groups {
+		g := &ConsumerGroup{
+			Name:        group.Name,
+			LastID:      group.LastID,
+			EntriesRead: group.EntriesRead,
+			PEL:         make([]*PendingEntry, len(group.PEL)),
+			Consumers:   make(map[string]*Consumer, len(group.Consumers)),
+		}
+
+		for cname, consumer := range group.Consumers {
+			g.Consumers[cname] = &Consumer{
+				Name:       consumer.Name,
+				SeenTime:   consumer.SeenTime,
+				ActiveTime: consumer.ActiveTime,
+				Pending:    make(map[StreamID]*PendingEntry, len(consumer.Pending)),
+			}
+		}
+
+		for i, pe := range group.PEL {
+			p := *pe
+			p.Consumer = g.Consumers[pe.Consumer.Name]
+			p.Consumer.Pending[p.ID] = &p
+			g.PEL[i] = &p
+		}
+
+		dup[name] = g
+	}
+
+	return dup
+}
@@ -0,0 +1,1142 @@
+package store
+
+import (
+	"reredis/pkg/resp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XAUTOCLAIM_ATTEMPTS_FACTOR bounds how many pending entries XAUTOCLAIM looks at, as a
+// multiple of COUNT, so a huge PEL of entries that aren't idle yet can't stall the server.
+const XAUTOCLAIM_ATTEMPTS_FACTOR = 10
+
+// XGroup manages consumer groups:
+//
+//	XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD n]
+//	XGROUP SETID key group id|$ [ENTRIESREAD n]
+//	XGROUP DESTROY key group
+//	XGROUP CREATECONSUMER key group consumer
+//	XGROUP DELCONSUMER key group consumer
+func (store *Store) XGroup(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		errStr := "wrong number of arguments for 'xgroup' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	sub := strings.ToUpper(*args[0].Bulk)
+	key, name := *args[1].Bulk, *args[2].Bulk
+
+	mkStream := false
+	entriesRead := int64(-1)
+	switch sub {
+	case "CREATE", "SETID":
+		if len(args) < 4 {
+			errStr := "wrong number of arguments for 'xgroup|" + strings.ToLower(sub) + "' command"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		for i := 4; i < len(args); i++ {
+			arg := strings.ToUpper(*args[i].Bulk)
+			switch {
+			case arg == "MKSTREAM" && sub == "CREATE":
+				mkStream = true
+			case arg == "ENTRIESREAD" && i+1 < len(args):
+				n, err := strconv.ParseInt(*args[i+1].Bulk, 10, 64)
+				if err != nil || n < -1 {
+					errStr := "value for ENTRIESREAD must be positive or -1"
+					return resp.Value{
+						Type:   "error",
+						String: &errStr,
+					}
+				}
+				entriesRead = n
+				i++
+			default:
+				errStr := "syntax error"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+		}
+	case "DESTROY":
+		if len(args) != 3 {
+			errStr := "wrong number of arguments for 'xgroup|destroy' command"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	case "CREATECONSUMER", "DELCONSUMER":
+		if len(args) != 4 {
+			errStr := "wrong number of arguments for 'xgroup|" + strings.ToLower(sub) + "' command"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	default:
+		errStr := "unknown subcommand '" + *args[0].Bulk + "'. Try XGROUP HELP."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	unlock, ok := store.lockForWrite(key, store.Streams, &store.XMutex)
+	if !ok {
+		return wrongTypeValue()
+	}
+	defer unlock()
+
+	value, ok := store.Streams.Get(key)
+	if !ok && !(sub == "CREATE" && mkStream) {
+		errStr := "The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	stream, _ := value.(*Stream)
+	if stream == nil {
+		stream = NewStream()
+	}
+
+	//SETID and CREATE take the group's last delivered ID
+	var lastID StreamID
+	if sub == "CREATE" || sub == "SETID" {
+		if *args[3].Bulk == "$" {
+			lastID = stream.LastID
+		} else {
+			id, err := ParseStreamID(*args[3].Bulk, 0)
+			if err != nil {
+				errStr := err.Error()
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			lastID = id
+		}
+	}
+
+	group := stream.Groups[name]
+	if group == nil && sub != "CREATE" && sub != "DESTROY" {
+		errStr := "NOGROUP No such consumer group '" + name + "' for key name '" + key + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	okStr := "OK"
+	res := int64(0)
+	switch sub {
+	case "CREATE":
+		if !stream.CreateGroup(name, lastID, entriesRead) {
+			errStr := "BUSYGROUP Consumer Group name already exists"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		store.Streams.Set(key, stream)
+		store.track(key, stream)
+		store.notify(NOTIFY_STREAM, "xgroup-create", key)
+		return resp.Value{
+			Type:   "string",
+			String: &okStr,
+		}
+	case "SETID":
+		group.LastID = lastID
+		group.EntriesRead = entriesRead
+		store.notify(NOTIFY_STREAM, "xgroup-setid", key)
+		return resp.Value{
+			Type:   "string",
+			String: &okStr,
+		}
+	case "DESTROY":
+		if stream.DestroyGroup(name) {
+			store.track(key, stream)
+			store.notify(NOTIFY_STREAM, "xgroup-destroy", key)
+			res = 1
+			defer store.signal(key) //blocked XREADGROUPs fail now that the group is gone
+		}
+	case "CREATECONSUMER":
+		if _, created := stream.Consumer(group, *args[3].Bulk, time.Now().UnixMilli()); created {
+			store.track(key, stream)
+			store.notify(NOTIFY_STREAM, "xgroup-createconsumer", key)
+			res = 1
+		}
+	case "DELCONSUMER":
+		if _, ok := group.Consumers[*args[3].Bulk]; ok {
+			res = int64(stream.DeleteConsumer(group, *args[3].Bulk))
+			store.track(key, stream)
+			store.notify(NOTIFY_STREAM, "xgroup-delconsumer", key)
+		}
+	}
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// XReadGroup reads from streams on behalf of a consumer of a group:
+//
+//	XREADGROUP GROUP group consumer [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+//
+// ">" delivers entries never delivered to the group before and adds them to the pending
+// entries list, unless NOACK is given. Any other ID returns the consumer's own pending
+// entries after it, for recovering after a crash. Only ">" reads can block, see XRead.
+func (store *Store) XReadGroup(args []resp.Value, cancel <-chan struct{}) resp.Value {
+	read, errStr := parseStreamRead("XREADGROUP", args, true)
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	ids := make([]StreamID, len(read.keys))
+	for j, idArg := range read.ids {
+		switch idArg {
+		case ">":
+			continue
+		case "$":
+			errStr := "The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		id, err := ParseStreamID(idArg, 0)
+		if err != nil {
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		ids[j] = id
+	}
+
+	for _, key := range read.keys {
+		if store.wrongType(key, store.Streams, &store.XMutex) {
+			return wrongTypeValue()
+		}
+	}
+
+	return store.blockOn(read.keys, read.block, cancel, func() (resp.Value, bool) {
+		return store.readGroup(read, ids)
+	})
+}
+
+// readGroup does one XREADGROUP attempt. It reports false if there was nothing to reply
+// with, so the caller can block.
+func (store *Store) readGroup(read *streamRead, ids []StreamID) (resp.Value, bool) {
+	now := time.Now().UnixMilli()
+	res := []resp.Value{}
+	history := false
+
+	store.XMutex.Lock()
+	defer store.XMutex.Unlock()
+
+	for j, key := range read.keys {
+		stream, group := store.groupLocked(key, read.group)
+		if group == nil {
+			errStr := "NOGROUP No such key '" + key + "' or consumer group '" + read.group + "' in XREADGROUP with GROUP option"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}, true
+		}
+
+		consumer, created := stream.Consumer(group, read.consumer, now)
+		if created {
+			store.notify(NOTIFY_STREAM, "xgroup-createconsumer", key)
+		}
+		consumer.SeenTime = now
+
+		var entries []resp.Value
+		if read.ids[j] == ">" {
+			start, ok := group.LastID.Next()
+			if !ok {
+				continue
+			}
+
+			delivered := stream.Range(start, MaxStreamID, read.count, false)
+			for _, entry := range delivered {
+				stream.Delivered(group, entry.ID)
+				if !read.noAck {
+					pe := stream.AddPending(group, consumer, entry.ID, now)
+					pe.DeliveryCount = 1
+				}
+			}
+			if len(delivered) > 0 {
+				consumer.ActiveTime = now
+			}
+			entries = streamEntriesValue(delivered).Array
+		} else {
+			//history is always replied to, even when empty
+			history = true
+			start, ok := ids[j].Next()
+			if ok {
+				for _, pe := range group.PendingRange(start, MaxStreamID, consumer, read.count) {
+					pe.DeliveryTime = now
+					pe.DeliveryCount++
+					entries = append(entries, store.pendingEntryValue(stream, pe.ID))
+				}
+			}
+		}
+
+		store.track(key, stream)
+		if len(entries) == 0 && read.ids[j] == ">" {
+			continue
+		}
+
+		res = append(res, resp.Value{
+			Type: "array",
+			Array: []resp.Value{
+				{Type: "bulk", Bulk: &read.keys[j]},
+				{Type: "array", Array: entries},
+			},
+		})
+	}
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}, len(res) > 0 || history
+}
+
+// pendingEntryValue replies with a pending entry, or a null in place of its fields if it
+// was deleted from the stream since it was delivered.
+func (store *Store) pendingEntryValue(stream *Stream, id StreamID) resp.Value {
+	if entry, ok := stream.Entry(id); ok {
+		return streamEntriesValue([]StreamEntry{entry}).Array[0]
+	}
+
+	idStr := id.String()
+	return resp.Value{
+		Type: "array",
+		Array: []resp.Value{
+			{Type: "bulk", Bulk: &idStr},
+			{Type: "null"},
+		},
+	}
+}
+
+// groupLocked looks up a stream and one of its groups, nil if either is missing.
+// Callers must hold XMutex.
+func (store *Store) groupLocked(key string, name string) (*Stream, *ConsumerGroup) {
+	value, ok := store.Streams.Get(key)
+	if !ok {
+		return nil, nil
+	}
+
+	stream := value.(*Stream)
+	return stream, stream.Groups[name]
+}
+
+// XAck acknowledges pending entries, returning how many were pending:
+//
+//	XACK key group id [id ...]
+func (store *Store) XAck(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		errStr := "wrong number of arguments for 'xack' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	ids := make([]StreamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := ParseStreamID(*arg.Bulk, 0)
+		if err != nil {
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	key := *args[0].Bulk
+	acked := int64(0)
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.Lock()
+	if stream, group := store.groupLocked(key, *args[1].Bulk); group != nil {
+		for _, id := range ids {
+			if stream.Ack(group, id) {
+				acked++
+			}
+		}
+		if acked > 0 {
+			store.track(key, stream)
+		}
+	}
+	store.XMutex.Unlock()
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &acked,
+	}
+}
+
+// XPending inspects a group's pending entries:
+//
+//	XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+//
+// Without a range it returns a summary: the number of pending entries, the smallest and
+// greatest pending IDs and how many entries each consumer has pending.
+func (store *Store) XPending(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		errStr := "wrong number of arguments for 'xpending' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key, name := *args[0].Bulk, *args[1].Bulk
+	extended := len(args) > 2
+
+	minIdle := int64(0)
+	var start, end StreamID
+	startOk, endOk := true, true
+	count := 0
+	consumerName := ""
+
+	if extended {
+		rest := args[2:]
+		if strings.ToUpper(*rest[0].Bulk) == "IDLE" && len(rest) > 1 {
+			n, err := strconv.ParseInt(*rest[1].Bulk, 10, 64)
+			if err != nil {
+				errStr := "value is not an integer or out of range"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			minIdle = n
+			rest = rest[2:]
+		}
+
+		if len(rest) != 3 && len(rest) != 4 {
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		var err error
+		start, startOk, err = parseRangeID(*rest[0].Bulk, false)
+		if err == nil {
+			end, endOk, err = parseRangeID(*rest[1].Bulk, true)
+		}
+		if err != nil {
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		count, err = strconv.Atoi(*rest[2].Bulk)
+		if err != nil {
+			errStr := "value is not an integer or out of range"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		if len(rest) == 4 {
+			consumerName = *rest[3].Bulk
+		}
+	}
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.RLock()
+	defer store.XMutex.RUnlock()
+
+	_, group := store.groupLocked(key, name)
+	if group == nil {
+		errStr := "NOGROUP No such key '" + key + "' or consumer group '" + name + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if !extended {
+		total := int64(len(group.PEL))
+		if total == 0 {
+			return resp.Value{
+				Type:  "array",
+				Array: []resp.Value{{Type: "integer", Number: &total}, {Type: "null"}, {Type: "null"}, {Type: "null"}},
+			}
+		}
+
+		first, last := group.PEL[0].ID.String(), group.PEL[len(group.PEL)-1].ID.String()
+		consumers := []resp.Value{}
+		for _, consumer := range sortedConsumers(group) {
+			if len(consumer.Pending) == 0 {
+				continue
+			}
+			pending := strconv.Itoa(len(consumer.Pending)) //redis replies with these as strings
+			consumers = append(consumers, resp.Value{
+				Type:  "array",
+				Array: []resp.Value{{Type: "bulk", Bulk: &consumer.Name}, {Type: "bulk", Bulk: &pending}},
+			})
+		}
+
+		return resp.Value{
+			Type: "array",
+			Array: []resp.Value{
+				{Type: "integer", Number: &total},
+				{Type: "bulk", Bulk: &first},
+				{Type: "bulk", Bulk: &last},
+				{Type: "array", Array: consumers},
+			},
+		}
+	}
+
+	res := []resp.Value{}
+	var consumer *Consumer
+	if consumerName != "" {
+		consumer = group.Consumers[consumerName]
+	}
+	if count <= 0 || !startOk || !endOk || (consumerName != "" && consumer == nil) {
+		return resp.Value{
+			Type:  "array",
+			Array: res,
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	for _, pe := range group.PendingRange(start, end, consumer, 0) {
+		idle := now - pe.DeliveryTime
+		if idle < minIdle {
+			continue
+		}
+
+		id := pe.ID.String()
+		res = append(res, resp.Value{
+			Type: "array",
+			Array: []resp.Value{
+				{Type: "bulk", Bulk: &id},
+				{Type: "bulk", Bulk: &pe.Consumer.Name},
+				{Type: "integer", Number: &idle},
+				{Type: "integer", Number: &pe.DeliveryCount},
+			},
+		})
+		if len(res) >= count {
+			break
+		}
+	}
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+// claimOpts are the XCLAIM options controlling what a claim does to a pending entry.
+type claimOpts struct {
+	deliveryTime int64
+	retryCount   int64 //-1 to increment the delivery count instead
+	force        bool
+	justID       bool
+	lastID       StreamID
+}
+
+// claimLocked hands a pending entry over to consumer if it has been idle for at least
+// minIdle. deleted is set if the entry is gone from the stream, in which case it's also
+// dropped from the PEL. Callers must hold XMutex.
+func (store *Store) claimLocked(stream *Stream, group *ConsumerGroup, consumer *Consumer, id StreamID, minIdle int64, now int64, opts claimOpts) (claimed bool, deleted bool) {
+	pe := group.Pending(id)
+	if pe == nil {
+		if !opts.force {
+			return false, false
+		}
+		if _, ok := stream.Entry(id); !ok {
+			return false, false
+		}
+		pe = stream.AddPending(group, consumer, id, 0)
+	}
+
+	if minIdle > 0 && now-pe.DeliveryTime < minIdle {
+		return false, false
+	}
+
+	if _, ok := stream.Entry(id); !ok {
+		stream.Ack(group, id)
+		return false, true
+	}
+
+	stream.AddPending(group, consumer, id, opts.deliveryTime)
+	switch {
+	case opts.retryCount >= 0:
+		pe.DeliveryCount = opts.retryCount
+	case !opts.justID:
+		pe.DeliveryCount++
+	}
+	consumer.ActiveTime = now
+
+	return true, false
+}
+
+// XClaim changes the owner of pending entries that have been idle for long enough:
+//
+//	XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-ms]
+//	       [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID id]
+func (store *Store) XClaim(args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		errStr := "wrong number of arguments for 'xclaim' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key, name, consumerName := *args[0].Bulk, *args[1].Bulk, *args[2].Bulk
+	minIdle, err := strconv.ParseInt(*args[3].Bulk, 10, 64)
+	if err != nil {
+		errStr := "Invalid min-idle-time argument for XCLAIM"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	minIdle = max(minIdle, 0)
+
+	now := time.Now().UnixMilli()
+	opts := claimOpts{deliveryTime: now, retryCount: -1}
+
+	ids := []StreamID{}
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := ParseStreamID(*args[i].Bulk, 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	lastIDGiven := false
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(*args[i].Bulk)
+		switch arg {
+		case "FORCE":
+			opts.force = true
+			continue
+		case "JUSTID":
+			opts.justID = true
+			continue
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 < len(args) {
+				break
+			}
+			fallthrough
+		default:
+			errStr := "Unrecognized XCLAIM option '" + *args[i].Bulk + "'"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		i++
+		if arg == "LASTID" {
+			id, err := ParseStreamID(*args[i].Bulk, 0)
+			if err != nil {
+				errStr := err.Error()
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			opts.lastID = id
+			lastIDGiven = true
+			continue
+		}
+
+		n, err := strconv.ParseInt(*args[i].Bulk, 10, 64)
+		if err != nil {
+			errStr := "Invalid " + arg + " option argument for XCLAIM"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		switch arg {
+		case "IDLE":
+			opts.deliveryTime = now - max(n, 0)
+		case "TIME":
+			opts.deliveryTime = min(n, now)
+		case "RETRYCOUNT":
+			opts.retryCount = max(n, 0)
+		}
+	}
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.Lock()
+	defer store.XMutex.Unlock()
+
+	stream, group := store.groupLocked(key, name)
+	if group == nil {
+		errStr := "NOGROUP No such key '" + key + "' or consumer group '" + name + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if lastIDGiven && group.LastID.Less(opts.lastID) {
+		group.LastID = opts.lastID
+	}
+
+	consumer, created := stream.Consumer(group, consumerName, now)
+	if created {
+		store.notify(NOTIFY_STREAM, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+
+	res := []resp.Value{}
+	for _, id := range ids {
+		if claimed, _ := store.claimLocked(stream, group, consumer, id, minIdle, now, opts); claimed {
+			res = append(res, store.claimedValue(stream, id, opts.justID))
+		}
+	}
+	store.track(key, stream)
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+// XAutoClaim claims idle pending entries in order, like XPENDING followed by XCLAIM:
+//
+//	XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+//
+// It replies with the ID to pass as start to continue scanning ("0-0" once the whole PEL
+// was seen), the claimed entries and the IDs of pending entries that no longer exist.
+func (store *Store) XAutoClaim(args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		errStr := "wrong number of arguments for 'xautoclaim' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key, name, consumerName := *args[0].Bulk, *args[1].Bulk, *args[2].Bulk
+	minIdle, err := strconv.ParseInt(*args[3].Bulk, 10, 64)
+	if err != nil {
+		errStr := "Invalid min-idle-time argument for XAUTOCLAIM"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	minIdle = max(minIdle, 0)
+
+	start, startOk, err := parseRangeID(*args[4].Bulk, false)
+	if err != nil {
+		errStr := err.Error()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(*args[i].Bulk) {
+		case "JUSTID":
+			justID = true
+		case "COUNT":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(*args[i+1].Bulk)
+				if err != nil || n < 1 || n > 1<<20 {
+					errStr := "COUNT must be > 0"
+					return resp.Value{
+						Type:   "error",
+						String: &errStr,
+					}
+				}
+				count = n
+				i++
+				continue
+			}
+			fallthrough
+		default:
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	opts := claimOpts{deliveryTime: now, retryCount: -1, justID: justID}
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.Lock()
+	defer store.XMutex.Unlock()
+
+	stream, group := store.groupLocked(key, name)
+	if group == nil {
+		errStr := "NOGROUP No such key '" + key + "' or consumer group '" + name + "'"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	consumer, created := stream.Consumer(group, consumerName, now)
+	if created {
+		store.notify(NOTIFY_STREAM, "xgroup-createconsumer", key)
+	}
+	consumer.SeenTime = now
+
+	claimed := []resp.Value{}
+	deleted := []resp.Value{}
+	cursor := MinStreamID
+	if startOk {
+		attempts := count * XAUTOCLAIM_ATTEMPTS_FACTOR
+		candidates := group.PendingRange(start, MaxStreamID, nil, 0)
+		for i, pe := range candidates {
+			if len(claimed) >= count || attempts == 0 {
+				cursor = candidates[i].ID
+				break
+			}
+			attempts--
+
+			id := pe.ID
+			ok, gone := store.claimLocked(stream, group, consumer, id, minIdle, now, opts)
+			switch {
+			case ok:
+				claimed = append(claimed, store.claimedValue(stream, id, justID))
+			case gone:
+				idStr := id.String()
+				deleted = append(deleted, resp.Value{Type: "bulk", Bulk: &idStr})
+			}
+		}
+	}
+	store.track(key, stream)
+
+	next := cursor.String()
+	return resp.Value{
+		Type: "array",
+		Array: []resp.Value{
+			{Type: "bulk", Bulk: &next},
+			{Type: "array", Array: claimed},
+			{Type: "array", Array: deleted},
+		},
+	}
+}
+
+func (store *Store) claimedValue(stream *Stream, id StreamID, justID bool) resp.Value {
+	if justID {
+		idStr := id.String()
+		return resp.Value{Type: "bulk", Bulk: &idStr}
+	}
+	return store.pendingEntryValue(stream, id)
+}
+
+// XInfo reports on streams, their groups and consumers:
+//
+//	XINFO STREAM key [FULL [COUNT count]]
+//	XINFO GROUPS key
+//	XINFO CONSUMERS key group
+func (store *Store) XInfo(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		errStr := "wrong number of arguments for 'xinfo' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	sub := strings.ToUpper(*args[0].Bulk)
+	key := *args[1].Bulk
+
+	full := false
+	count := 10
+	switch sub {
+	case "STREAM":
+		if len(args) > 2 {
+			if strings.ToUpper(*args[2].Bulk) != "FULL" || (len(args) != 3 && len(args) != 5) {
+				errStr := "syntax error"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			full = true
+
+			if len(args) == 5 {
+				n, err := strconv.Atoi(*args[4].Bulk)
+				if strings.ToUpper(*args[3].Bulk) != "COUNT" || err != nil {
+					errStr := "syntax error"
+					return resp.Value{
+						Type:   "error",
+						String: &errStr,
+					}
+				}
+				count = max(n, 0)
+			}
+		}
+	case "GROUPS":
+		if len(args) != 2 {
+			errStr := "wrong number of arguments for 'xinfo|groups' command"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			errStr := "wrong number of arguments for 'xinfo|consumers' command"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	default:
+		errStr := "unknown subcommand '" + *args[0].Bulk + "'. Try XINFO HELP."
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.RLock()
+	defer store.XMutex.RUnlock()
+
+	value, ok := store.Streams.Get(key)
+	if !ok {
+		errStr := "no such key"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+	stream := value.(*Stream)
+	now := time.Now().UnixMilli()
+
+	switch sub {
+	case "GROUPS":
+		res := []resp.Value{}
+		for _, name := range stream.GroupNames() {
+			res = append(res, groupInfo(stream, stream.Groups[name]))
+		}
+		return resp.Value{
+			Type:  "array",
+			Array: res,
+		}
+	case "CONSUMERS":
+		group := stream.Groups[*args[2].Bulk]
+		if group == nil {
+			errStr := "NOGROUP No such consumer group '" + *args[2].Bulk + "' for key name '" + key + "'"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		res := []resp.Value{}
+		for _, consumer := range sortedConsumers(group) {
+			inactive := int64(-1)
+			if consumer.ActiveTime != -1 {
+				inactive = now - consumer.ActiveTime
+			}
+			res = append(res, infoPairs(
+				"name", bulkValue(consumer.Name),
+				"pending", integerValue(int64(len(consumer.Pending))),
+				"idle", integerValue(now-consumer.SeenTime),
+				"inactive", integerValue(inactive),
+			))
+		}
+		return resp.Value{
+			Type:  "array",
+			Array: res,
+		}
+	}
+
+	firstID, _ := stream.FirstID()
+	info := []any{
+		"length", integerValue(int64(stream.Length)),
+		"radix-tree-keys", integerValue(int64(len(stream.Nodes))),
+		"radix-tree-nodes", integerValue(int64(len(stream.Nodes))),
+		"last-generated-id", bulkValue(stream.LastID.String()),
+		"max-deleted-entry-id", bulkValue(stream.MaxDeletedID.String()),
+		"entries-added", integerValue(int64(stream.EntriesAdded)),
+		"recorded-first-entry-id", bulkValue(firstID.String()),
+	}
+
+	if !full {
+		first, last := resp.Value{Type: "null"}, resp.Value{Type: "null"}
+		if entries := stream.Range(MinStreamID, MaxStreamID, 1, false); len(entries) > 0 {
+			first = streamEntriesValue(entries).Array[0]
+		}
+		if entries := stream.Range(MinStreamID, MaxStreamID, 1, true); len(entries) > 0 {
+			last = streamEntriesValue(entries).Array[0]
+		}
+
+		info = append(info,
+			"groups", integerValue(int64(len(stream.Groups))),
+			"first-entry", first,
+			"last-entry", last,
+		)
+		return infoPairs(info...)
+	}
+
+	groups := []resp.Value{}
+	for _, name := range stream.GroupNames() {
+		group := stream.Groups[name]
+
+		pel := []resp.Value{}
+		for _, pe := range group.PendingRange(MinStreamID, MaxStreamID, nil, count) {
+			pel = append(pel, arrayValue(
+				bulkValue(pe.ID.String()),
+				bulkValue(pe.Consumer.Name),
+				integerValue(pe.DeliveryTime),
+				integerValue(pe.DeliveryCount),
+			))
+		}
+
+		consumers := []resp.Value{}
+		for _, consumer := range sortedConsumers(group) {
+			cpel := []resp.Value{}
+			for _, pe := range group.PendingRange(MinStreamID, MaxStreamID, consumer, count) {
+				cpel = append(cpel, arrayValue(
+					bulkValue(pe.ID.String()),
+					integerValue(pe.DeliveryTime),
+					integerValue(pe.DeliveryCount),
+				))
+			}
+
+			consumers = append(consumers, infoPairs(
+				"name", bulkValue(consumer.Name),
+				"seen-time", integerValue(consumer.SeenTime),
+				"active-time", integerValue(consumer.ActiveTime),
+				"pel-count", integerValue(int64(len(consumer.Pending))),
+				"pending", arrayValue(cpel...),
+			))
+		}
+
+		groupFields := groupInfo(stream, group).Array
+		groups = append(groups, infoPairs(
+			"name", groupFields[1],
+			"last-delivered-id", groupFields[7],
+			"entries-read", groupFields[9],
+			"lag", groupFields[11],
+			"pel-count", integerValue(int64(len(group.PEL))),
+			"pending", arrayValue(pel...),
+			"consumers", arrayValue(consumers...),
+		))
+	}
+
+	info = append(info,
+		"entries", streamEntriesValue(stream.Range(MinStreamID, MaxStreamID, count, false)),
+		"groups", arrayValue(groups...),
+	)
+	return infoPairs(info...)
+}
+
+// groupInfo describes a group the way XINFO GROUPS does.
+func groupInfo(stream *Stream, group *ConsumerGroup) resp.Value {
+	entriesRead := resp.Value{Type: "null"}
+	if group.EntriesRead != -1 {
+		entriesRead = integerValue(group.EntriesRead)
+	}
+
+	lag := resp.Value{Type: "null"}
+	if n, ok := stream.Lag(group); ok {
+		lag = integerValue(n)
+	}
+
+	return infoPairs(
+		"name", bulkValue(group.Name),
+		"consumers", integerValue(int64(len(group.Consumers))),
+		"pending", integerValue(int64(len(group.PEL))),
+		"last-delivered-id", bulkValue(group.LastID.String()),
+		"entries-read", entriesRead,
+		"lag", lag,
+	)
+}
+
+func sortedConsumers(group *ConsumerGroup) []*Consumer {
+	names := make([]string, 0, len(group.Consumers))
+	for name := range group.Consumers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	consumers := make([]*Consumer, len(names))
+	for i, name := range names {
+		consumers[i] = group.Consumers[name]
+	}
+	return consumers
+}
+
+// infoPairs builds a map of field names to values, a flat array of alternating names and
+// values under RESP2.
+func infoPairs(pairs ...any) resp.Value {
+	res := make([]resp.Value, 0, len(pairs))
+	for i := 0; i < len(pairs); i += 2 {
+		res = append(res, bulkValue(pairs[i].(string)), pairs[i+1].(resp.Value))
+	}
+	return resp.Value{Type: "map", Array: res}
+}
+
+func arrayValue(values ...resp.Value) resp.Value {
+	if values == nil {
+		values = []resp.Value{}
+	}
+	return resp.Value{Type: "array", Array: values}
+}
+
+func bulkValue(s string) resp.Value {
+	return resp.Value{Type: "bulk", Bulk: &s}
+}
+
+func integerValue(n int64) resp.Value {
+	return resp.Value{Type: "integer", Number: &n}
+}
@@ -8,4 +8,5 @@ import (
 type HSet struct {
 	Hset      *utils.HashMap
 	ExpiresAt time.Time
+	Bytes     int //approximate memory used by the fields, for maxmemory accounting
 }
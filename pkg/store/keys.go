@@ -0,0 +1,585 @@
+package store
+
+import (
+	"math/rand/v2"
+	"reredis/pkg/resp"
+	"reredis/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyspace pairs one of the typed maps in the store with the mutex guarding it.
+type keyspace struct {
+	hMap  *utils.HashMap
+	mutex *sync.RWMutex
+}
+
+// keyspaces returns every typed map in the store, always in the same order so that
+// commands touching more than one of them lock in a consistent order.
+func (store *Store) keyspaces() []keyspace {
+	return []keyspace{
+		{hMap: store.Pairs, mutex: &store.Mutex},
+		{hMap: store.Hsets, mutex: &store.HMutex},
+		{hMap: store.Lists, mutex: &store.LMutex},
+		{hMap: store.Streams, mutex: &store.XMutex},
+		{hMap: store.Geos, mutex: &store.GMutex},
+	}
+}
+
+// lockAll write-locks every keyspace plus the expires index.
+func (store *Store) lockAll() {
+	store.lockKeyspaces()
+	store.EMutex.Lock()
+}
+
+func (store *Store) unlockAll() {
+	store.EMutex.Unlock()
+	store.unlockKeyspaces()
+}
+
+// lockKeyspaces write-locks every keyspace but not the expires index, for callers that
+// use track and forget.
+func (store *Store) lockKeyspaces() {
+	for _, ks := range store.keyspaces() {
+		ks.mutex.Lock()
+	}
+}
+
+func (store *Store) unlockKeyspaces() {
+	spaces := store.keyspaces()
+	for i := len(spaces) - 1; i >= 0; i-- {
+		spaces[i].mutex.Unlock()
+	}
+}
+
+func (store *Store) rLockAll() {
+	for _, ks := range store.keyspaces() {
+		ks.mutex.RLock()
+	}
+	store.EMutex.RLock()
+}
+
+func (store *Store) rUnlockAll() {
+	store.EMutex.RUnlock()
+	spaces := store.keyspaces()
+	for i := len(spaces) - 1; i >= 0; i-- {
+		spaces[i].mutex.RUnlock()
+	}
+}
+
+// existsLocked reports whether key holds a live value in any keyspace. Callers must hold the locks.
+func (store *Store) existsLocked(key string, now time.Time) bool {
+	for _, ks := range store.keyspaces() {
+		value, ok := ks.hMap.Get(key)
+		if ok && !isExpired(value, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// WRONGTYPE_ERR is the reply to a command run against a key holding another data type.
+const WRONGTYPE_ERR = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// heldElsewhere reports whether key holds a live value in a keyspace other than hMap, which
+// typed commands answer with WRONGTYPE. It takes the other keyspaces' read locks one at a
+// time, so callers mustn't hold any store locks. That's only good enough for reads, writes
+// go through lockForWrite.
+func (store *Store) heldElsewhere(key string, hMap *utils.HashMap) bool {
+	now := time.Now()
+	for _, ks := range store.keyspaces() {
+		if ks.hMap == hMap {
+			continue
+		}
+		ks.mutex.RLock()
+		value, ok := ks.hMap.Get(key)
+		ks.mutex.RUnlock()
+		if ok && !isExpired(value, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrongType reports whether key holds another type rather than a value in hMap, guarded by
+// mutex, for commands that only read or change existing values. Callers mustn't hold any
+// store locks.
+func (store *Store) wrongType(key string, hMap *utils.HashMap, mutex *sync.RWMutex) bool {
+	mutex.RLock()
+	_, ok := hMap.Get(key)
+	mutex.RUnlock()
+	return !ok && store.heldElsewhere(key, hMap)
+}
+
+// heldElsewhereLocked is heldElsewhere for callers holding every keyspace's lock.
+func (store *Store) heldElsewhereLocked(key string, hMap *utils.HashMap) bool {
+	now := time.Now()
+	for _, ks := range store.keyspaces() {
+		if ks.hMap == hMap {
+			continue
+		}
+		value, ok := ks.hMap.Get(key)
+		if ok && !isExpired(value, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockForWrite write-locks the keyspace hMap, guarded by mutex, for a typed write to key,
+// unless key holds another type. If key is already live in hMap, that lock is enough: a
+// key is only created with every keyspace locked after checking the others, so no other
+// type can take it meanwhile. Otherwise every keyspace stays locked, so checking the
+// others and creating the key happen atomically. It returns the function to unlock with,
+// or false, with nothing locked, if key holds another type.
+func (store *Store) lockForWrite(key string, hMap *utils.HashMap, mutex *sync.RWMutex) (func(), bool) {
+	mutex.Lock()
+	if value, ok := hMap.Get(key); ok && !isExpired(value, time.Now()) {
+		return mutex.Unlock, true
+	}
+	mutex.Unlock()
+
+	store.lockKeyspaces()
+	if store.heldElsewhereLocked(key, hMap) {
+		store.unlockKeyspaces()
+		return nil, false
+	}
+	return store.unlockKeyspaces, true
+}
+
+func wrongTypeValue() resp.Value {
+	errStr := WRONGTYPE_ERR
+	return resp.Value{
+		Type:   "error",
+		String: &errStr,
+	}
+}
+
+// deleteLocked removes key from every keyspace along with its expiry and accounting. Callers must hold the write locks.
+func (store *Store) deleteLocked(key string) {
+	for _, ks := range store.keyspaces() {
+		ks.hMap.Delete(key)
+	}
+	store.forgetLocked(key)
+}
+
+// Keys returns every live key whose name matches the glob pattern, across all data types.
+func (store *Store) Keys(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		errStr := "wrong number of arguments for 'keys' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	pattern := *args[0].Bulk
+	now := time.Now()
+	seen := map[string]bool{} //a key can live in more than one keyspace
+	res := []resp.Value{}
+
+	for _, ks := range store.keyspaces() {
+		ks.mutex.RLock()
+		ks.hMap.Range(func(key string, value any) bool {
+			if seen[key] || isExpired(value, now) {
+				return true
+			}
+			if utils.GlobMatch(pattern, key, false) {
+				seen[key] = true
+				res = append(res, resp.Value{
+					Type: "bulk",
+					Bulk: &key,
+				})
+			}
+			return true
+		})
+		ks.mutex.RUnlock()
+	}
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+// Rename moves the value at src (along with its expiry) to dst, overwriting dst.
+func (store *Store) Rename(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'rename' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	store.lockAll()
+	defer store.unlockAll()
+
+	if !store.renameLocked(*args[0].Bulk, *args[1].Bulk) {
+		errStr := "no such key"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	ok := "OK"
+	return resp.Value{
+		Type:   "string",
+		String: &ok,
+	}
+}
+
+// RenameNX is like Rename but only succeeds if dst does not exist yet.
+func (store *Store) RenameNX(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'renamenx' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	src := *args[0].Bulk
+	dst := *args[1].Bulk
+
+	store.lockAll()
+	defer store.unlockAll()
+
+	now := time.Now()
+	if !store.existsLocked(src, now) {
+		errStr := "no such key"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	res := int64(0)
+	if !store.existsLocked(dst, now) {
+		store.renameLocked(src, dst)
+		res = 1
+	}
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// renameLocked moves src to dst in every keyspace it lives in. Callers must hold the write locks.
+func (store *Store) renameLocked(src string, dst string) bool {
+	now := time.Now()
+	if !store.existsLocked(src, now) {
+		return false
+	}
+
+	if src == dst {
+		return true
+	}
+
+	store.deleteLocked(dst)
+	for _, ks := range store.keyspaces() {
+		value, ok := ks.hMap.Get(src)
+		if !ok {
+			continue
+		}
+		ks.hMap.Delete(src)
+		if !isExpired(value, now) {
+			ks.hMap.Set(dst, value)
+			store.trackLocked(dst, value)
+		}
+	}
+	store.forgetLocked(src)
+
+	store.notify(NOTIFY_GENERIC, "rename_from", src)
+	store.notify(NOTIFY_GENERIC, "rename_to", dst)
+
+	return true
+}
+
+// Copy duplicates the value at src into dst. Returns 1 if copied, 0 if dst already exists
+// (without REPLACE) or src is missing.
+func (store *Store) Copy(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		errStr := "wrong number of arguments for 'copy' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	src := *args[0].Bulk
+	dst := *args[1].Bulk
+	replace := false
+	dbIdx := store.Index
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(*args[i].Bulk) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				errStr := "syntax error"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			i++
+			idx, err := strconv.Atoi(*args[i].Bulk)
+			if err != nil {
+				errStr := "value is not an integer or out of range"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
+				}
+			}
+			dbIdx = idx
+		default:
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	target := store
+	if dbIdx != store.Index {
+		var ok bool
+		target, ok = store.Databases.Get(dbIdx)
+		if !ok {
+			errStr := "DB index is out of range"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	if src == dst && target == store {
+		errStr := "source and destination objects are the same"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	lockPair(store, target)
+	defer unlockPair(store, target)
+
+	now := time.Now()
+	res := int64(0)
+	if store.existsLocked(src, now) && (replace || !target.existsLocked(dst, now)) {
+		target.deleteLocked(dst)
+		srcSpaces := store.keyspaces()
+		for i, ks := range target.keyspaces() {
+			value, ok := srcSpaces[i].hMap.Get(src)
+			if ok && !isExpired(value, now) {
+				dup := copyValue(value)
+				ks.hMap.Set(dst, dup)
+				target.trackLocked(dst, dup)
+			}
+		}
+		target.notify(NOTIFY_GENERIC, "copy_to", dst)
+		res = 1
+	}
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// Move transfers key to another logical database.
+func (store *Store) Move(args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		errStr := "wrong number of arguments for 'move' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	dbIdx, err := strconv.Atoi(*args[1].Bulk)
+	if err != nil {
+		errStr := "value is not an integer or out of range"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	target, ok := store.Databases.Get(dbIdx)
+	if !ok {
+		errStr := "DB index is out of range"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if target == store {
+		errStr := "source and destination objects are the same"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+
+	lockPair(store, target)
+	defer unlockPair(store, target)
+
+	//like redis, nothing is moved if the key already exists in the target database
+	now := time.Now()
+	res := int64(0)
+	if store.existsLocked(key, now) && !target.existsLocked(key, now) {
+		srcSpaces := store.keyspaces()
+		for i, ks := range target.keyspaces() {
+			value, ok := srcSpaces[i].hMap.Get(key)
+			if !ok {
+				continue
+			}
+			srcSpaces[i].hMap.Delete(key)
+			if !isExpired(value, now) {
+				ks.hMap.Set(key, value)
+				target.trackLocked(key, value)
+			}
+		}
+		store.forgetLocked(key)
+		store.notify(NOTIFY_GENERIC, "move_from", key)
+		target.notify(NOTIFY_GENERIC, "move_to", key)
+		res = 1
+	}
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// RandomKey returns a random live key, or null if the store is empty.
+func (store *Store) RandomKey(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		errStr := "wrong number of arguments for 'randomkey' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	now := time.Now()
+
+	//pick a keyspace weighted by its size, then a random entry inside it.
+	//expired entries are skipped, giving up after a few tries like redis does
+	for tries := 0; tries < 100; tries++ {
+		store.rLockAll()
+		total := 0
+		for _, ks := range store.keyspaces() {
+			total += ks.hMap.Count
+		}
+		if total == 0 {
+			store.rUnlockAll()
+			break
+		}
+
+		pick := rand.IntN(total)
+		var key string
+		var value any
+		for _, ks := range store.keyspaces() {
+			if pick < ks.hMap.Count {
+				key, value, _ = ks.hMap.RandomEntry()
+				break
+			}
+			pick -= ks.hMap.Count
+		}
+		store.rUnlockAll()
+
+		if value != nil && !isExpired(value, now) {
+			return resp.Value{
+				Type: "bulk",
+				Bulk: &key,
+			}
+		}
+	}
+
+	return resp.Value{
+		Type: "null",
+	}
+}
+
+// DBSize returns the number of keys in the store. Like redis, keys that have expired but
+// haven't been reclaimed yet are still counted.
+func (store *Store) DBSize(args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		errStr := "wrong number of arguments for 'dbsize' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	total := 0
+	store.rLockAll()
+	for _, ks := range store.keyspaces() {
+		total += ks.hMap.Count
+	}
+	store.rUnlockAll()
+
+	res := int64(total)
+	return resp.Value{
+		Type:   "integer",
+		Number: &res,
+	}
+}
+
+// isExpired checks whether a value stored in one of the keyspaces has passed its expiry.
+// Types without an expiry, and values with a zero expiry, never expire.
+func isExpired(value any, now time.Time) bool {
+	switch v := value.(type) {
+	case ValueStringObj:
+		return !v.ExpiresAt.IsZero() && now.After(v.ExpiresAt)
+	case *HSet:
+		return !v.ExpiresAt.IsZero() && now.After(v.ExpiresAt)
+	default:
+		return false
+	}
+}
+
+// copyValue returns a deep copy of a stored value so the copy can be mutated independently.
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case *HSet:
+		hset := &HSet{
+			Hset:      utils.NewHashMap(len(v.Hset.Buckets)),
+			ExpiresAt: v.ExpiresAt,
+			Bytes:     v.Bytes,
+		}
+		v.Hset.Range(func(key string, value any) bool {
+			hset.Hset.Set(key, value)
+			return true
+		})
+		return hset
+	case *Deque:
+		dq := &Deque{
+			Buffer: make([]string, len(v.Buffer)),
+			Head:   v.Head,
+			Tail:   v.Tail,
+			Size:   v.Size,
+			Bytes:  v.Bytes,
+		}
+		copy(dq.Buffer, v.Buffer)
+		return dq
+	case *Stream:
+		return v.Copy()
+	case *GeoSet:
+		return v.Copy()
+	default: //plain values like ValueStringObj are copied on assignment
+		return value
+	}
+}
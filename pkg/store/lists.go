@@ -5,6 +5,7 @@ type Deque struct {
 	Head   int
 	Tail   int
 	Size   int
+	Bytes  int //approximate memory used by the elements, for maxmemory accounting
 }
 
 func NewDeque(size int) *Deque {
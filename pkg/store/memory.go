@@ -0,0 +1,154 @@
+package store
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Sizes here are approximations of what a value costs in memory, good enough to compare
+// against maxmemory. Containers keep a running byte count of their elements so sizing
+// a key is O(1) no matter how big it gets.
+const (
+	KEY_OVERHEAD        = 64 //map entry, key meta and the value header
+	LIST_ENTRY_OVERHEAD = 16
+	HASH_ENTRY_OVERHEAD = 48
+)
+
+// LFU counters are logarithmic like in redis: the more hits a key has, the less likely
+// the next one is to bump the counter. Counters decay by one every LFU_DECAY_TIME minutes.
+const (
+	LFU_INIT_VAL   = 5
+	LFU_LOG_FACTOR = 10
+	LFU_DECAY_TIME = 1
+)
+
+// KeyMeta is the bookkeeping kept for every key, used for memory accounting and to
+// pick eviction candidates.
+type KeyMeta struct {
+	Size       int64 //approximate bytes used by the key and its value
+	LastAccess int64 //unix millis, for LRU
+	Freq       uint8 //logarithmic access counter, for LFU
+	FreqDecr   int64 //unix minutes the counter was last decayed
+}
+
+// objectSize estimates how many bytes key and its value take up.
+func objectSize(key string, value any) int64 {
+	size := int64(KEY_OVERHEAD + len(key))
+
+	switch v := value.(type) {
+	case ValueStringObj:
+		size += int64(len(v.Value))
+	case *Deque:
+		size += int64(v.Bytes)
+	case *HSet:
+		size += int64(v.Bytes)
+	case *Stream:
+		size += int64(v.Bytes)
+	case *GeoSet:
+		size += int64(v.Bytes)
+	}
+
+	return size
+}
+
+// trackLocked does the bookkeeping for a value that was just written to one of the
+// keyspaces: records its expiry and accounts for its size. Callers must hold EMutex.
+func (store *Store) trackLocked(key string, value any) {
+	var expiresAt time.Time
+	switch v := value.(type) {
+	case ValueStringObj:
+		expiresAt = v.ExpiresAt
+	case *HSet:
+		expiresAt = v.ExpiresAt
+	}
+	if expiresAt.IsZero() {
+		store.Expires.Delete(key) //overwritten without a TTL
+	} else {
+		store.Expires.Set(key, expiresAt)
+	}
+
+	if _, ok := store.Meta.Get(key); !ok {
+		store.notify(NOTIFY_NEW, "new", key)
+	}
+
+	meta := store.metaLocked(key)
+	size := objectSize(key, value)
+	store.Stats.UsedMemory.Add(size - meta.Size)
+	meta.Size = size
+	meta.touch(time.Now())
+}
+
+// track is trackLocked for callers holding only the lock of the keyspace they wrote to.
+func (store *Store) track(key string, value any) {
+	store.EMutex.Lock()
+	store.trackLocked(key, value)
+	store.EMutex.Unlock()
+}
+
+// forgetLocked drops the expiry and accounting of a deleted key. Callers must hold EMutex.
+func (store *Store) forgetLocked(key string) {
+	store.Expires.Delete(key)
+
+	if meta, ok := store.Meta.Get(key); ok {
+		store.Stats.UsedMemory.Add(-meta.(*KeyMeta).Size)
+		store.Meta.Delete(key)
+	}
+}
+
+// forget is forgetLocked for callers holding only the lock of the keyspace they deleted from.
+func (store *Store) forget(key string) {
+	store.EMutex.Lock()
+	store.forgetLocked(key)
+	store.EMutex.Unlock()
+}
+
+// touch records a read of key for LRU/LFU.
+func (store *Store) touch(key string) {
+	store.EMutex.Lock()
+	if meta, ok := store.Meta.Get(key); ok {
+		meta.(*KeyMeta).touch(time.Now())
+	}
+	store.EMutex.Unlock()
+}
+
+// metaLocked returns the meta of key, creating it if needed. Callers must hold EMutex.
+func (store *Store) metaLocked(key string) *KeyMeta {
+	meta, ok := store.Meta.Get(key)
+	if !ok {
+		now := time.Now()
+		meta = &KeyMeta{
+			LastAccess: now.UnixMilli(),
+			Freq:       LFU_INIT_VAL,
+			FreqDecr:   now.Unix() / 60,
+		}
+		store.Meta.Set(key, meta)
+	}
+
+	return meta.(*KeyMeta)
+}
+
+func (meta *KeyMeta) touch(now time.Time) {
+	meta.LastAccess = now.UnixMilli()
+	meta.Freq = meta.decayedFreq(now)
+	meta.FreqDecr = now.Unix() / 60
+
+	if meta.Freq == 255 {
+		return
+	}
+	base := float64(meta.Freq) - LFU_INIT_VAL
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*LFU_LOG_FACTOR+1) {
+		meta.Freq++
+	}
+}
+
+// decayedFreq returns the LFU counter after applying the decay for the time since it was last touched.
+func (meta *KeyMeta) decayedFreq(now time.Time) uint8 {
+	periods := (now.Unix()/60 - meta.FreqDecr) / LFU_DECAY_TIME
+	if periods >= int64(meta.Freq) {
+		return 0
+	}
+	return meta.Freq - uint8(periods)
+}
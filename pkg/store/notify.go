@@ -0,0 +1,113 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Keyspace notification classes, set through notify-keyspace-events. A notification is
+// only published if its class is enabled along with K (keyspace channel) and/or E
+// (keyevent channel).
+const (
+	NOTIFY_KEYSPACE = 1 << iota //K
+	NOTIFY_KEYEVENT             //E
+	NOTIFY_GENERIC              //g: del, rename, expire, ...
+	NOTIFY_STRING               //$
+	NOTIFY_LIST                 //l
+	NOTIFY_SET                  //s
+	NOTIFY_HASH                 //h
+	NOTIFY_ZSET                 //z
+	NOTIFY_EXPIRED              //x
+	NOTIFY_EVICTED              //e
+	NOTIFY_STREAM               //t
+	NOTIFY_NEW                  //n: key created, not part of A
+
+	NOTIFY_ALL = NOTIFY_GENERIC | NOTIFY_STRING | NOTIFY_LIST | NOTIFY_SET | NOTIFY_HASH | NOTIFY_ZSET | NOTIFY_EXPIRED | NOTIFY_EVICTED | NOTIFY_STREAM //A
+)
+
+// notifyClasses maps each flag character to its class, in the order they're printed back.
+var notifyClasses = []struct {
+	flag  byte
+	class int
+}{
+	{'g', NOTIFY_GENERIC},
+	{'$', NOTIFY_STRING},
+	{'l', NOTIFY_LIST},
+	{'s', NOTIFY_SET},
+	{'h', NOTIFY_HASH},
+	{'z', NOTIFY_ZSET},
+	{'x', NOTIFY_EXPIRED},
+	{'e', NOTIFY_EVICTED},
+	{'t', NOTIFY_STREAM},
+	{'n', NOTIFY_NEW},
+	{'K', NOTIFY_KEYSPACE},
+	{'E', NOTIFY_KEYEVENT},
+}
+
+// ParseNotifyFlags turns a notify-keyspace-events string like "Ex" into class flags.
+func ParseNotifyFlags(s string) (int, error) {
+	flags := 0
+
+outer:
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NOTIFY_ALL
+			continue
+		}
+
+		for _, c := range notifyClasses {
+			if c.flag == s[i] {
+				flags |= c.class
+				continue outer
+			}
+		}
+
+		return 0, fmt.Errorf("invalid notify-keyspace-events class %q", s[i])
+	}
+
+	return flags, nil
+}
+
+// NotifyFlagsString is the inverse of ParseNotifyFlags.
+func NotifyFlagsString(flags int) string {
+	var sb strings.Builder
+
+	if flags&NOTIFY_ALL == NOTIFY_ALL {
+		sb.WriteByte('A')
+	}
+
+	for _, c := range notifyClasses {
+		if flags&NOTIFY_ALL == NOTIFY_ALL && c.class&NOTIFY_ALL != 0 {
+			continue
+		}
+		if flags&c.class != 0 {
+			sb.WriteByte(c.flag)
+		}
+	}
+
+	return sb.String()
+}
+
+// notify publishes a keyspace notification for event on key, if its class is enabled:
+//
+//	__keyspace@<db>__:<key>   with the event as the message
+//	__keyevent@<db>__:<event> with the key as the message
+func (store *Store) notify(class int, event string, key string) {
+	if store.Databases == nil || store.Databases.PubSub == nil {
+		return
+	}
+
+	flags := store.Databases.Config().NotifyFlags
+	if flags&class == 0 {
+		return
+	}
+
+	db := strconv.Itoa(store.Index)
+	if flags&NOTIFY_KEYSPACE != 0 {
+		store.Databases.PubSub.Publish("__keyspace@"+db+"__:"+key, event)
+	}
+	if flags&NOTIFY_KEYEVENT != 0 {
+		store.Databases.PubSub.Publish("__keyevent@"+db+"__:"+event, key)
+	}
+}
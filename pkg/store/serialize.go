@@ -0,0 +1,332 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"reredis/pkg/utils"
+)
+
+// Serialized values look like:
+//
+//	<type byte> <type specific body> <2 byte version> <8 byte crc64>
+//
+// Strings in the body are length prefixed with a uvarint. The version and checksum
+// trailer let RESTORE reject payloads from an incompatible build or that got mangled
+// on the way.
+const (
+	DUMP_VERSION = 1
+
+	dumpTypeString = 0
+	dumpTypeList   = 1
+	dumpTypeHash   = 4
+	dumpTypeGeo    = 5
+	dumpTypeStream = 15
+)
+
+var (
+	crcTable = crc64.MakeTable(crc64.ECMA)
+
+	ErrBadPayload = errors.New("DUMP payload version or checksum are wrong")
+)
+
+// serializeValue encodes a stored value into a self contained payload.
+// Expiry is not part of the payload, it's passed separately to RESTORE.
+func serializeValue(value any) ([]byte, bool) {
+	var buf []byte
+
+	switch v := value.(type) {
+	case ValueStringObj:
+		buf = append(buf, dumpTypeString)
+		buf = appendString(buf, v.Value)
+	case *Deque:
+		buf = append(buf, dumpTypeList)
+		buf = binary.AppendUvarint(buf, uint64(v.Size))
+		for i := 0; i < v.Size; i++ {
+			buf = appendString(buf, v.Buffer[v.Wrap(v.Head+i)])
+		}
+	case *HSet:
+		buf = append(buf, dumpTypeHash)
+		buf = binary.AppendUvarint(buf, uint64(v.Hset.Count))
+		v.Hset.Range(func(key string, value any) bool {
+			field, _ := value.(ValueStringObj)
+			buf = appendString(buf, key)
+			buf = appendString(buf, field.Value)
+			return true
+		})
+	case *Stream:
+		buf = append(buf, dumpTypeStream)
+		buf = appendStreamID(buf, v.LastID)
+		buf = appendStreamID(buf, v.MaxDeletedID)
+		buf = binary.AppendUvarint(buf, v.EntriesAdded)
+		buf = binary.AppendUvarint(buf, uint64(v.Length))
+		for _, entry := range v.Range(MinStreamID, MaxStreamID, 0, false) {
+			buf = appendStreamID(buf, entry.ID)
+			buf = binary.AppendUvarint(buf, uint64(len(entry.Fields)))
+			for _, field := range entry.Fields {
+				buf = appendString(buf, field)
+			}
+		}
+		buf = appendGroups(buf, v)
+	case *GeoSet:
+		buf = append(buf, dumpTypeGeo)
+		buf = binary.AppendUvarint(buf, uint64(v.Index.Length))
+		for node := v.Index.First(math.Inf(-1)); node != nil; node = node.Next() {
+			buf = appendString(buf, node.Member)
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(node.Score))
+		}
+	default:
+		return nil, false
+	}
+
+	buf = binary.LittleEndian.AppendUint16(buf, DUMP_VERSION)
+	buf = binary.LittleEndian.AppendUint64(buf, crc64.Checksum(buf, crcTable))
+
+	return buf, true
+}
+
+// deserializeValue decodes a payload produced by serializeValue. Strings and hashes
+// come back without an expiry set, the caller is expected to fill it in.
+func deserializeValue(payload []byte) (any, error) {
+	if len(payload) < 11 { //type byte + version + checksum
+		return nil, ErrBadPayload
+	}
+
+	body := payload[:len(payload)-8]
+	if binary.LittleEndian.Uint64(payload[len(payload)-8:]) != crc64.Checksum(body, crcTable) {
+		return nil, ErrBadPayload
+	}
+
+	if binary.LittleEndian.Uint16(body[len(body)-2:]) > DUMP_VERSION {
+		return nil, ErrBadPayload
+	}
+
+	dec := &decoder{buf: body[1 : len(body)-2]}
+
+	var value any
+	switch body[0] {
+	case dumpTypeString:
+		value = ValueStringObj{Value: dec.readString()}
+	case dumpTypeList:
+		size := dec.readLen()
+		dq := NewDeque(max(size, 4))
+		for i := 0; i < size && dec.err == nil; i++ {
+			dq.Buffer[i] = dec.readString()
+			dq.Bytes += len(dq.Buffer[i]) + LIST_ENTRY_OVERHEAD
+		}
+		dq.Size = size
+		dq.Tail = dq.Wrap(size)
+		value = dq
+	case dumpTypeHash:
+		size := dec.readLen()
+		hset := &HSet{
+			Hset: utils.NewHashMap(max(size*2, 4)),
+		}
+		for i := 0; i < size && dec.err == nil; i++ {
+			field := dec.readString()
+			val := dec.readString()
+			hset.Hset.Set(field, ValueStringObj{Value: val})
+			hset.Bytes += len(field) + len(val) + HASH_ENTRY_OVERHEAD
+		}
+		value = hset
+	case dumpTypeGeo:
+		size := dec.readLen()
+		gs := NewGeoSet()
+		for i := 0; i < size && dec.err == nil; i++ {
+			member := dec.readString()
+			gs.Add(member, dec.readFloat())
+		}
+		value = gs
+	case dumpTypeStream:
+		stream := NewStream()
+		lastID := dec.readStreamID()
+		maxDeletedID := dec.readStreamID()
+		entriesAdded := dec.readUint()
+		size := dec.readLen()
+		for i := 0; i < size && dec.err == nil; i++ {
+			id := dec.readStreamID()
+			fields := make([]string, dec.readLen())
+			for j := range fields {
+				fields[j] = dec.readString()
+			}
+			if len(fields) == 0 || len(fields)%2 != 0 || !stream.LastID.Less(id) {
+				return nil, ErrBadPayload
+			}
+			stream.Append(id, fields)
+		}
+		if lastID.Less(stream.LastID) { //XADD would hand out IDs the stream already has
+			return nil, ErrBadPayload
+		}
+		stream.LastID = lastID
+		stream.MaxDeletedID = maxDeletedID
+		stream.EntriesAdded = entriesAdded
+		if !dec.readGroups(stream) {
+			return nil, ErrBadPayload
+		}
+		value = stream
+	default:
+		return nil, ErrBadPayload
+	}
+
+	if dec.err != nil || len(dec.buf) != 0 {
+		return nil, ErrBadPayload
+	}
+
+	return value, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendStreamID(buf []byte, id StreamID) []byte {
+	buf = binary.AppendUvarint(buf, id.Ms)
+	return binary.AppendUvarint(buf, id.Seq)
+}
+
+// decoder reads length prefixed fields off a payload, remembering the first error
+// so callers can check once at the end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (dec *decoder) readLen() int {
+	if dec.err != nil {
+		return 0
+	}
+
+	n, size := binary.Uvarint(dec.buf)
+	if size <= 0 || n > uint64(len(dec.buf)) { //every element takes at least a byte
+		dec.err = ErrBadPayload
+		return 0
+	}
+	dec.buf = dec.buf[size:]
+
+	return int(n)
+}
+
+func (dec *decoder) readString() string {
+	n := dec.readLen()
+	if dec.err != nil {
+		return ""
+	}
+
+	s := string(dec.buf[:n])
+	dec.buf = dec.buf[n:]
+
+	return s
+}
+
+// readUint reads a plain uvarint, for numbers that aren't lengths.
+func (dec *decoder) readUint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+
+	n, size := binary.Uvarint(dec.buf)
+	if size <= 0 {
+		dec.err = ErrBadPayload
+		return 0
+	}
+	dec.buf = dec.buf[size:]
+
+	return n
+}
+
+// appendGroups encodes the consumer groups of a stream, with their consumers and
+// pending entries so they survive a DUMP/RESTORE.
+func appendGroups(buf []byte, stream *Stream) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(stream.Groups)))
+	for _, name := range stream.GroupNames() {
+		group := stream.Groups[name]
+		buf = appendString(buf, name)
+		buf = appendStreamID(buf, group.LastID)
+		buf = binary.AppendVarint(buf, group.EntriesRead)
+
+		buf = binary.AppendUvarint(buf, uint64(len(group.Consumers)))
+		for _, consumer := range sortedConsumers(group) {
+			buf = appendString(buf, consumer.Name)
+			buf = binary.AppendVarint(buf, consumer.SeenTime)
+			buf = binary.AppendVarint(buf, consumer.ActiveTime)
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(group.PEL)))
+		for _, pe := range group.PEL {
+			buf = appendStreamID(buf, pe.ID)
+			buf = appendString(buf, pe.Consumer.Name)
+			buf = binary.AppendVarint(buf, pe.DeliveryTime)
+			buf = binary.AppendVarint(buf, pe.DeliveryCount)
+		}
+	}
+
+	return buf
+}
+
+// readGroups decodes what appendGroups wrote into stream, returning false if it doesn't add up.
+func (dec *decoder) readGroups(stream *Stream) bool {
+	groups := dec.readLen()
+	for i := 0; i < groups && dec.err == nil; i++ {
+		name := dec.readString()
+		lastID := dec.readStreamID()
+		if !stream.CreateGroup(name, lastID, dec.readInt()) {
+			return false
+		}
+		group := stream.Groups[name]
+
+		consumers := dec.readLen()
+		for j := 0; j < consumers && dec.err == nil; j++ {
+			consumer, _ := stream.Consumer(group, dec.readString(), 0)
+			consumer.SeenTime = dec.readInt()
+			consumer.ActiveTime = dec.readInt()
+		}
+
+		pending := dec.readLen()
+		for j := 0; j < pending && dec.err == nil; j++ {
+			id := dec.readStreamID()
+			consumer, ok := group.Consumers[dec.readString()]
+			if !ok {
+				return false
+			}
+			pe := stream.AddPending(group, consumer, id, dec.readInt())
+			pe.DeliveryCount = dec.readInt()
+		}
+	}
+
+	return dec.err == nil
+}
+
+func (dec *decoder) readFloat() float64 {
+	if dec.err != nil || len(dec.buf) < 8 {
+		dec.err = ErrBadPayload
+		return 0
+	}
+
+	f := math.Float64frombits(binary.LittleEndian.Uint64(dec.buf))
+	dec.buf = dec.buf[8:]
+
+	return f
+}
+
+// readInt reads a signed varint.
+func (dec *decoder) readInt() int64 {
+	if dec.err != nil {
+		return 0
+	}
+
+	n, size := binary.Varint(dec.buf)
+	if size <= 0 {
+		dec.err = ErrBadPayload
+		return 0
+	}
+	dec.buf = dec.buf[size:]
+
+	return n
+}
+
+func (dec *decoder) readStreamID() StreamID {
+	ms := dec.readUint()
+	return StreamID{Ms: ms, Seq: dec.readUint()}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"reredis/pkg/resp"
+	"strings"
+	"sync/atomic"
+)
+
+// Stats are server wide counters reported by INFO.
+type Stats struct {
+	UsedMemory                 atomic.Int64 //approximate bytes used by all keys in all databases
+	EvictedKeys                atomic.Int64
+	ExpiredKeys                atomic.Int64
+	ExpiredTimeCapReachedCount atomic.Int64
+	expiredStalePerc           atomic.Uint64 //float64 bits
+}
+
+// ExpiredStalePerc estimates the percentage of keys with a TTL that are expired but
+// not yet reclaimed, based on what the active expiry cycle has been seeing.
+func (stats *Stats) ExpiredStalePerc() float64 {
+	return math.Float64frombits(stats.expiredStalePerc.Load())
+}
+
+// Reset zeroes the counters, as CONFIG RESETSTAT does. Memory usage isn't a counter, so
+// it's kept.
+func (stats *Stats) Reset() {
+	stats.EvictedKeys.Store(0)
+	stats.ExpiredKeys.Store(0)
+	stats.ExpiredTimeCapReachedCount.Store(0)
+	stats.expiredStalePerc.Store(0)
+}
+
+// updateStalePerc folds the result of a cycle into a moving average, like redis does.
+func (stats *Stats) updateStalePerc(sampled int, expired int) {
+	current := 0.0
+	if sampled > 0 {
+		current = float64(expired) / float64(sampled) * 100
+	}
+
+	perc := current*0.05 + stats.ExpiredStalePerc()*0.95
+	stats.expiredStalePerc.Store(math.Float64bits(perc))
+}
+
+// Info reports server stats in the same "# Section\r\nfield:value" format redis uses.
+//
+//	INFO [section]
+func (dbs *Databases) Info(args []resp.Value) resp.Value {
+	if len(args) > 1 {
+		errStr := "wrong number of arguments for 'info' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	section := "default"
+	if len(args) == 1 {
+		section = strings.ToLower(*args[0].Bulk)
+	}
+	all := section == "default" || section == "all" || section == "everything"
+
+	var sb strings.Builder
+
+	if all || section == "memory" {
+		sb.WriteString("# Memory\r\n")
+		fmt.Fprintf(&sb, "used_memory:%d\r\n", dbs.Stats.UsedMemory.Load())
+		cfg := dbs.Config()
+		fmt.Fprintf(&sb, "maxmemory:%d\r\n", cfg.MaxMemory)
+		fmt.Fprintf(&sb, "maxmemory_policy:%s\r\n", cfg.MaxMemoryPolicy)
+		sb.WriteString("\r\n")
+	}
+
+	if all || section == "stats" {
+		sb.WriteString("# Stats\r\n")
+		fmt.Fprintf(&sb, "evicted_keys:%d\r\n", dbs.Stats.EvictedKeys.Load())
+		fmt.Fprintf(&sb, "expired_keys:%d\r\n", dbs.Stats.ExpiredKeys.Load())
+		fmt.Fprintf(&sb, "expired_stale_perc:%.2f\r\n", dbs.Stats.ExpiredStalePerc())
+		fmt.Fprintf(&sb, "expired_time_cap_reached_count:%d\r\n", dbs.Stats.ExpiredTimeCapReachedCount.Load())
+		sb.WriteString("\r\n")
+	}
+
+	if all || section == "keyspace" {
+		sb.WriteString("# Keyspace\r\n")
+		for _, store := range dbs.Stores {
+			store.rLockAll()
+			keys := store.Pairs.Count + store.Hsets.Count + store.Lists.Count + store.Streams.Count + store.Geos.Count
+			expires := store.Expires.Count
+			store.rUnlockAll()
+
+			if keys > 0 { //like redis, empty dbs aren't listed
+				fmt.Fprintf(&sb, "db%d:keys=%d,expires=%d\r\n", store.Index, keys, expires)
+			}
+		}
+	}
+
+	res := sb.String()
+	return resp.Value{
+		Type:   "verbatim",
+		Bulk:   &res,
+		Format: "txt",
+	}
+}
@@ -4,80 +4,50 @@ import (
 	"reredis/pkg/resp"
 	"reredis/pkg/utils"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Store struct {
-	Pairs   *utils.HashMap //maybe implement my own hashMap?
-	Hsets   *utils.HashMap
-	Lists   *utils.HashMap
-	InMulti bool
-	MultiQ  []MultiQCmd
-	Mutex   sync.RWMutex
-	HMutex  sync.RWMutex
-	LMutex  sync.RWMutex
+	Pairs     *utils.HashMap //maybe implement my own hashMap?
+	Hsets     *utils.HashMap
+	Lists     *utils.HashMap
+	Streams   *utils.HashMap
+	Geos      *utils.HashMap
+	Expires   *utils.HashMap //key -> time.Time for every key with an expiry, sampled by the active expiry cycle
+	Meta      *utils.HashMap //key -> *KeyMeta for every key, for memory accounting and eviction
+	Index     int            //which logical database this is
+	Databases *Databases     //the other logical databases, for commands like MOVE
+	Stats     *Stats
+	Mutex     sync.RWMutex
+	HMutex    sync.RWMutex
+	LMutex    sync.RWMutex
+	XMutex    sync.RWMutex
+	GMutex    sync.RWMutex
+	EMutex    sync.RWMutex               //guards Expires and Meta, always taken last after any of the other mutexes
+	Waiters   map[string][]chan struct{} //clients blocked on a key, woken up when it's written to
+	WMutex    sync.Mutex
 }
 
-func NewStore() *Store {
+// NewStore creates an empty store whose keyspace maps start out with mapSize buckets.
+func NewStore(mapSize int) *Store {
 	return &Store{
-		Pairs:   utils.NewHashMap(4),
-		Hsets:   utils.NewHashMap(4),
+		Pairs:   utils.NewHashMap(mapSize),
+		Hsets:   utils.NewHashMap(mapSize),
 		Mutex:   sync.RWMutex{},
 		HMutex:  sync.RWMutex{},
-		Lists:   utils.NewHashMap(4),
+		Lists:   utils.NewHashMap(mapSize),
 		LMutex:  sync.RWMutex{},
-		InMulti: false,
-		MultiQ:  nil,
-	}
-}
-
-func (store *Store) Multi(args []resp.Value) resp.Value {
-	if len(args) > 0 {
-		errStr := "incorrect number of arguments passed for 'MULTI'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-
-	if store.InMulti {
-		errStr := "instance already in 'MULTI'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-	store.InMulti = true
-	if store.MultiQ == nil {
-		store.MultiQ = []MultiQCmd{}
-	}
-
-	ok := "OK"
-	return resp.Value{
-		Type:   "string",
-		String: &ok,
-	}
-}
-
-func (store *Store) QMultiCmd(fn func([]resp.Value) resp.Value, args []resp.Value) resp.Value {
-	if !store.InMulti {
-		errStr := "instance not in 'MULTI'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-
-	store.MultiQ = append(store.MultiQ, MultiQCmd{
-		Fn:   fn,
-		Args: args,
-	})
-
-	qd := "QUEUED"
-	return resp.Value{
-		Type:   "string",
-		String: &qd,
+		Streams: utils.NewHashMap(mapSize),
+		XMutex:  sync.RWMutex{},
+		Geos:    utils.NewHashMap(mapSize),
+		GMutex:  sync.RWMutex{},
+		Waiters: map[string][]chan struct{}{},
+		Expires: utils.NewHashMap(mapSize),
+		Meta:    utils.NewHashMap(mapSize),
+		EMutex:  sync.RWMutex{},
+		Stats:   &Stats{},
 	}
 }
 
@@ -92,99 +62,92 @@ func (store *Store) Ping(args []resp.Value) resp.Value {
 
 func (store *Store) Set(args []resp.Value) resp.Value {
 	if len(args) < 2 {
-		errStr := "key and/or value not given or incorrect number of arguments passed"
+		errStr := "wrong number of arguments for 'set' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
 		}
 	}
 
-	//check for NX
-	//nxFlag := false
+	key := *args[0].Bulk
+	nx := false
 	var expiresAt *time.Time
 
 	for i := 2; i < len(args); i++ {
-		switch *args[i].Bulk {
+		switch strings.ToUpper(*args[i].Bulk) {
 		case "NX":
-			{
-				_, ok := store.Pairs.Get(*args[0].Bulk)
-				//_, ok := store.Pairs[*args[0].Bulk]
-				if ok {
-					errStr := "key already exists."
-					store.Mutex.RUnlock()
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
+			nx = true
+		case "EX", "EXAT":
+			if expiresAt != nil || i+1 == len(args) {
+				errStr := "syntax error"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
 				}
 			}
-		case "EX":
-			{
-				if expiresAt != nil {
-					errStr := "syntax error"
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
+			valNum, err := strconv.ParseInt(*args[i+1].Bulk, 10, 64)
+			if err != nil || valNum <= 0 {
+				errStr := "invalid expire time in 'set' command"
+				return resp.Value{
+					Type:   "error",
+					String: &errStr,
 				}
-				i++
-				val := args[i].Bulk
-				if val == nil {
-					errStr := "syntax error"
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
-				}
-				valNum, err := strconv.Atoi(*val)
-				if err != nil {
-					errStr := "syntax error: invalid expiration time"
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
-				}
-				timeObj := time.Now().Add(time.Second * time.Duration(valNum))
-				expiresAt = &timeObj
 			}
-		case "EXAT":
-			{
-				if expiresAt != nil {
-					errStr := "syntax error"
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
-				}
-				i++
-				val := args[i].Number
-				if val == nil {
-					errStr := "syntax error"
-					return resp.Value{
-						Type:   "error",
-						String: &errStr,
-					}
-				}
-				timeObj := time.Unix(*val, 0)
-				expiresAt = &timeObj
+			timeObj := time.Now().Add(time.Second * time.Duration(valNum))
+			if strings.EqualFold(*args[i].Bulk, "EXAT") {
+				timeObj = time.Unix(valNum, 0)
+			}
+			expiresAt = &timeObj
+			i++
+		default:
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
 			}
 		}
 	}
 
 	//check for expiry and set that
-	store.Mutex.Lock()
+	explicitExpiry := expiresAt != nil
 	if expiresAt == nil {
-		store.Pairs.Set(*args[0].Bulk, ValueStringObj{
-			Value:     *args[1].Bulk,
-			ExpiresAt: time.Now().Add(time.Hour * 1),
-		})
+		timeObj := store.defaultExpiry(time.Now())
+		expiresAt = &timeObj
+	}
+
+	valueObj := ValueStringObj{
+		Value:     *args[1].Bulk,
+		ExpiresAt: *expiresAt,
+	}
+
+	//SET overwrites whatever type the key held, and NX looks at every type, so unless the
+	//key already is a live string, which no other type can take while we hold its lock
+	//(see lockForWrite), every keyspace needs to be locked
+	store.Mutex.Lock()
+	current, isString := store.Pairs.Get(key)
+	if !nx && isString && !isExpired(current, time.Now()) {
+		store.Pairs.Set(key, valueObj)
+		store.track(key, valueObj)
+		store.Mutex.Unlock()
 	} else {
-		store.Pairs.Set(*args[0].Bulk, ValueStringObj{
-			Value:     *args[1].Bulk,
-			ExpiresAt: *expiresAt,
-		})
+		store.Mutex.Unlock()
+		store.lockAll()
+		if nx && store.existsLocked(key, time.Now()) {
+			store.unlockAll()
+			return resp.Value{
+				Type: "null",
+			}
+		}
+		store.deleteLocked(key)
+		store.Pairs.Set(key, valueObj)
+		store.trackLocked(key, valueObj)
+		store.unlockAll()
+	}
+
+	store.notify(NOTIFY_STRING, "set", key)
+	if explicitExpiry {
+		store.notify(NOTIFY_GENERIC, "expire", key)
 	}
-	store.Mutex.Unlock()
 
 	ok := "OK"
 	return resp.Value{
@@ -195,7 +158,7 @@ func (store *Store) Set(args []resp.Value) resp.Value {
 
 func (store *Store) Get(args []resp.Value) resp.Value {
 	if len(args) != 1 {
-		errStr := "key not given or incorrect number of arguments passed"
+		errStr := "wrong number of arguments for 'get' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -207,10 +170,11 @@ func (store *Store) Get(args []resp.Value) resp.Value {
 	store.Mutex.RUnlock()
 
 	if !ok {
-		errStr := "key does not exist or has expired"
+		if store.heldElsewhere(*args[0].Bulk, store.Pairs) {
+			return wrongTypeValue()
+		}
 		return resp.Value{
-			Type:   "error",
-			String: &errStr,
+			Type: "null",
 		}
 	}
 
@@ -223,58 +187,58 @@ func (store *Store) Get(args []resp.Value) resp.Value {
 		}
 	}
 
-	if time.Now().After(valueObj.ExpiresAt) { //if its expired, get rid of it
-		errStr := "key does not exist or has expired"
-
+	if isExpired(valueObj, time.Now()) { //if its expired, get rid of it
 		store.Mutex.Lock()
-		store.Pairs.Delete(*args[0].Bulk)
+		store.expireLazily(store.Pairs, *args[0].Bulk)
 		//delete(store.Pairs, *args[0].Bulk)
 		store.Mutex.Unlock()
 
 		return resp.Value{
-			Type:   "error",
-			String: &errStr,
+			Type: "null",
 		}
 	}
 
+	store.touch(*args[0].Bulk)
+
 	return resp.Value{
 		Type: "bulk",
 		Bulk: &valueObj.Value,
 	}
 }
 
+// Del deletes keys of any type, returning how many of them existed.
 func (store *Store) Del(args []resp.Value) resp.Value {
 	if len(args) < 1 {
-		errStr := "key not given or incorrect number of arguments passed"
+		errStr := "wrong number of arguments for 'del' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
 		}
 	}
 
-	deleted := 0
+	deleted := int64(0)
+	now := time.Now()
 
-	store.Mutex.Lock()
+	store.lockAll()
 	for _, key := range args {
-		_, ok := store.Pairs.Get(*key.Bulk)
-		if ok {
-			store.Pairs.Delete(*key.Bulk)
-			//delete(store.Pairs, *key.Bulk)
+		if store.existsLocked(*key.Bulk, now) {
+			store.deleteLocked(*key.Bulk)
 			deleted++
+			store.notify(NOTIFY_GENERIC, "del", *key.Bulk)
 		}
 	}
-	store.Mutex.Unlock()
+	store.unlockAll()
 
-	bulk := strconv.Itoa(deleted)
 	return resp.Value{
-		Type: "bulk",
-		Bulk: &bulk,
+		Type:   "integer",
+		Number: &deleted,
 	}
 }
 
+// HSet sets fields of a hash, creating it if needed, and returns how many fields were added.
 func (store *Store) HSet(args []resp.Value) resp.Value {
-	if len(args) != 3 {
-		errStr := "wrong number of arguments for 'HSET'"
+	if len(args) < 3 || len(args)%2 == 0 {
+		errStr := "wrong number of arguments for 'hset' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -282,47 +246,57 @@ func (store *Store) HSet(args []resp.Value) resp.Value {
 	}
 
 	hkey := *args[0].Bulk
-	key := *args[1].Bulk
-	value := *args[2].Bulk
-
-	store.HMutex.Lock()
+	unlock, ok := store.lockForWrite(hkey, store.Hsets, &store.HMutex)
+	if !ok {
+		return wrongTypeValue()
+	}
 
 	var hsetObj *HSet
 	var hset any
-	var ok bool
 
+	store.expireLazily(store.Hsets, hkey)
 	hset, ok = store.Hsets.Get(hkey)
 	if !ok {
+		expiresAt := store.defaultExpiry(time.Now())
 		hset = &HSet{
 			Hset:      utils.NewHashMap(4),
-			ExpiresAt: time.Now().Add(1 * time.Hour),
+			ExpiresAt: expiresAt,
 		}
 		store.Hsets.Set(hkey, hset)
 	}
 
 	hsetObj = hset.(*HSet)
 
-	hsetObj.Hset.Set(key, ValueStringObj{
-		Value:     value,
-		ExpiresAt: time.Now(),
-	})
-	// store.Hsets[hkey].Hset[key] = ValueStringObj{
-	// 	Value:     value,
-	// 	ExpiresAt: time.Now(),
-	// }
+	added := int64(0)
+	for i := 1; i < len(args); i += 2 {
+		key := *args[i].Bulk
+		value := *args[i+1].Bulk
+
+		if old, ok := hsetObj.Hset.Get(key); ok {
+			hsetObj.Bytes -= len(key) + len(old.(ValueStringObj).Value) + HASH_ENTRY_OVERHEAD
+		} else {
+			added++
+		}
+		hsetObj.Hset.Set(key, ValueStringObj{
+			Value:     value,
+			ExpiresAt: time.Now(),
+		})
+		hsetObj.Bytes += len(key) + len(value) + HASH_ENTRY_OVERHEAD
+	}
+	store.track(hkey, hsetObj)
+	store.notify(NOTIFY_HASH, "hset", hkey)
 
-	store.HMutex.Unlock()
+	unlock()
 
-	str := "OK"
 	return resp.Value{
-		Type:   "string",
-		String: &str,
+		Type:   "integer",
+		Number: &added,
 	}
 }
 
 func (store *Store) HGet(args []resp.Value) resp.Value {
 	if len(args) != 2 {
-		errStr := "wrong number of arguments for 'hget'"
+		errStr := "wrong number of arguments for 'hget' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -336,6 +310,9 @@ func (store *Store) HGet(args []resp.Value) resp.Value {
 	hset, ok := store.Hsets.Get(hkey)
 	if !ok {
 		store.HMutex.RUnlock()
+		if store.heldElsewhere(hkey, store.Hsets) {
+			return wrongTypeValue()
+		}
 		return resp.Value{
 			Type: "null",
 		}
@@ -351,46 +328,38 @@ func (store *Store) HGet(args []resp.Value) resp.Value {
 		}
 	}
 
-	value, ok := hsetObj.Hset.Get(key)
-	if !ok {
+	if isExpired(hsetObj, time.Now()) {
 		store.HMutex.RUnlock()
+
+		store.HMutex.Lock()
+		store.expireLazily(store.Hsets, hkey)
+		//delete(store.Hsets, hkey)
+		store.HMutex.Unlock()
+
 		return resp.Value{
 			Type: "null",
 		}
 	}
 
-	valueObj, ok := value.(ValueStringObj)
+	value, ok := hsetObj.Hset.Get(key)
+	store.HMutex.RUnlock()
 	if !ok {
-		store.HMutex.RUnlock()
-		errStr := "INTERNAL ERROR"
 		return resp.Value{
-			Type:   "error",
-			String: &errStr,
+			Type: "null",
 		}
 	}
-	//value, ok := store.Hsets[hkey].Hset[key].(ValueStringObj)
-	store.HMutex.RUnlock()
-
-	// if !ok {
-	// 	return resp.Value{
-	// 		Type: "null",
-	// 	}
-	// }
-
-	if time.Now().After(hsetObj.ExpiresAt) {
-		errStr := "hset does not exist or has expired"
-
-		store.HMutex.Lock()
-		store.Hsets.Delete(hkey)
-		//delete(store.Hsets, hkey)
-		store.HMutex.Unlock()
 
+	valueObj, ok := value.(ValueStringObj)
+	if !ok {
+		errStr := "INTERNAL ERROR"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
 		}
 	}
 
+	store.touch(hkey)
+
 	return resp.Value{
 		Type: "bulk",
 		Bulk: &valueObj.Value,
@@ -399,7 +368,7 @@ func (store *Store) HGet(args []resp.Value) resp.Value {
 
 func (store *Store) HGetAll(args []resp.Value) resp.Value {
 	if len(args) != 1 {
-		errStr := "wrong number of arguments for 'hgetall'"
+		errStr := "wrong number of arguments for 'hgetall' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -407,15 +376,20 @@ func (store *Store) HGetAll(args []resp.Value) resp.Value {
 	}
 
 	hkey := *args[0].Bulk
+	res := []resp.Value{}
 
 	store.HMutex.RLock()
 	hset, ok := store.Hsets.Get(hkey)
 	//set, ok := store.Hsets[hkey]
-	store.HMutex.RUnlock()
 
-	if !ok {
+	if !ok || isExpired(hset, time.Now()) {
+		store.HMutex.RUnlock()
+		if !ok && store.heldElsewhere(hkey, store.Hsets) {
+			return wrongTypeValue()
+		}
 		return resp.Value{
-			Type: "null",
+			Type:  "map",
+			Array: res,
 		}
 	}
 
@@ -429,8 +403,6 @@ func (store *Store) HGetAll(args []resp.Value) resp.Value {
 		}
 	}
 
-	res := []resp.Value{}
-
 	for _, value := range hsetObj.Hset.Buckets {
 		valObj, ok := value.Value.(ValueStringObj)
 		if !ok {
@@ -445,70 +417,29 @@ func (store *Store) HGetAll(args []resp.Value) resp.Value {
 			Bulk: &valObj.Value,
 		})
 	}
+	store.HMutex.RUnlock()
+
+	store.touch(hkey)
 
 	return resp.Value{
-		Type:  "array",
+		Type:  "map",
 		Array: res,
 	}
 }
 
 func (store *Store) LPush(args []resp.Value) resp.Value {
-	if len(args) < 2 {
-		errStr := "wrong number of arguments for 'LPUSH'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-
-	key := *args[0].Bulk
-
-	store.LMutex.RLock()
-	dq, ok := store.Lists.Get(key)
-	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
-
-	var dqObj *Deque
-	//if list doesnt exist
-	if !ok {
-		dqObj = NewDeque(4)
-	} else {
-		dqObj, ok = dq.(*Deque)
-		if !ok {
-			errStr := "INTERNAL ERROR"
-			return resp.Value{
-				Type:   "error",
-				String: &errStr,
-			}
-		}
-	}
-
-	store.LMutex.Lock()
-	for i := 1; i < len(args); i++ {
-		val := *args[i].Bulk
-		if dqObj.Size == len(dqObj.Buffer) {
-			dqObj.Grow()
-		}
-		dqObj.Head = dqObj.Wrap(dqObj.Head - 1)
-		dqObj.Buffer[dqObj.Head] = val
-		dqObj.Size++
-	}
-
-	store.Lists.Set(key, dqObj)
-	//store.Lists[key] = dq
-	store.LMutex.Unlock()
-
-	resNum := strconv.Itoa(dqObj.Size)
-
-	return resp.Value{
-		Type: "bulk",
-		Bulk: &resNum,
-	}
+	return store.push(args, "lpush")
 }
 
 func (store *Store) RPush(args []resp.Value) resp.Value {
+	return store.push(args, "rpush")
+}
+
+// push adds elements to the head (LPUSH) or tail (RPUSH) of a list, creating it if
+// needed, and returns the list's new length.
+func (store *Store) push(args []resp.Value, cmd string) resp.Value {
 	if len(args) < 2 {
-		errStr := "wrong number of arguments for 'RPUSH'"
+		errStr := "wrong number of arguments for '" + cmd + "' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -516,11 +447,13 @@ func (store *Store) RPush(args []resp.Value) resp.Value {
 	}
 
 	key := *args[0].Bulk
+	unlock, ok := store.lockForWrite(key, store.Lists, &store.LMutex)
+	if !ok {
+		return wrongTypeValue()
+	}
 
-	store.LMutex.RLock()
 	dq, ok := store.Lists.Get(key)
 	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
 
 	var dqObj *Deque
 	//if list doesnt exist
@@ -529,6 +462,7 @@ func (store *Store) RPush(args []resp.Value) resp.Value {
 	} else {
 		dqObj, ok = dq.(*Deque)
 		if !ok {
+			unlock()
 			errStr := "INTERNAL ERROR"
 			return resp.Value{
 				Type:   "error",
@@ -537,33 +471,48 @@ func (store *Store) RPush(args []resp.Value) resp.Value {
 		}
 	}
 
-	store.LMutex.Lock()
-
 	for i := 1; i < len(args); i++ {
 		val := *args[i].Bulk
 		if dqObj.Size == len(dqObj.Buffer) {
 			dqObj.Grow()
 		}
-		dqObj.Buffer[dqObj.Tail] = val
-		dqObj.Tail = dqObj.Wrap(dqObj.Tail + 1)
+		if cmd == "lpush" {
+			dqObj.Head = dqObj.Wrap(dqObj.Head - 1)
+			dqObj.Buffer[dqObj.Head] = val
+		} else {
+			dqObj.Buffer[dqObj.Tail] = val
+			dqObj.Tail = dqObj.Wrap(dqObj.Tail + 1)
+		}
 		dqObj.Size++
+		dqObj.Bytes += len(val) + LIST_ENTRY_OVERHEAD
 	}
 
 	store.Lists.Set(key, dqObj)
+	store.track(key, dqObj)
+	store.notify(NOTIFY_LIST, cmd, key)
 	//store.Lists[key] = dq
-	store.LMutex.Unlock()
-
-	resNum := strconv.Itoa(dqObj.Size)
+	size := int64(dqObj.Size)
+	unlock()
 
 	return resp.Value{
-		Type: "bulk",
-		Bulk: &resNum,
+		Type:   "integer",
+		Number: &size,
 	}
 }
 
 func (store *Store) LPop(args []resp.Value) resp.Value {
+	return store.pop(args, "lpop")
+}
+
+func (store *Store) RPop(args []resp.Value) resp.Value {
+	return store.pop(args, "rpop")
+}
+
+// pop removes and returns the head (LPOP) or tail (RPOP) of a list. Like redis, a list
+// that runs out of elements is deleted.
+func (store *Store) pop(args []resp.Value, cmd string) resp.Value {
 	if len(args) != 1 {
-		errStr := "wrong number of arguments for 'LPop'"
+		errStr := "wrong number of arguments for '" + cmd + "' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -572,12 +521,15 @@ func (store *Store) LPop(args []resp.Value) resp.Value {
 
 	key := *args[0].Bulk
 
-	store.LMutex.RLock()
+	store.LMutex.Lock()
 	dq, ok := store.Lists.Get(key)
 	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
 
 	if !ok {
+		store.LMutex.Unlock()
+		if store.heldElsewhere(key, store.Lists) {
+			return wrongTypeValue()
+		}
 		return resp.Value{
 			Type: "null",
 		}
@@ -585,6 +537,7 @@ func (store *Store) LPop(args []resp.Value) resp.Value {
 
 	dqObj, ok := dq.(*Deque)
 	if !ok {
+		store.LMutex.Unlock()
 		errStr := "INTERNAL ERROR"
 		return resp.Value{
 			Type:   "error",
@@ -592,53 +545,31 @@ func (store *Store) LPop(args []resp.Value) resp.Value {
 		}
 	}
 
-	store.LMutex.Lock()
-	val := dqObj.Buffer[dqObj.Head]
-	dqObj.Head = dqObj.Wrap(dqObj.Head + 1)
-	dqObj.Size--
-	store.LMutex.Unlock()
-
-	return resp.Value{
-		Type: "bulk",
-		Bulk: &val,
-	}
-}
-
-func (store *Store) RPop(args []resp.Value) resp.Value {
-	if len(args) != 1 {
-		errStr := "wrong number of arguments for 'RPop'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-
-	key := *args[0].Bulk
-
-	store.LMutex.RLock()
-	dq, ok := store.Lists.Get(key)
-	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
-
-	if !ok {
+	if dqObj.Size == 0 {
+		store.LMutex.Unlock()
 		return resp.Value{
 			Type: "null",
 		}
 	}
 
-	dqObj, ok := dq.(*Deque)
-	if !ok {
-		errStr := "INTERNAL ERROR"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
+	var val string
+	if cmd == "lpop" {
+		val = dqObj.Buffer[dqObj.Head]
+		dqObj.Head = dqObj.Wrap(dqObj.Head + 1)
+	} else {
+		dqObj.Tail = dqObj.Wrap(dqObj.Tail - 1)
+		val = dqObj.Buffer[dqObj.Tail]
 	}
-
-	store.LMutex.Lock()
-	dqObj.Tail = dqObj.Wrap(dqObj.Tail - 1)
-	val := dqObj.Buffer[dqObj.Tail]
 	dqObj.Size--
+	dqObj.Bytes -= len(val) + LIST_ENTRY_OVERHEAD
+	store.notify(NOTIFY_LIST, cmd, key)
+	if dqObj.Size == 0 {
+		store.Lists.Delete(key)
+		store.forget(key)
+		store.notify(NOTIFY_GENERIC, "del", key)
+	} else {
+		store.track(key, dqObj)
+	}
 	store.LMutex.Unlock()
 
 	return resp.Value{
@@ -649,7 +580,7 @@ func (store *Store) RPop(args []resp.Value) resp.Value {
 
 func (store *Store) LLen(args []resp.Value) resp.Value {
 	if len(args) != 1 {
-		errStr := "wrong number of arguments for 'LLen'"
+		errStr := "wrong number of arguments for 'llen' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -660,18 +591,22 @@ func (store *Store) LLen(args []resp.Value) resp.Value {
 	store.LMutex.RLock()
 	dq, ok := store.Lists.Get(key)
 	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
 
 	if !ok {
-		res := "0"
+		store.LMutex.RUnlock()
+		if store.heldElsewhere(key, store.Lists) {
+			return wrongTypeValue()
+		}
+		res := int64(0)
 		return resp.Value{
-			Type: "bulk",
-			Bulk: &res,
+			Type:   "integer",
+			Number: &res,
 		}
 	}
 
 	dqObj, ok := dq.(*Deque)
 	if !ok {
+		store.LMutex.RUnlock()
 		errStr := "INTERNAL ERROR"
 		return resp.Value{
 			Type:   "error",
@@ -679,17 +614,21 @@ func (store *Store) LLen(args []resp.Value) resp.Value {
 		}
 	}
 
-	res := strconv.Itoa(dqObj.Size)
+	res := int64(dqObj.Size)
+	store.LMutex.RUnlock()
+	store.touch(key)
 
 	return resp.Value{
-		Type: "bulk",
-		Bulk: &res,
+		Type:   "integer",
+		Number: &res,
 	}
 }
 
+// LRange returns the elements between start and stop inclusive, where negative indexes
+// count back from the end of the list.
 func (store *Store) LRange(args []resp.Value) resp.Value {
 	if len(args) != 3 {
-		errStr := "wrong number of arguments for 'LRange'"
+		errStr := "wrong number of arguments for 'lrange' command"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -700,29 +639,9 @@ func (store *Store) LRange(args []resp.Value) resp.Value {
 	lIndexStr := *args[1].Bulk
 	rIndexStr := *args[2].Bulk
 
-	store.LMutex.RLock()
-	dq, ok := store.Lists.Get(key)
-	//dq, ok := store.Lists[key]
-	store.LMutex.RUnlock()
-
-	if !ok {
-		return resp.Value{
-			Type: "null",
-		}
-	}
-
-	dqObj, ok := dq.(*Deque)
-	if !ok {
-		errStr := "INTERNAL ERROR"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
-
 	lIndex, err := strconv.Atoi(lIndexStr)
 	if err != nil {
-		errStr := "range not a number for 'LRange'"
+		errStr := "value is not an integer or out of range"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
@@ -730,98 +649,66 @@ func (store *Store) LRange(args []resp.Value) resp.Value {
 	}
 	rIndex, err := strconv.Atoi(rIndexStr)
 	if err != nil {
-		errStr := "range not a number for 'LRange'"
+		errStr := "value is not an integer or out of range"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
 		}
 	}
 
-	lOffset := dqObj.Head + lIndex
-	if lOffset < dqObj.Head {
-		lOffset = dqObj.Head
-	}
-
-	rnge := (rIndex - lIndex) + 1
-	var rOffset int
-	if rnge > dqObj.Size {
-		rOffset = dqObj.Tail
-	} else {
-		rOffset = dqObj.Head + rnge
-	}
-
 	res := []resp.Value{}
 
-	for lOffset != rOffset {
-		res = append(res, resp.Value{
-			Type: "bulk",
-			Bulk: &dqObj.Buffer[lOffset],
-		})
-
-		lOffset = dqObj.Wrap(lOffset + 1)
-	}
-	// for i := lOffset; i < rOffset; i++ {
-	// 	res = append(res, resp.Value{
-	// 		Type: "bulk",
-	// 		Bulk: &dq.Buffer[i],
-	// 	})
-	// }
-
-	return resp.Value{
-		Type:  "array",
-		Array: res,
-	}
-
-}
+	store.LMutex.RLock()
+	dq, ok := store.Lists.Get(key)
+	//dq, ok := store.Lists[key]
 
-func (store *Store) Exec(args []resp.Value) resp.Value {
-	if len(args) > 0 {
-		errStr := "wrong number of arguments for 'EXEC'"
+	if !ok {
+		store.LMutex.RUnlock()
+		if store.heldElsewhere(key, store.Lists) {
+			return wrongTypeValue()
+		}
 		return resp.Value{
-			Type:   "error",
-			String: &errStr,
+			Type:  "array",
+			Array: res,
 		}
 	}
 
-	if !store.InMulti {
-		errStr := "instance not in 'MULTI'"
+	dqObj, ok := dq.(*Deque)
+	if !ok {
+		store.LMutex.RUnlock()
+		errStr := "INTERNAL ERROR"
 		return resp.Value{
 			Type:   "error",
 			String: &errStr,
 		}
 	}
 
-	res := []resp.Value{}
-
-	for _, val := range store.MultiQ {
-		resp := val.Fn(val.Args)
-		res = append(res, resp)
+	if lIndex < 0 {
+		lIndex += dqObj.Size
+	}
+	if rIndex < 0 {
+		rIndex += dqObj.Size
+	}
+	if lIndex < 0 {
+		lIndex = 0
+	}
+	if rIndex >= dqObj.Size {
+		rIndex = dqObj.Size - 1
 	}
 
-	store.InMulti = false
-	store.MultiQ = nil
+	for i := lIndex; i <= rIndex; i++ {
+		val := dqObj.Buffer[dqObj.Wrap(dqObj.Head+i)] //copied, the buffer can change once we unlock
+		res = append(res, resp.Value{
+			Type: "bulk",
+			Bulk: &val,
+		})
+	}
+	store.LMutex.RUnlock()
+	store.touch(key)
 
 	return resp.Value{
 		Type:  "array",
 		Array: res,
 	}
-}
-
-func (store *Store) Discard(args []resp.Value) resp.Value {
-	if len(args) > 0 {
-		errStr := "wrong number of arguments for 'DISCARD'"
-		return resp.Value{
-			Type:   "error",
-			String: &errStr,
-		}
-	}
 
-	store.InMulti = false
-	store.MultiQ = nil
-
-	ok := "OK"
-	return resp.Value{
-		Type:   "string",
-		String: &ok,
-	}
 }
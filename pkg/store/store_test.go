@@ -0,0 +1,153 @@
+package store
+
+import (
+	"reredis/pkg/resp"
+	"strings"
+	"testing"
+)
+
+func newTestDatabases() *Databases {
+	cfg := DefaultConfig()
+	return NewDatabases(&cfg)
+}
+
+func bulkArgs(args ...string) []resp.Value {
+	values := make([]resp.Value, len(args))
+	for i := range args {
+		values[i] = resp.Value{Type: "bulk", Bulk: &args[i]}
+	}
+	return values
+}
+
+// run runs a command line against store, the way the handler would.
+func run(store *Store, line string) resp.Value {
+	fields := strings.Fields(line)
+	args := bulkArgs(fields[1:]...)
+	switch strings.ToUpper(fields[0]) {
+	case "SET":
+		return store.Set(args)
+	case "GET":
+		return store.Get(args)
+	case "DEL":
+		return store.Del(args)
+	case "HSET":
+		return store.HSet(args)
+	case "HGET":
+		return store.HGet(args)
+	case "HGETALL":
+		return store.HGetAll(args)
+	case "LPUSH":
+		return store.LPush(args)
+	case "RPUSH":
+		return store.RPush(args)
+	case "LPOP":
+		return store.LPop(args)
+	case "RPOP":
+		return store.RPop(args)
+	case "LLEN":
+		return store.LLen(args)
+	case "LRANGE":
+		return store.LRange(args)
+	case "XADD":
+		return store.XAdd(args)
+	case "XLEN":
+		return store.XLen(args)
+	case "XRANGE":
+		return store.XRange(args)
+	case "XREVRANGE":
+		return store.XRevRange(args)
+	case "XDEL":
+		return store.XDel(args)
+	case "XTRIM":
+		return store.XTrim(args)
+	case "XREAD":
+		return store.XRead(args, nil)
+	case "XGROUP":
+		return store.XGroup(args)
+	case "XREADGROUP":
+		return store.XReadGroup(args, nil)
+	case "XACK":
+		return store.XAck(args)
+	case "XPENDING":
+		return store.XPending(args)
+	case "XCLAIM":
+		return store.XClaim(args)
+	case "XAUTOCLAIM":
+		return store.XAutoClaim(args)
+	case "XINFO":
+		return store.XInfo(args)
+	case "GEOADD":
+		return store.GeoAdd(args)
+	case "GEOPOS":
+		return store.GeoPos(args)
+	case "GEOHASH":
+		return store.GeoHash(args)
+	case "GEODIST":
+		return store.GeoDist(args)
+	case "GEOSEARCH":
+		return store.GeoSearch(args)
+	case "GEOSEARCHSTORE":
+		return store.GeoSearchStore(args)
+	case "DBSIZE":
+		return store.DBSize(args)
+	}
+	panic("unknown command " + fields[0])
+}
+
+func TestWrongType(t *testing.T) {
+	creators := map[string]string{
+		"string": "SET k v",
+		"hash":   "HSET k f v",
+		"list":   "RPUSH k a",
+		"stream": "XADD k * f v",
+		"geo":    "GEOADD k 13.36 38.11 p",
+	}
+	commands := map[string][]string{
+		"string": {"GET k"},
+		"hash":   {"HSET k f v", "HGET k f", "HGETALL k"},
+		"list":   {"LPUSH k a", "RPUSH k a", "LPOP k", "RPOP k", "LLEN k", "LRANGE k 0 -1"},
+		"stream": {
+			"XADD k * f v", "XLEN k", "XRANGE k - +", "XREVRANGE k + -", "XDEL k 1-1",
+			"XTRIM k MAXLEN 0", "XREAD STREAMS k 0", "XGROUP CREATE k g $ MKSTREAM",
+			"XGROUP SETID k g 0", "XREADGROUP GROUP g c STREAMS k >", "XACK k g 1-1",
+			"XPENDING k g", "XCLAIM k g c 0 1-1", "XAUTOCLAIM k g c 0 0", "XINFO STREAM k",
+		},
+		"geo": {
+			"GEOADD k 13.36 38.11 p", "GEOPOS k p", "GEOHASH k p", "GEODIST k p q",
+			"GEOSEARCH k FROMLONLAT 0 0 BYRADIUS 1 km", "GEOSEARCHSTORE d k FROMLONLAT 0 0 BYRADIUS 1 km",
+		},
+	}
+
+	for held, create := range creators {
+		for typ, lines := range commands {
+			if typ == held {
+				continue
+			}
+			for _, line := range lines {
+				store := newTestDatabases().Stores[0]
+				run(store, create)
+				res := run(store, line)
+				if res.Type != "error" || *res.String != WRONGTYPE_ERR {
+					t.Errorf("%s on a %s: got %s %v, want WRONGTYPE", line, held, res.Type, res.String)
+				}
+				if size := run(store, "DBSIZE"); *size.Number != 1 {
+					t.Errorf("%s on a %s: DBSIZE is %d, want 1", line, held, *size.Number)
+				}
+			}
+		}
+	}
+}
+
+func TestSetOverwritesAnyType(t *testing.T) {
+	for _, create := range []string{"HSET k f v", "RPUSH k a", "XADD k * f v", "GEOADD k 13.36 38.11 p"} {
+		store := newTestDatabases().Stores[0]
+		run(store, create)
+		run(store, "SET k v")
+		if res := run(store, "GET k"); res.Type != "bulk" || *res.Bulk != "v" {
+			t.Errorf("GET after %s and SET: got %s, want v", create, res.Type)
+		}
+		if size := run(store, "DBSIZE"); *size.Number != 1 {
+			t.Errorf("after %s and SET: DBSIZE is %d, want 1", create, *size.Number)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Streams keep their entries in nodes of up to STREAM_NODE_MAX_ENTRIES entries, ordered by
+// ID. Nodes are looked up with a binary search on their first ID, which works out to a
+// two level B+tree: since new IDs always go at the end, the node index only ever grows at
+// the tail and shrinks at the head (trimming), so it never needs rebalancing.
+//
+// Inside a node entries are packed into a single byte slice, like redis' listpacks. IDs
+// are stored as deltas from the node's master ID, and entries with the same field names
+// as the node's first entry only store their values:
+//
+//	<flags byte> <ms delta uvarint> <seq delta varint> <count uvarint> [fields] values
+const (
+	STREAM_NODE_MAX_ENTRIES = 100
+	STREAM_NODE_MAX_BYTES   = 4096
+	STREAM_NODE_OVERHEAD    = 64
+
+	streamFlagDeleted    = 1 << 0
+	streamFlagSameFields = 1 << 1
+)
+
+var (
+	ErrInvalidStreamID = errors.New("Invalid stream ID specified as stream command argument")
+)
+
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// Next returns the smallest ID greater than id, or false if id is already the largest one.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1, Seq: 0}, true
+	default:
+		return id, false
+	}
+}
+
+// Prev returns the largest ID smaller than id, or false if id is 0-0.
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+var (
+	MinStreamID = StreamID{Ms: 0, Seq: 0}
+	MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// ParseStreamID parses "ms-seq", or just "ms" in which case the sequence is missingSeq.
+func ParseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msStr, seqStr, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string //field, value, field, value...
+}
+
+type streamNode struct {
+	Master StreamID //ID of the first entry, the others are stored as deltas from it
+	Last   StreamID //ID of the last entry, deleted or not
+	Fields []string //field names of the first entry
+	Data   []byte
+	Count  int //live entries
+	Total  int //entries including deleted ones
+}
+
+type Stream struct {
+	Nodes        []*streamNode
+	Length       int
+	LastID       StreamID //greatest ID ever added, even if it was deleted since
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	Bytes        int //approximate memory used by the nodes and groups, for maxmemory accounting
+	Groups       map[string]*ConsumerGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{
+		Nodes: []*streamNode{},
+	}
+}
+
+// Append adds an entry at the end of the stream. id must be greater than LastID.
+func (s *Stream) Append(id StreamID, fields []string) {
+	var node *streamNode
+	if len(s.Nodes) > 0 {
+		node = s.Nodes[len(s.Nodes)-1]
+	}
+
+	if node == nil || node.Total >= STREAM_NODE_MAX_ENTRIES || len(node.Data) >= STREAM_NODE_MAX_BYTES {
+		node = &streamNode{
+			Master: id,
+			Fields: fieldNames(fields),
+		}
+		s.Nodes = append(s.Nodes, node)
+		s.Bytes += STREAM_NODE_OVERHEAD
+	}
+
+	before := len(node.Data)
+	node.append(id, fields)
+	s.Bytes += len(node.Data) - before
+
+	s.Length++
+	s.LastID = id
+	s.EntriesAdded++
+}
+
+// FirstID returns the ID of the first live entry.
+func (s *Stream) FirstID() (StreamID, bool) {
+	entries := s.Range(MinStreamID, MaxStreamID, 1, false)
+	if len(entries) == 0 {
+		return StreamID{}, false
+	}
+	return entries[0].ID, true
+}
+
+// Range returns up to count (0 for no limit) entries with start <= ID <= end, in
+// descending order if rev is set.
+func (s *Stream) Range(start StreamID, end StreamID, count int, rev bool) []StreamEntry {
+	res := []StreamEntry{}
+	if end.Less(start) {
+		return res
+	}
+
+	//first node that could hold start: the last one whose master is <= start
+	first := sort.Search(len(s.Nodes), func(i int) bool {
+		return start.Less(s.Nodes[i].Master)
+	}) - 1
+	first = max(first, 0)
+
+	last := sort.Search(len(s.Nodes), func(i int) bool {
+		return end.Less(s.Nodes[i].Master)
+	}) - 1
+
+	if !rev {
+		for i := first; i <= last; i++ {
+			done := false
+			s.Nodes[i].each(func(off int, id StreamID, fields []string, deleted bool) bool {
+				if deleted || id.Less(start) {
+					return true
+				}
+				if end.Less(id) {
+					done = true
+					return false
+				}
+				res = append(res, StreamEntry{ID: id, Fields: fields})
+				done = count > 0 && len(res) >= count
+				return !done
+			})
+			if done {
+				break
+			}
+		}
+		return res
+	}
+
+	for i := last; i >= first; i-- {
+		entries := []StreamEntry{}
+		s.Nodes[i].each(func(off int, id StreamID, fields []string, deleted bool) bool {
+			if deleted || id.Less(start) {
+				return true
+			}
+			if end.Less(id) {
+				return false
+			}
+			entries = append(entries, StreamEntry{ID: id, Fields: fields})
+			return true
+		})
+
+		for j := len(entries) - 1; j >= 0; j-- {
+			res = append(res, entries[j])
+			if count > 0 && len(res) >= count {
+				return res
+			}
+		}
+	}
+
+	return res
+}
+
+// Delete marks the entry with the given ID as deleted. Returns false if there's no such entry.
+func (s *Stream) Delete(id StreamID) bool {
+	idx := sort.Search(len(s.Nodes), func(i int) bool {
+		return id.Less(s.Nodes[i].Master)
+	}) - 1
+	if idx < 0 {
+		return false
+	}
+
+	node := s.Nodes[idx]
+	found := false
+	node.each(func(off int, entryID StreamID, fields []string, deleted bool) bool {
+		if entryID == id {
+			if !deleted {
+				node.Data[off] |= streamFlagDeleted
+				found = true
+			}
+			return false
+		}
+		return entryID.Less(id)
+	})
+
+	if !found {
+		return false
+	}
+
+	node.Count--
+	s.Length--
+	if s.MaxDeletedID.Less(id) {
+		s.MaxDeletedID = id
+	}
+	if node.Count == 0 {
+		s.removeNode(idx)
+	}
+
+	return true
+}
+
+// TrimMaxLen removes the oldest entries until at most maxLen are left. When approx is set
+// only whole nodes are removed, which is much cheaper but can leave a few extra entries.
+// limit caps the number of entries removed, 0 means no limit. Returns how many were removed.
+func (s *Stream) TrimMaxLen(maxLen int, approx bool, limit int) int {
+	return s.trim(func(node *streamNode) bool {
+		return s.Length-node.Count >= maxLen
+	}, func(id StreamID) bool {
+		return s.Length > maxLen
+	}, approx, limit)
+}
+
+// TrimMinID removes entries with an ID lower than minID, see TrimMaxLen.
+func (s *Stream) TrimMinID(minID StreamID, approx bool, limit int) int {
+	return s.trim(func(node *streamNode) bool {
+		return node.Last.Less(minID)
+	}, func(id StreamID) bool {
+		return id.Less(minID)
+	}, approx, limit)
+}
+
+// trim removes whole nodes from the head while wholeNode says so, then, unless approx is
+// set, single entries while entry says so.
+func (s *Stream) trim(wholeNode func(*streamNode) bool, entry func(StreamID) bool, approx bool, limit int) int {
+	removed := 0
+
+	for len(s.Nodes) > 0 {
+		node := s.Nodes[0]
+		if !wholeNode(node) || (limit > 0 && removed+node.Count > limit) {
+			break
+		}
+
+		removed += node.Count
+		s.Length -= node.Count
+		s.removeNode(0)
+	}
+
+	if approx || len(s.Nodes) == 0 {
+		return removed
+	}
+
+	node := s.Nodes[0]
+	node.each(func(off int, id StreamID, fields []string, deleted bool) bool {
+		if deleted {
+			return true
+		}
+		if !entry(id) || (limit > 0 && removed >= limit) {
+			return false
+		}
+		node.Data[off] |= streamFlagDeleted
+		node.Count--
+		s.Length--
+		removed++
+		return true
+	})
+
+	if node.Count == 0 {
+		s.removeNode(0)
+	}
+
+	return removed
+}
+
+func (s *Stream) removeNode(idx int) {
+	s.Bytes -= len(s.Nodes[idx].Data) + STREAM_NODE_OVERHEAD
+	s.Nodes = append(s.Nodes[:idx], s.Nodes[idx+1:]...)
+}
+
+// Copy returns a deep copy of the stream.
+func (s *Stream) Copy() *Stream {
+	dup := *s
+	dup.Nodes = make([]*streamNode, len(s.Nodes))
+	for i, node := range s.Nodes {
+		n := *node
+		n.Data = append([]byte(nil), node.Data...)
+		dup.Nodes[i] = &n
+	}
+	dup.Groups = copyGroups(s.Groups)
+
+	return &dup
+}
+
+func (node *streamNode) append(id StreamID, fields []string) {
+	flags := byte(0)
+	same := len(fields)/2 == len(node.Fields)
+	for i := 0; same && i < len(node.Fields); i++ {
+		same = fields[i*2] == node.Fields[i]
+	}
+	if same {
+		flags |= streamFlagSameFields
+	}
+
+	node.Data = append(node.Data, flags)
+	node.Data = binary.AppendUvarint(node.Data, id.Ms-node.Master.Ms)
+	node.Data = binary.AppendVarint(node.Data, int64(id.Seq-node.Master.Seq))
+	node.Data = binary.AppendUvarint(node.Data, uint64(len(fields)/2))
+	for i := 0; i < len(fields); i += 2 {
+		if !same {
+			node.Data = appendString(node.Data, fields[i])
+		}
+		node.Data = appendString(node.Data, fields[i+1])
+	}
+
+	node.Last = id
+	node.Count++
+	node.Total++
+}
+
+// each decodes the entries of the node in order, calling fn with the offset of each
+// entry's flags byte until it returns false.
+func (node *streamNode) each(fn func(off int, id StreamID, fields []string, deleted bool) bool) {
+	dec := &decoder{buf: node.Data}
+
+	for len(dec.buf) > 0 {
+		off := len(node.Data) - len(dec.buf)
+		flags := dec.buf[0]
+		dec.buf = dec.buf[1:]
+
+		msDelta, n := binary.Uvarint(dec.buf)
+		dec.buf = dec.buf[n:]
+		seqDelta, n := binary.Varint(dec.buf)
+		dec.buf = dec.buf[n:]
+		id := StreamID{Ms: node.Master.Ms + msDelta, Seq: node.Master.Seq + uint64(seqDelta)}
+
+		pairs := dec.readLen()
+		fields := make([]string, 0, pairs*2)
+		for i := 0; i < pairs; i++ {
+			if flags&streamFlagSameFields != 0 {
+				fields = append(fields, node.Fields[i])
+			} else {
+				fields = append(fields, dec.readString())
+			}
+			fields = append(fields, dec.readString())
+		}
+
+		if !fn(off, id, fields, flags&streamFlagDeleted != 0) {
+			return
+		}
+	}
+}
+
+func fieldNames(fields []string) []string {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return names
+}
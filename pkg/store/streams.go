@@ -0,0 +1,819 @@
+package store
+
+import (
+	"reredis/pkg/resp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STREAM_TRIM_LIMIT is how many entries an approximate (~) trim removes at most by default.
+const STREAM_TRIM_LIMIT = 100 * STREAM_NODE_MAX_ENTRIES
+
+// streamTrim holds the MAXLEN/MINID options shared by XADD and XTRIM.
+type streamTrim struct {
+	strategy string //"MAXLEN", "MINID" or empty for no trimming
+	approx   bool
+	maxLen   int
+	minID    StreamID
+	limit    int
+}
+
+// parseTrimArg parses one trimming option at args[i], returning the index of the next
+// argument, or -1 if args[i] isn't a trimming option.
+func (trim *streamTrim) parseTrimArg(args []resp.Value, i int) (int, string) {
+	arg := strings.ToUpper(*args[i].Bulk)
+
+	switch arg {
+	case "MAXLEN", "MINID":
+		if trim.strategy != "" {
+			return 0, "syntax error, MAXLEN and MINID options at the same time are not compatible"
+		}
+		trim.strategy = arg
+		i++
+
+		if i < len(args) && (*args[i].Bulk == "~" || *args[i].Bulk == "=") {
+			trim.approx = *args[i].Bulk == "~"
+			i++
+		}
+		if i >= len(args) {
+			return 0, "syntax error"
+		}
+
+		if arg == "MAXLEN" {
+			maxLen, err := strconv.Atoi(*args[i].Bulk)
+			if err != nil {
+				return 0, "value is not an integer or out of range"
+			}
+			if maxLen < 0 {
+				return 0, "The MAXLEN argument must be >= 0."
+			}
+			trim.maxLen = maxLen
+		} else {
+			minID, err := ParseStreamID(*args[i].Bulk, 0)
+			if err != nil {
+				return 0, err.Error()
+			}
+			trim.minID = minID
+		}
+		return i + 1, ""
+	case "LIMIT":
+		if i+1 >= len(args) {
+			return 0, "syntax error"
+		}
+		limit, err := strconv.Atoi(*args[i+1].Bulk)
+		if err != nil || limit < 0 {
+			return 0, "The LIMIT argument must be >= 0."
+		}
+		trim.limit = limit
+		return i + 2, ""
+	default:
+		return -1, ""
+	}
+}
+
+// validate checks the combination of options once they're all parsed and fills in defaults.
+func (trim *streamTrim) validate(limitGiven bool) string {
+	if limitGiven && !trim.approx {
+		return "syntax error, LIMIT cannot be used without the special ~ option"
+	}
+	if trim.approx && !limitGiven {
+		trim.limit = STREAM_TRIM_LIMIT
+	}
+	return ""
+}
+
+// apply trims the stream, returning how many entries were removed.
+func (trim *streamTrim) apply(stream *Stream) int {
+	switch trim.strategy {
+	case "MAXLEN":
+		return stream.TrimMaxLen(trim.maxLen, trim.approx, trim.limit)
+	case "MINID":
+		return stream.TrimMinID(trim.minID, trim.approx, trim.limit)
+	default:
+		return 0
+	}
+}
+
+// XAdd appends an entry to a stream, creating it unless NOMKSTREAM is given:
+//
+//	XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func (store *Store) XAdd(args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		errStr := "wrong number of arguments for 'xadd' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	noMkStream := false
+	limitGiven := false
+	trim := streamTrim{}
+
+	i := 1
+	for i < len(args) {
+		if strings.ToUpper(*args[i].Bulk) == "NOMKSTREAM" {
+			noMkStream = true
+			i++
+			continue
+		}
+
+		limitGiven = limitGiven || strings.ToUpper(*args[i].Bulk) == "LIMIT"
+		next, errStr := trim.parseTrimArg(args, i)
+		if errStr != "" {
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		if next == -1 {
+			break
+		}
+		i = next
+	}
+
+	if errStr := trim.validate(limitGiven); errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	fields := args[min(i+1, len(args)):]
+	if i >= len(args) || len(fields) == 0 || len(fields)%2 != 0 {
+		errStr := "wrong number of arguments for 'xadd' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	//"*" and "ms-*" leave the sequence (and with "*" the time) to be generated
+	idArg := *args[i].Bulk
+	autoMs := idArg == "*"
+	autoSeq := autoMs
+	var id StreamID
+	if !autoMs {
+		msPart, seqPart, hasSeq := strings.Cut(idArg, "-")
+		autoSeq = !hasSeq || seqPart == "*"
+		if autoSeq {
+			idArg = msPart
+		}
+
+		var err error
+		id, err = ParseStreamID(idArg, 0)
+		if err != nil {
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		if !autoSeq && id == MinStreamID {
+			errStr := "The ID specified in XADD must be greater than 0-0"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+	}
+
+	unlock, ok := store.lockForWrite(key, store.Streams, &store.XMutex)
+	if !ok {
+		return wrongTypeValue()
+	}
+	value, ok := store.Streams.Get(key)
+	if !ok && noMkStream {
+		unlock()
+		return resp.Value{
+			Type: "null",
+		}
+	}
+
+	stream, _ := value.(*Stream)
+	if stream == nil {
+		stream = NewStream()
+	}
+
+	id, errStr := stream.nextID(id, autoMs, autoSeq)
+	if errStr != "" {
+		unlock()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	entry := make([]string, len(fields))
+	for j, field := range fields {
+		entry[j] = *field.Bulk
+	}
+	stream.Append(id, entry)
+	trimmed := trim.apply(stream)
+
+	store.Streams.Set(key, stream)
+	store.track(key, stream)
+	store.notify(NOTIFY_STREAM, "xadd", key)
+	if trimmed > 0 {
+		store.notify(NOTIFY_STREAM, "xtrim", key)
+	}
+	unlock()
+
+	store.signal(key)
+
+	res := id.String()
+	return resp.Value{
+		Type: "bulk",
+		Bulk: &res,
+	}
+}
+
+// nextID works out the ID of a new entry from what was given to XADD, making sure it's
+// greater than every ID the stream has seen.
+func (s *Stream) nextID(id StreamID, autoMs bool, autoSeq bool) (StreamID, string) {
+	if autoMs {
+		id.Ms = uint64(time.Now().UnixMilli())
+	}
+
+	if autoSeq {
+		switch {
+		case id.Ms > s.LastID.Ms || (s.EntriesAdded == 0 && s.LastID == MinStreamID):
+			id.Seq = 0
+			if id.Ms == 0 { //0-0 isn't a valid ID
+				id.Seq = 1
+			}
+			return id, ""
+		case id.Ms == s.LastID.Ms || autoMs: //with "*" the clock going backwards just reuses the last ms
+			next, ok := s.LastID.Next()
+			if !ok || (!autoMs && next.Ms != id.Ms) {
+				return id, "The stream has exhausted the last possible ID, unable to add more items"
+			}
+			return next, ""
+		}
+	}
+
+	if !s.LastID.Less(id) {
+		return id, "The ID specified in XADD is equal or smaller than the target stream top item"
+	}
+
+	return id, ""
+}
+
+// XLen returns the number of entries in a stream, 0 if it doesn't exist.
+func (store *Store) XLen(args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		errStr := "wrong number of arguments for 'xlen' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	if store.wrongType(*args[0].Bulk, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	length := int64(0)
+	store.XMutex.RLock()
+	if value, ok := store.Streams.Get(*args[0].Bulk); ok {
+		length = int64(value.(*Stream).Length)
+	}
+	store.XMutex.RUnlock()
+	store.touch(*args[0].Bulk)
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &length,
+	}
+}
+
+// XRange returns the entries with IDs between start and end inclusive:
+//
+//	XRANGE key start end [COUNT count]
+//
+// "-" and "+" stand for the smallest and greatest IDs, an ID without a sequence number
+// matches every sequence, and a "(" prefix makes that end of the range exclusive.
+func (store *Store) XRange(args []resp.Value) resp.Value {
+	return store.xrange("xrange", args, false)
+}
+
+// XRevRange is XRANGE in reverse order, with end given before start:
+//
+//	XREVRANGE key end start [COUNT count]
+func (store *Store) XRevRange(args []resp.Value) resp.Value {
+	return store.xrange("xrevrange", args, true)
+}
+
+func (store *Store) xrange(cmd string, args []resp.Value, rev bool) resp.Value {
+	if len(args) != 3 && len(args) != 5 {
+		errStr := "wrong number of arguments for '" + cmd + "' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	startArg, endArg := *args[1].Bulk, *args[2].Bulk
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+
+	start, startOk, err := parseRangeID(startArg, false)
+	if err != nil {
+		errStr := err.Error()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	end, endOk, err := parseRangeID(endArg, true)
+	if err != nil {
+		errStr := err.Error()
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	count := -1 //no limit
+	if len(args) == 5 {
+		if strings.ToUpper(*args[3].Bulk) != "COUNT" {
+			errStr := "syntax error"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		count, err = strconv.Atoi(*args[4].Bulk)
+		if err != nil {
+			errStr := "value is not an integer or out of range"
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		count = max(count, 0)
+	}
+
+	if store.wrongType(*args[0].Bulk, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	entries := []StreamEntry{}
+	if startOk && endOk && count != 0 {
+		store.XMutex.RLock()
+		if value, ok := store.Streams.Get(*args[0].Bulk); ok {
+			entries = value.(*Stream).Range(start, end, max(count, 0), rev)
+		}
+		store.XMutex.RUnlock()
+		store.touch(*args[0].Bulk)
+	}
+
+	return streamEntriesValue(entries)
+}
+
+// parseRangeID parses one end of an XRANGE interval. ok is false for exclusive bounds
+// that leave nothing to match, like "(18446744073709551615-18446744073709551615".
+func parseRangeID(arg string, isEnd bool) (id StreamID, ok bool, err error) {
+	switch arg {
+	case "-":
+		return MinStreamID, true, nil
+	case "+":
+		return MaxStreamID, true, nil
+	}
+
+	missingSeq := uint64(0)
+	if isEnd {
+		missingSeq = MaxStreamID.Seq
+	}
+
+	exclusive := strings.HasPrefix(arg, "(")
+	if !exclusive {
+		id, err = ParseStreamID(arg, missingSeq)
+		return id, err == nil, err
+	}
+
+	id, err = ParseStreamID(arg[1:], missingSeq)
+	if err != nil {
+		return id, false, err
+	}
+	if isEnd {
+		id, ok = id.Prev()
+	} else {
+		id, ok = id.Next()
+	}
+	return id, ok, nil
+}
+
+// XDel deletes entries by ID, returning how many existed.
+func (store *Store) XDel(args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		errStr := "wrong number of arguments for 'xdel' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	ids := make([]StreamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := ParseStreamID(*arg.Bulk, 0)
+		if err != nil {
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	key := *args[0].Bulk
+	deleted := int64(0)
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.Lock()
+	if value, ok := store.Streams.Get(key); ok {
+		stream := value.(*Stream)
+		for _, id := range ids {
+			if stream.Delete(id) {
+				deleted++
+			}
+		}
+		if deleted > 0 {
+			store.track(key, stream)
+			store.notify(NOTIFY_STREAM, "xdel", key)
+		}
+	}
+	store.XMutex.Unlock()
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &deleted,
+	}
+}
+
+// XTrim trims a stream, returning how many entries were removed:
+//
+//	XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func (store *Store) XTrim(args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		errStr := "wrong number of arguments for 'xtrim' command"
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	trim := streamTrim{}
+	limitGiven := false
+	for i := 1; i < len(args); {
+		limitGiven = limitGiven || strings.ToUpper(*args[i].Bulk) == "LIMIT"
+		next, errStr := trim.parseTrimArg(args, i)
+		if next == -1 {
+			errStr = "syntax error"
+		}
+		if errStr != "" {
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		i = next
+	}
+
+	errStr := trim.validate(limitGiven)
+	if trim.strategy == "" {
+		errStr = "syntax error"
+	}
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	key := *args[0].Bulk
+	trimmed := int64(0)
+
+	if store.wrongType(key, store.Streams, &store.XMutex) {
+		return wrongTypeValue()
+	}
+
+	store.XMutex.Lock()
+	if value, ok := store.Streams.Get(key); ok {
+		stream := value.(*Stream)
+		trimmed = int64(trim.apply(stream))
+		if trimmed > 0 {
+			store.track(key, stream)
+			store.notify(NOTIFY_STREAM, "xtrim", key)
+		}
+	}
+	store.XMutex.Unlock()
+
+	return resp.Value{
+		Type:   "integer",
+		Number: &trimmed,
+	}
+}
+
+// streamRead holds the options shared by XREAD and XREADGROUP.
+type streamRead struct {
+	group    string
+	consumer string
+	count    int
+	block    time.Duration //-1 when not blocking
+	noAck    bool
+	keys     []string
+	ids      []string
+}
+
+// parseStreamRead parses the arguments of XREAD, or XREADGROUP when group is set:
+//
+//	[GROUP group consumer] [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamRead(cmd string, args []resp.Value, group bool) (*streamRead, string) {
+	read := &streamRead{block: -1}
+
+	i := 0
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(*args[i].Bulk)
+		if arg == "STREAMS" {
+			break
+		}
+
+		switch {
+		case arg == "NOACK" && group:
+			read.noAck = true
+			continue
+		case arg == "GROUP" && !group:
+			return nil, "The GROUP option is only supported by XREADGROUP. You called XREAD instead."
+		case arg == "GROUP" && i+2 < len(args):
+			read.group, read.consumer = *args[i+1].Bulk, *args[i+2].Bulk
+			i += 2
+			continue
+		case (arg != "COUNT" && arg != "BLOCK") || i+1 >= len(args):
+			return nil, "syntax error"
+		}
+
+		n, err := strconv.Atoi(*args[i+1].Bulk)
+		switch {
+		case arg == "COUNT" && err != nil:
+			return nil, "value is not an integer or out of range"
+		case arg == "COUNT":
+			read.count = max(n, 0)
+		case err != nil:
+			return nil, "timeout is not an integer or out of range"
+		case n < 0:
+			return nil, "timeout is negative"
+		default:
+			read.block = time.Duration(n) * time.Millisecond
+		}
+		i++
+	}
+
+	streams := args[min(i+1, len(args)):]
+	if i >= len(args) {
+		return nil, "syntax error"
+	}
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return nil, "Unbalanced '" + strings.ToLower(cmd) + "' list of streams: for each stream key an ID or '$' must be specified."
+	}
+	if group && read.group == "" {
+		return nil, "Missing GROUP option for XREADGROUP"
+	}
+
+	for j := 0; j < len(streams)/2; j++ {
+		read.keys = append(read.keys, *streams[j].Bulk)
+		read.ids = append(read.ids, *streams[len(streams)/2+j].Bulk)
+	}
+
+	return read, ""
+}
+
+// XRead returns the entries after the given IDs from one or more streams:
+//
+//	XREAD [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...]
+//
+// "$" reads only entries added after the command was issued. With BLOCK, if there's
+// nothing to return the call waits until one of the streams gets new entries, the
+// timeout passes (0 waits forever) or cancel is closed. A nil cancel means the caller
+// can't block, like inside a transaction, and BLOCK is ignored.
+func (store *Store) XRead(args []resp.Value, cancel <-chan struct{}) resp.Value {
+	read, errStr := parseStreamRead("XREAD", args, false)
+	if errStr != "" {
+		return resp.Value{
+			Type:   "error",
+			String: &errStr,
+		}
+	}
+
+	for _, key := range read.keys {
+		if store.wrongType(key, store.Streams, &store.XMutex) {
+			return wrongTypeValue()
+		}
+	}
+
+	ids := make([]StreamID, len(read.keys))
+
+	store.XMutex.RLock()
+	for j, key := range read.keys {
+		switch read.ids[j] {
+		case "$":
+			if value, ok := store.Streams.Get(key); ok {
+				ids[j] = value.(*Stream).LastID
+			}
+			continue
+		case ">":
+			store.XMutex.RUnlock()
+			errStr := "The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+
+		id, err := ParseStreamID(read.ids[j], 0)
+		if err != nil {
+			store.XMutex.RUnlock()
+			errStr := err.Error()
+			return resp.Value{
+				Type:   "error",
+				String: &errStr,
+			}
+		}
+		ids[j] = id
+	}
+	store.XMutex.RUnlock()
+
+	return store.blockOn(read.keys, read.block, cancel, func() (resp.Value, bool) {
+		res := store.readStreams(read.keys, ids, read.count)
+		return resp.Value{
+			Type:  "array",
+			Array: res,
+		}, len(res) > 0
+	})
+}
+
+// blockOn calls try until it reports it has a reply. Between attempts it waits for one of
+// keys to be written to, for at most timeout (0 waits forever). With a negative timeout or
+// a nil cancel it only tries once. Timing out replies with a null array.
+func (store *Store) blockOn(keys []string, timeout time.Duration, cancel <-chan struct{}, try func() (resp.Value, bool)) resp.Value {
+	if cancel == nil {
+		timeout = -1
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		//register before trying so a write in between can't be missed
+		var wake chan struct{}
+		if timeout >= 0 {
+			wake = store.wait(keys)
+		}
+
+		res, ok := try()
+		if ok || timeout < 0 {
+			if wake != nil {
+				store.unwait(keys, wake)
+			}
+			if !ok {
+				return resp.Value{
+					Type: "nullarray",
+				}
+			}
+			return res
+		}
+
+		select {
+		case <-wake:
+			store.unwait(keys, wake)
+		case <-expired:
+			store.unwait(keys, wake)
+			return resp.Value{
+				Type: "nullarray",
+			}
+		case <-cancel:
+			store.unwait(keys, wake)
+			return resp.Value{}
+		}
+	}
+}
+
+// readStreams returns a [key, entries] pair for every stream with entries after its ID.
+func (store *Store) readStreams(keys []string, ids []StreamID, count int) []resp.Value {
+	res := []resp.Value{}
+
+	store.XMutex.RLock()
+	defer store.XMutex.RUnlock()
+
+	for j, key := range keys {
+		value, ok := store.Streams.Get(key)
+		if !ok {
+			continue
+		}
+
+		start, ok := ids[j].Next()
+		if !ok {
+			continue
+		}
+
+		entries := value.(*Stream).Range(start, MaxStreamID, count, false)
+		if len(entries) == 0 {
+			continue
+		}
+
+		res = append(res, resp.Value{
+			Type: "array",
+			Array: []resp.Value{
+				{Type: "bulk", Bulk: &keys[j]},
+				streamEntriesValue(entries),
+			},
+		})
+	}
+
+	return res
+}
+
+// streamEntriesValue encodes entries as an array of [id, [field, value, ...]] pairs.
+func streamEntriesValue(entries []StreamEntry) resp.Value {
+	res := make([]resp.Value, len(entries))
+	for i, entry := range entries {
+		id := entry.ID.String()
+		fields := make([]resp.Value, len(entry.Fields))
+		for j := range entry.Fields {
+			fields[j] = resp.Value{Type: "bulk", Bulk: &entry.Fields[j]}
+		}
+
+		res[i] = resp.Value{
+			Type: "array",
+			Array: []resp.Value{
+				{Type: "bulk", Bulk: &id},
+				{Type: "array", Array: fields},
+			},
+		}
+	}
+
+	return resp.Value{
+		Type:  "array",
+		Array: res,
+	}
+}
+
+// wait registers a channel that's signalled the next time any of keys is written to by
+// a command that can unblock clients.
+func (store *Store) wait(keys []string) chan struct{} {
+	wake := make(chan struct{}, 1)
+
+	store.WMutex.Lock()
+	for _, key := range keys {
+		store.Waiters[key] = append(store.Waiters[key], wake)
+	}
+	store.WMutex.Unlock()
+
+	return wake
+}
+
+func (store *Store) unwait(keys []string, wake chan struct{}) {
+	store.WMutex.Lock()
+	defer store.WMutex.Unlock()
+
+	for _, key := range keys {
+		waiters := store.Waiters[key]
+		for i, ch := range waiters {
+			if ch == wake {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+
+		if len(waiters) == 0 {
+			delete(store.Waiters, key)
+		} else {
+			store.Waiters[key] = waiters
+		}
+	}
+}
+
+// signal wakes up every client blocked on key. They recheck their condition and wait again if needed.
+func (store *Store) signal(key string) {
+	store.WMutex.Lock()
+	defer store.WMutex.Unlock()
+
+	for _, wake := range store.Waiters[key] {
+		select {
+		case wake <- struct{}{}:
+		default: //already signalled through another key
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package utils
+
+import "math"
+
+// Geohashes interleave the bits of the latitude and longitude offsets into a single
+// 52 bit integer (26 bits each, latitude in the even bits), so points that are close
+// together mostly share a prefix and an area is a handful of integer ranges. Like redis,
+// latitudes are limited to what web mercator can represent.
+const (
+	GEO_STEP_MAX = 26 //bits per coordinate
+
+	GEO_LAT_MIN  = -85.05112878
+	GEO_LAT_MAX  = 85.05112878
+	GEO_LONG_MIN = -180.0
+	GEO_LONG_MAX = 180.0
+
+	MERCATOR_MAX           = 20037726.37
+	EARTH_RADIUS_IN_METERS = 6372797.560856
+)
+
+const geoAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeoArea is the cell a geohash stands for.
+type GeoArea struct {
+	LongMin, LongMax float64
+	LatMin, LatMax   float64
+}
+
+// GeoRange is a range of 52 bit geohashes, Min inclusive and Max exclusive.
+type GeoRange struct {
+	Min, Max uint64
+}
+
+// GeoValid reports whether lon, lat can be indexed.
+func GeoValid(lon float64, lat float64) bool {
+	return lon >= GEO_LONG_MIN && lon <= GEO_LONG_MAX && lat >= GEO_LAT_MIN && lat <= GEO_LAT_MAX
+}
+
+// GeoEncode returns the 52 bit geohash of a point. The point must be GeoValid.
+func GeoEncode(lon float64, lat float64) uint64 {
+	return geoEncode(lon, lat, GEO_LAT_MIN, GEO_LAT_MAX, GEO_STEP_MAX)
+}
+
+func geoEncode(lon float64, lat float64, latMin float64, latMax float64, step uint) uint64 {
+	latOffset := (lat - latMin) / (latMax - latMin)
+	lonOffset := (lon - GEO_LONG_MIN) / (GEO_LONG_MAX - GEO_LONG_MIN)
+
+	cells := float64(uint64(1) << step)
+	ilat := min(uint64(latOffset*cells), uint64(cells)-1)
+	ilon := min(uint64(lonOffset*cells), uint64(cells)-1)
+
+	return interleave64(uint32(ilat), uint32(ilon))
+}
+
+// GeoDecode returns the point a 52 bit geohash stands for, the center of its cell.
+func GeoDecode(hash uint64) (lon float64, lat float64) {
+	area := geoDecodeArea(hash, GEO_STEP_MAX)
+
+	lon = min(max((area.LongMin+area.LongMax)/2, GEO_LONG_MIN), GEO_LONG_MAX)
+	lat = min(max((area.LatMin+area.LatMax)/2, GEO_LAT_MIN), GEO_LAT_MAX)
+	return lon, lat
+}
+
+func geoDecodeArea(hash uint64, step uint) GeoArea {
+	ilat, ilon := deinterleave64(hash)
+	cells := float64(uint64(1) << step)
+	latScale := GEO_LAT_MAX - GEO_LAT_MIN
+	lonScale := GEO_LONG_MAX - GEO_LONG_MIN
+
+	return GeoArea{
+		LatMin:  GEO_LAT_MIN + float64(ilat)/cells*latScale,
+		LatMax:  GEO_LAT_MIN + float64(ilat+1)/cells*latScale,
+		LongMin: GEO_LONG_MIN + float64(ilon)/cells*lonScale,
+		LongMax: GEO_LONG_MIN + float64(ilon+1)/cells*lonScale,
+	}
+}
+
+// GeoHashString returns the standard 11 character base32 geohash of a point, the one
+// used by other geohash tools, which covers latitudes -90 to 90.
+func GeoHashString(lon float64, lat float64) string {
+	hash := geoEncode(lon, lat, -90, 90, GEO_STEP_MAX)
+
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		if i < 10 { //52 bits only fill 10 characters, the last one is always '0'
+			idx = int((hash >> (52 - (i+1)*5)) & 0x1f)
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf)
+}
+
+// GeoDistance returns the distance in meters between two points, using the haversine formula.
+func GeoDistance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin(degRad(lon2-lon1) / 2)
+
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EARTH_RADIUS_IN_METERS * math.Asin(math.Sqrt(a))
+}
+
+// GeoInBox reports whether a point lies in a width x height meters box centered on
+// lon, lat, and if so its distance from the center.
+func GeoInBox(lon float64, lat float64, width float64, height float64, plon float64, plat float64) (float64, bool) {
+	//the latitude distance is the same along any meridian, the longitude one is measured
+	//along the point's parallel
+	if EARTH_RADIUS_IN_METERS*math.Abs(degRad(plat)-degRad(lat)) > height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, plat, plon, plat) > width/2 {
+		return 0, false
+	}
+	return GeoDistance(lon, lat, plon, plat), true
+}
+
+// GeoCoveringRanges returns the geohash ranges to scan for points within a width x height
+// meters box centered on lon, lat (a circle of radius r is the 2r x 2r box). It picks
+// the precision where the box fits in the cell of the center plus its 8 neighbours.
+func GeoCoveringRanges(lon float64, lat float64, width float64, height float64) []GeoRange {
+	latDelta := radDeg(height / 2 / EARTH_RADIUS_IN_METERS)
+	lonDeltaTop := radDeg(width / 2 / EARTH_RADIUS_IN_METERS / math.Cos(degRad(lat+latDelta)))
+	lonDeltaBottom := radDeg(width / 2 / EARTH_RADIUS_IN_METERS / math.Cos(degRad(lat-latDelta)))
+	lonDelta := lonDeltaTop //the box is widest on the side closest to the equator
+	if lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	minLon, maxLon := lon-lonDelta, lon+lonDelta
+	minLat, maxLat := lat-latDelta, lat+latDelta
+
+	step := geoEstimateSteps(math.Sqrt(width*width+height*height)/2, lat)
+	for ; step > 1; step-- {
+		area := geoDecodeArea(geoEncode(lon, lat, GEO_LAT_MIN, GEO_LAT_MAX, step), step)
+		cellLat := area.LatMax - area.LatMin
+		cellLon := area.LongMax - area.LongMin
+		//the neighbours extend the center cell by one cell in each direction
+		if area.LatMax+cellLat >= maxLat && area.LatMin-cellLat <= minLat &&
+			area.LongMax+cellLon >= maxLon && area.LongMin-cellLon <= minLon {
+			break
+		}
+	}
+
+	ilat, ilon := deinterleave64(geoEncode(lon, lat, GEO_LAT_MIN, GEO_LAT_MAX, step))
+	cells := int64(1) << step
+	shift := 2 * (GEO_STEP_MAX - step)
+
+	ranges := []GeoRange{}
+	seen := map[uint64]bool{}
+	for dlat := int64(-1); dlat <= 1; dlat++ {
+		nlat := int64(ilat) + dlat
+		if nlat < 0 || nlat >= cells {
+			continue
+		}
+		for dlon := int64(-1); dlon <= 1; dlon++ {
+			nlon := (int64(ilon) + dlon + cells) % cells //longitudes wrap around
+			hash := interleave64(uint32(nlat), uint32(nlon))
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			ranges = append(ranges, GeoRange{Min: hash << shift, Max: (hash + 1) << shift})
+		}
+	}
+
+	return ranges
+}
+
+// geoEstimateSteps picks the precision whose cells are about the size of the search radius.
+func geoEstimateSteps(radius float64, lat float64) uint {
+	if radius == 0 {
+		return GEO_STEP_MAX
+	}
+
+	step := 1
+	for radius < MERCATOR_MAX {
+		radius *= 2
+		step++
+	}
+	step -= 2 //make sure the range is included in most of the base cases
+
+	//cells get narrower towards the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+
+	return uint(min(max(step, 1), GEO_STEP_MAX))
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// interleave64 spreads the bits of x into the even bits of the result and y into the odd ones.
+func interleave64(x uint32, y uint32) uint64 {
+	return spreadBits(uint64(x)) | spreadBits(uint64(y))<<1
+}
+
+func deinterleave64(v uint64) (x uint32, y uint32) {
+	return uint32(squashBits(v)), uint32(squashBits(v >> 1))
+}
+
+func spreadBits(v uint64) uint64 {
+	v = (v | v<<16) & 0x0000FFFF0000FFFF
+	v = (v | v<<8) & 0x00FF00FF00FF00FF
+	v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+func squashBits(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0F0F0F0F0F0F0F0F
+	v = (v | v>>4) & 0x00FF00FF00FF00FF
+	v = (v | v>>8) & 0x0000FFFF0000FFFF
+	v = (v | v>>16) & 0x00000000FFFFFFFF
+	return v
+}
@@ -0,0 +1,114 @@
+package utils
+
+// GlobMatch reports whether str matches the Redis-style glob pattern.
+// Supported syntax:
+//
+//	?      matches exactly one character
+//	*      matches any sequence of characters (including none)
+//	[abc]  matches one of the listed characters
+//	[^abc] matches any character not listed
+//	[a-z]  matches a character in the range
+//	\x     matches x literally
+//
+// It is shared by KEYS, and anything else that needs key or channel patterns.
+// Every element but '*' matches exactly one character, so when a match fails it's
+// enough to let the last '*' swallow one more character and carry on from there:
+// matching takes at most len(pattern)*len(str) steps, without recursion.
+func GlobMatch(pattern, str string, nocase bool) bool {
+	p, s := 0, 0
+	star, starS := -1, 0 //pattern after the last '*', and where in str it resumes
+	for s < len(str) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				for p < len(pattern) && pattern[p] == '*' { //collapse consecutive stars
+					p++
+				}
+				if p == len(pattern) {
+					return true //trailing star matches the rest
+				}
+				star, starS = p, s
+				continue
+			}
+			if next, ok := matchOne(pattern, p, str[s], nocase); ok {
+				p, s = next, s+1
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		starS++
+		p, s = star, starS
+	}
+
+	//the string is consumed, whatever is left of the pattern must be stars
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchOne matches c against the pattern element at p, which isn't a '*', returning
+// where the next element starts.
+func matchOne(pattern string, p int, c byte, nocase bool) (int, bool) {
+	switch pattern[p] {
+	case '?':
+		return p + 1, true
+	case '[':
+		p++
+		not := p < len(pattern) && pattern[p] == '^'
+		if not {
+			p++
+		}
+		match := false
+		for {
+			if p >= len(pattern) {
+				p-- //unterminated class, treat the end as ']'
+				break
+			}
+			if pattern[p] == '\\' && p+1 < len(pattern) {
+				p++
+				if pattern[p] == c {
+					match = true
+				}
+			} else if pattern[p] == ']' {
+				break
+			} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+				start, end, ch := pattern[p], pattern[p+2], c
+				if start > end {
+					start, end = end, start
+				}
+				if nocase {
+					start, end, ch = lower(start), lower(end), lower(ch)
+				}
+				p += 2
+				if ch >= start && ch <= end {
+					match = true
+				}
+			} else if equalByte(pattern[p], c, nocase) {
+				match = true
+			}
+			p++
+		}
+		return p + 1, match != not
+	case '\\':
+		if p+1 < len(pattern) {
+			p++
+		}
+	}
+	return p + 1, equalByte(pattern[p], c, nocase)
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
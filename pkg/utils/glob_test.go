@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		nocase  bool
+		want    bool
+	}{
+		{"", "", false, true},
+		{"", "a", false, false},
+		{"*", "", false, true},
+		{"*", "anything", false, true},
+		{"**", "x", false, true},
+		{"hello", "hello", false, true},
+		{"hello", "hell", false, false},
+		{"hello", "Hello", false, false},
+		{"hello", "HeLLo", true, true},
+		{"h?llo", "hallo", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "hllo", false, true},
+		{"h*llo", "heeeello", false, true},
+		{"h*llo", "hello world", false, false},
+		{"*llo", "hello", false, true},
+		{"he*", "hello", false, true},
+		{"*l*o*", "hello", false, true},
+		{"*x*", "hello", false, false},
+		{"a*b*c", "a--b--b--c", false, true},
+		{"a*b*c", "a--b--b--", false, false},
+		{"user:*:name", "user:1:2:name", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-c]llo", "hbllo", false, true},
+		{"h[a-c]llo", "hdllo", false, false},
+		{"h[c-a]llo", "hbllo", false, true}, //reversed ranges work either way
+		{"[A-Z]", "q", true, true},
+		{"[A-Z]", "q", false, false},
+		{"[-a]", "-", false, true},
+		{"[\\]]", "]", false, true},
+		{"[\\-]", "-", false, true},
+		{"[ab", "a", false, true}, //an unterminated class ends with the pattern
+		{"[ab", "c", false, false},
+		{"h\\*llo", "h*llo", false, true},
+		{"h\\*llo", "hello", false, false},
+		{"\\?", "?", false, true},
+		{"\\?", "a", false, false},
+		{"a\\", "a\\", false, true}, //a trailing backslash is literal
+		{"*[0-9]", "key9", false, true},
+		{"*[0-9]", "key", false, false},
+		{"\xff*", "\xff\x00", false, true},
+	}
+
+	for _, test := range tests {
+		if got := GlobMatch(test.pattern, test.str, test.nocase); got != test.want {
+			t.Errorf("GlobMatch(%q, %q, %v) = %v, want %v", test.pattern, test.str, test.nocase, got, test.want)
+		}
+	}
+}
+
+// Patterns with many stars used to backtrack exponentially, a client could stall the
+// server with a single KEYS. They must now fail in about len(pattern)*len(str) steps.
+func TestGlobMatchManyStars(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	str := strings.Repeat("a", 10000)
+	if GlobMatch(pattern, str, false) {
+		t.Errorf("matched a string without a b")
+	}
+	if !GlobMatch(pattern, str+"b", false) {
+		t.Errorf("didn't match a string ending in b")
+	}
+}
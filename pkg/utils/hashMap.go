@@ -1,5 +1,7 @@
 package utils
 
+import "math/rand/v2"
+
 type HashMap struct {
 	Buckets []Entry
 	Count   int
@@ -32,17 +34,29 @@ func Hash(s string) uint64 {
 func (hMap *HashMap) Set(key string, value any) {
 
 	//check load factor
-	if float64(hMap.Used)/float64(len(hMap.Buckets)) > 0.75 {
+	if float64(hMap.Used+1)/float64(len(hMap.Buckets)) > 0.75 { //keep at least one empty bucket so probing terminates
 		hMap.Resize()
 	}
 
 	hIdx := int(Hash(key) % uint64(len(hMap.Buckets)))
+	tombIdx := -1 //first tombstone on the probe path, reused if the key isn't further along
 
 	for {
 		val := hMap.Buckets[hIdx]
-		if val.Key == "" || val.Tombstone || val.Key == key { //no collision
-			if val.Key == "" || val.Tombstone {
-				hMap.Count++
+		if val.Key == key && !val.Tombstone { //overwrite in place
+			hMap.Buckets[hIdx].Value = value
+			return
+		}
+
+		if val.Tombstone && tombIdx == -1 {
+			tombIdx = hIdx
+		}
+
+		if val.Key == "" && !val.Tombstone { //end of the probe chain
+			if tombIdx != -1 {
+				hIdx = tombIdx
+			} else {
+				hMap.Used++
 			}
 
 			hMap.Buckets[hIdx] = Entry{
@@ -50,7 +64,7 @@ func (hMap *HashMap) Set(key string, value any) {
 				Value:     value,
 				Tombstone: false,
 			}
-			hMap.Used++
+			hMap.Count++
 			return
 		}
 
@@ -96,12 +110,69 @@ func (hMap *HashMap) Delete(key string) {
 
 func (hMap *HashMap) Resize() {
 	oldBkts := hMap.Buckets
-	hMap.Buckets = make([]Entry, len(oldBkts)*2)
+	size := len(oldBkts)
+	//only grow if it's actually full of live keys, otherwise just drop the tombstones. Either
+	//way the key about to be added has to leave an empty bucket, or probing never ends
+	for size == 0 || hMap.Count*2 >= size || float64(hMap.Count+1)/float64(size) > 0.75 {
+		size = max(size*2, 1)
+	}
+	hMap.Buckets = make([]Entry, size)
 	hMap.Count = 0
+	hMap.Used = 0
 
 	for _, val := range oldBkts {
-		if val.Key != "" || !val.Tombstone {
+		if val.Key != "" && !val.Tombstone {
 			hMap.Set(val.Key, val.Value)
 		}
 	}
 }
+
+// RandomEntry returns a live entry starting from a random bucket, or false if the map is empty.
+func (hMap *HashMap) RandomEntry() (string, any, bool) {
+	if hMap.Count == 0 {
+		return "", nil, false
+	}
+
+	start := rand.IntN(len(hMap.Buckets))
+	for i := 0; i < len(hMap.Buckets); i++ {
+		val := hMap.Buckets[(start+i)%len(hMap.Buckets)]
+		if val.Key != "" && !val.Tombstone {
+			return val.Key, val.Value, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// Range calls fn for every live entry in the map, stopping early if fn returns false.
+func (hMap *HashMap) Range(fn func(key string, value any) bool) {
+	for _, val := range hMap.Buckets {
+		if val.Key == "" || val.Tombstone {
+			continue
+		}
+
+		if !fn(val.Key, val.Value) {
+			return
+		}
+	}
+}
+
+// Sample returns up to n live entries from a run of consecutive buckets starting at a
+// random one. It gives up after visiting n*20 buckets so sparse maps stay cheap to sample.
+func (hMap *HashMap) Sample(n int) []Entry {
+	res := []Entry{}
+	if hMap.Count == 0 {
+		return res
+	}
+
+	start := rand.IntN(len(hMap.Buckets))
+	visits := min(n*20, len(hMap.Buckets))
+	for i := 0; i < visits && len(res) < n; i++ {
+		val := hMap.Buckets[(start+i)%len(hMap.Buckets)]
+		if val.Key != "" && !val.Tombstone {
+			res = append(res, val)
+		}
+	}
+
+	return res
+}
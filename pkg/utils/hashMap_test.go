@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strconv"
+	"testing"
+)
+
+// hasEmptyBucket reports whether probing for a missing key is guaranteed to end.
+func hasEmptyBucket(hMap *HashMap) bool {
+	for _, entry := range hMap.Buckets {
+		if entry.Key == "" && !entry.Tombstone {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHashMapLoadFactor(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 4, 16} {
+		hMap := NewHashMap(size)
+		for i := 0; i < 100; i++ {
+			key := strconv.Itoa(i)
+			hMap.Set(key, i)
+			if !hasEmptyBucket(hMap) {
+				t.Fatalf("size %d: no empty bucket left after %d keys", size, i+1)
+			}
+			if float64(hMap.Used)/float64(len(hMap.Buckets)) > 0.75 {
+				t.Fatalf("size %d: %d of %d buckets used after %d keys", size, hMap.Used, len(hMap.Buckets), i+1)
+			}
+			if _, ok := hMap.Get("missing"); ok {
+				t.Fatalf("size %d: found a key that was never set", size)
+			}
+			if value, ok := hMap.Get(key); !ok || value != i {
+				t.Fatalf("size %d: Get(%s) = %v, %v", size, key, value, ok)
+			}
+		}
+		if hMap.Count != 100 {
+			t.Errorf("size %d: Count = %d, want 100", size, hMap.Count)
+		}
+	}
+}
+
+// Deleting leaves tombstones, which count towards the load factor until a resize drops
+// them, so churning keys mustn't use up the empty buckets either.
+func TestHashMapChurn(t *testing.T) {
+	for _, size := range []int{1, 4, 16} {
+		hMap := NewHashMap(size)
+		for i := 0; i < 1000; i++ {
+			hMap.Set(strconv.Itoa(i), i)
+			hMap.Delete(strconv.Itoa(i - 2))
+			if !hasEmptyBucket(hMap) {
+				t.Fatalf("size %d: no empty bucket left after %d rounds", size, i+1)
+			}
+		}
+		if hMap.Count != 2 {
+			t.Errorf("size %d: Count = %d, want 2", size, hMap.Count)
+		}
+		for _, key := range []string{"998", "999"} {
+			if _, ok := hMap.Get(key); !ok {
+				t.Errorf("size %d: %s is missing", size, key)
+			}
+		}
+		if _, ok := hMap.Get("0"); ok {
+			t.Errorf("size %d: deleted key 0 is still there", size)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseMemory parses a redis style memory amount like "100mb" or "1gb" into bytes.
+// Units are case insensitive, "k"/"m"/"g" are powers of 1000 and "kb"/"mb"/"gb" powers of 1024.
+func ParseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(s))
+	mul := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			mul = unit.mul
+			break
+		}
+	}
+
+	num, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid memory amount %q", s)
+	}
+
+	return num * mul, nil
+}
@@ -0,0 +1,150 @@
+package utils
+
+import "math/rand/v2"
+
+// Skip list of members ordered by score, then by member, like the one behind redis' sorted
+// sets. Lookups, inserts and deletes are O(log n) on average, and range scans just walk
+// the bottom level.
+const (
+	SKIPLIST_MAXLEVEL = 32
+	SKIPLIST_P        = 0.25
+)
+
+type SkipListNode struct {
+	Member   string
+	Score    float64
+	backward *SkipListNode
+	forward  []*SkipListNode //one pointer per level the node is part of
+}
+
+type SkipList struct {
+	head   *SkipListNode
+	tail   *SkipListNode
+	level  int
+	Length int
+}
+
+func NewSkipList() *SkipList {
+	return &SkipList{
+		head:  &SkipListNode{forward: make([]*SkipListNode, SKIPLIST_MAXLEVEL)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < SKIPLIST_MAXLEVEL && rand.Float64() < SKIPLIST_P {
+		level++
+	}
+	return level
+}
+
+// less orders nodes by score, breaking ties by member.
+func (node *SkipListNode) less(score float64, member string) bool {
+	return node.Score < score || (node.Score == score && node.Member < member)
+}
+
+// Insert adds member with the given score. The caller must make sure member isn't
+// already in the list, deleting it first to change its score.
+func (sl *SkipList) Insert(score float64, member string) *SkipListNode {
+	update := [SKIPLIST_MAXLEVEL]*SkipListNode{}
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].less(score, member) {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	for i := sl.level; i < level; i++ {
+		update[i] = sl.head
+	}
+	sl.level = max(sl.level, level)
+
+	node := &SkipListNode{
+		Member:  member,
+		Score:   score,
+		forward: make([]*SkipListNode, level),
+	}
+	for i := 0; i < level; i++ {
+		node.forward[i] = update[i].forward[i]
+		update[i].forward[i] = node
+	}
+
+	if update[0] != sl.head {
+		node.backward = update[0]
+	}
+	if node.forward[0] != nil {
+		node.forward[0].backward = node
+	} else {
+		sl.tail = node
+	}
+
+	sl.Length++
+	return node
+}
+
+// Delete removes member with the given score, returning false if it isn't there.
+func (sl *SkipList) Delete(score float64, member string) bool {
+	update := [SKIPLIST_MAXLEVEL]*SkipListNode{}
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].less(score, member) {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	x = x.forward[0]
+	if x == nil || x.Score != score || x.Member != member {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].forward[i] == x {
+			update[i].forward[i] = x.forward[i]
+		}
+	}
+
+	if x.forward[0] != nil {
+		x.forward[0].backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+
+	for sl.level > 1 && sl.head.forward[sl.level-1] == nil {
+		sl.level--
+	}
+
+	sl.Length--
+	return true
+}
+
+// First returns the first node with a score >= min, or nil.
+func (sl *SkipList) First(min float64) *SkipListNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].Score < min {
+			x = x.forward[i]
+		}
+	}
+	return x.forward[0]
+}
+
+// Last returns the last node of the list, or nil if it's empty.
+func (sl *SkipList) Last() *SkipListNode {
+	return sl.tail
+}
+
+// Next returns the node after this one, or nil.
+func (node *SkipListNode) Next() *SkipListNode {
+	return node.forward[0]
+}
+
+// Prev returns the node before this one, or nil.
+func (node *SkipListNode) Prev() *SkipListNode {
+	return node.backward
+}
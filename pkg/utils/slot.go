@@ -0,0 +1,35 @@
+package utils
+
+import "strings"
+
+// CLUSTER_SLOTS is the number of hash slots the keyspace is split into, like redis cluster.
+const CLUSTER_SLOTS = 16384
+
+// KeyHashSlot returns the hash slot of key. If the key contains a non-empty hash tag,
+// like "{user:1}:name", only the tag is hashed so related keys land in the same slot.
+func KeyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) & (CLUSTER_SLOTS - 1)
+}
+
+// crc16 is the CCITT/XMODEM variant used by redis cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,120 @@
+package utils
+
+// SplitArgs splits a line into arguments the way redis does for inline commands and
+// config files: arguments are separated by spaces and can be quoted. Double quoted
+// arguments understand \n, \r, \t, \b, \a and \xHH escapes, single quoted ones only \'.
+// A closing quote must be followed by a space or the end of the line. Returns false on
+// unbalanced quotes.
+func SplitArgs(line string) ([]string, bool) {
+	args := []string{}
+
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, true
+		}
+
+		inDouble, inSingle := false, false
+		current := []byte{}
+
+		for done := false; !done; {
+			switch {
+			case inDouble:
+				if i >= len(line) {
+					return nil, false //unterminated quotes
+				}
+
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					current = append(current, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				case line[i] == '"':
+					//the closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				default:
+					current = append(current, line[i])
+				}
+			case inSingle:
+				if i >= len(line) {
+					return nil, false
+				}
+
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					current = append(current, '\'')
+					i++
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				default:
+					current = append(current, line[i])
+				}
+			default:
+				if i >= len(line) {
+					done = true
+					break
+				}
+
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					current = append(current, line[i])
+				}
+			}
+
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, string(current))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}